@@ -15,6 +15,7 @@ import (
 	"github.com/0xsequence/bundler/p2p"
 	"github.com/0xsequence/bundler/proto"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/rlp"
 	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
 	"github.com/go-chi/httplog/v2"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
@@ -140,6 +141,22 @@ type ArchiveSnapshot struct {
 	PrevArchive string `json:"prev_archive,omitempty"`
 }
 
+// Canonical is the normalized JSON of the snapshot, the payload
+// that gets signed by its identity
+func (s *ArchiveSnapshot) Canonical() ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = jsoncanonicalizer.Transform(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to normalize archive json: %w", err)
+	}
+
+	return data, nil
+}
+
 type SignedArchiveSnapshot struct {
 	Archive   *ArchiveSnapshot `json:"archive"`
 	Signature string           `json:"signature,omitempty"`
@@ -149,6 +166,27 @@ type ArchiveMessage struct {
 	ArchiveCid string `json:"archive_cid"`
 }
 
+// ArchiveCodec encodes the archive messages as RLP
+type ArchiveCodec struct{}
+
+func (ArchiveCodec) Encode(payload interface{}) ([]byte, error) {
+	msg, ok := payload.(*ArchiveMessage)
+	if !ok {
+		return nil, fmt.Errorf("unsupported payload %T", payload)
+	}
+
+	return rlp.EncodeToBytes(msg)
+}
+
+func (ArchiveCodec) Decode(data []byte) (interface{}, error) {
+	var msg ArchiveMessage
+	if err := rlp.DecodeBytes(data, &msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
 type Archive struct {
 	lock sync.Mutex
 
@@ -224,12 +262,14 @@ func (a *Archive) Run(ctx context.Context) {
 		if err != nil {
 			a.Logger.Warn("archive: invalid message", "peer", peer)
 			a.Metrics.receivedInvalidArchive.With(a.Metrics.invalidArchiveBadMsgReason).Inc()
+			a.Host.ReportPeer(peer, p2p.PeerInvalidMessage)
 			return pubsub.ValidationReject
 		}
 
 		if !ipfs.IsCid(amsg.ArchiveCid) {
 			a.Logger.Warn("archive: invalid cid", "peer", peer, "cid", amsg.ArchiveCid)
 			a.Metrics.receivedInvalidArchive.With(a.Metrics.invalidArchiveBadCidReason).Inc()
+			a.Host.ReportPeer(peer, p2p.PeerInvalidMessage)
 			return pubsub.ValidationReject
 		}
 
@@ -245,6 +285,7 @@ func (a *Archive) Run(ctx context.Context) {
 
 		a.seenArchives[ps] = amsg.ArchiveCid
 		a.Logger.Info("archive: received archive", "peer", peer, "cid", amsg.ArchiveCid)
+		a.Host.ReportPeer(peer, p2p.PeerValidMessage)
 
 		return pubsub.ValidationAccept
 	})
@@ -312,18 +353,11 @@ func (a *Archive) doArchive(ctx context.Context, ops []string, force bool) error
 		PrevArchive:  a.PrevArchive,
 	}
 
-	// Convert to json
-	snapshotJson, err := json.Marshal(snapshot)
+	snapshotJson, err := snapshot.Canonical()
 	if err != nil {
 		return err
 	}
 
-	// Normalize
-	snapshotJson, err = jsoncanonicalizer.Transform(snapshotJson)
-	if err != nil {
-		return fmt.Errorf("unable to normalize archive json: %w", err)
-	}
-
 	sig, err := a.Host.Sign(snapshotJson)
 	if err != nil {
 		return err
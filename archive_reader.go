@@ -0,0 +1,227 @@
+package bundler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/0xsequence/bundler/ipfs"
+	"github.com/0xsequence/bundler/proto"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Verify checks that the identity of the snapshot signed it
+func (s *SignedArchiveSnapshot) Verify() error {
+	if s.Archive == nil {
+		return fmt.Errorf("%w: missing snapshot", ErrInvalidArchive)
+	}
+
+	id, err := peer.Decode(s.Archive.Identity)
+	if err != nil {
+		return fmt.Errorf("%w: invalid identity: %w", ErrInvalidArchive, err)
+	}
+
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("%w: unable to extract public key: %w", ErrInvalidArchive, err)
+	}
+
+	sig, err := hexutil.Decode(s.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid signature: %w", ErrInvalidArchive, err)
+	}
+
+	payload, err := s.Archive.Canonical()
+	if err != nil {
+		return err
+	}
+
+	ok, err := pub.Verify(payload, sig)
+	if err != nil || !ok {
+		return fmt.Errorf("%w: bad signature", ErrInvalidArchive)
+	}
+
+	return nil
+}
+
+// ParseArchive checks that the content of the cid is a canonical
+// and correctly signed archive snapshot
+func ParseArchive(cid string, data []byte) (*SignedArchiveSnapshot, error) {
+	expected, err := ipfs.Cid(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if expected != cid {
+		return nil, fmt.Errorf("%w: content does not match cid %s", ErrInvalidArchive, cid)
+	}
+
+	canonical, err := jsoncanonicalizer.Transform(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	if !bytes.Equal(canonical, data) {
+		return nil, fmt.Errorf("%w: json is not canonical", ErrInvalidArchive)
+	}
+
+	var snapshot SignedArchiveSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	if err := snapshot.Verify(); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+type ArchiveEntry struct {
+	Cid      string
+	Snapshot *ArchiveSnapshot
+}
+
+// ArchiveHistory is a verified chain of archives of a single identity
+type ArchiveHistory struct {
+	Identity string
+
+	// Newest first
+	Archives []*ArchiveEntry
+
+	// Every operation the identity claims to have handled
+	// in the archives of the chain, sorted
+	Operations []string
+
+	// The chain was followed to the first archive
+	Complete bool
+}
+
+func (h *ArchiveHistory) ToProto() *proto.ArchiveHistory {
+	archives := make([]*proto.ArchiveEntry, len(h.Archives))
+	for i, entry := range h.Archives {
+		archives[i] = &proto.ArchiveEntry{
+			Cid:          entry.Cid,
+			Timestamp:    entry.Snapshot.Timestamp,
+			Operations:   entry.Snapshot.Operations,
+			SeenArchives: entry.Snapshot.SeenArchives,
+			PrevArchive:  entry.Snapshot.PrevArchive,
+		}
+	}
+
+	return &proto.ArchiveHistory{
+		Identity:   h.Identity,
+		Archives:   archives,
+		Operations: h.Operations,
+		Complete:   h.Complete,
+	}
+}
+
+// ArchiveReader fetches archives from IPFS and verifies them
+type ArchiveReader struct {
+	ipfs ipfs.Interface
+}
+
+func NewArchiveReader(ipfs ipfs.Interface) *ArchiveReader {
+	return &ArchiveReader{ipfs: ipfs}
+}
+
+// Read fetches and verifies the archive
+func (r *ArchiveReader) Read(ctx context.Context, cid string) (*SignedArchiveSnapshot, error) {
+	if !ipfs.IsCid(cid) {
+		return nil, fmt.Errorf("invalid cid %q", cid)
+	}
+
+	data, err := r.ipfs.Fetch(ctx, cid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch archive %s: %w", cid, err)
+	}
+
+	return ParseArchive(cid, data)
+}
+
+// Walk follows the chain of archives from the cid, newest first, up to
+// depth archives, 0 follows it to the first one. All the archives must
+// be signed by the same identity and go back in time.
+func (r *ArchiveReader) Walk(ctx context.Context, cid string, depth int, fn func(cid string, snapshot *ArchiveSnapshot) error) error {
+	if depth < 0 {
+		return fmt.Errorf("invalid depth %d", depth)
+	}
+
+	var (
+		identity string
+		last     *ArchiveSnapshot
+	)
+
+	visited := make(map[string]struct{})
+	for i := 0; cid != "" && (depth == 0 || i < depth); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, ok := visited[cid]; ok {
+			return fmt.Errorf("%w: archive %s is linked twice", ErrInvalidArchive, cid)
+		}
+		visited[cid] = struct{}{}
+
+		signed, err := r.Read(ctx, cid)
+		if err != nil {
+			return err
+		}
+
+		snapshot := signed.Archive
+		if identity == "" {
+			identity = snapshot.Identity
+		} else if snapshot.Identity != identity {
+			return fmt.Errorf("%w: archive %s is signed by %s, not %s", ErrInvalidArchive, cid, snapshot.Identity, identity)
+		}
+
+		if last != nil && snapshot.Timestamp > last.Timestamp {
+			return fmt.Errorf("%w: archive %s is newer than the archive linking it", ErrInvalidArchive, cid)
+		}
+
+		if err := fn(cid, snapshot); err != nil {
+			return err
+		}
+
+		last = snapshot
+		cid = snapshot.PrevArchive
+	}
+
+	return nil
+}
+
+// History walks the chain of archives and rebuilds the
+// operations its identity claims to have handled
+func (r *ArchiveReader) History(ctx context.Context, cid string, depth int) (*ArchiveHistory, error) {
+	history := &ArchiveHistory{}
+	seen := make(map[string]struct{})
+
+	err := r.Walk(ctx, cid, depth, func(cid string, snapshot *ArchiveSnapshot) error {
+		history.Identity = snapshot.Identity
+		history.Archives = append(history.Archives, &ArchiveEntry{Cid: cid, Snapshot: snapshot})
+
+		for _, op := range snapshot.Operations {
+			if _, ok := seen[op]; !ok {
+				seen[op] = struct{}{}
+				history.Operations = append(history.Operations, op)
+			}
+		}
+
+		history.Complete = snapshot.PrevArchive == ""
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(history.Operations)
+	return history, nil
+}
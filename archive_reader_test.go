@@ -0,0 +1,201 @@
+package bundler_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/0xsequence/bundler"
+	"github.com/0xsequence/bundler/ipfs"
+	"github.com/0xsequence/bundler/lib/mocks"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type archiver struct {
+	t    *testing.T
+	priv crypto.PrivKey
+	id   peer.ID
+	ipfs *mocks.MockIPFS
+}
+
+func newArchiver(t *testing.T, mipfs *mocks.MockIPFS) *archiver {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	return &archiver{t: t, priv: priv, id: id, ipfs: mipfs}
+}
+
+// publish signs the snapshot like the archive does, and serves it
+func (a *archiver) publish(snapshot *bundler.ArchiveSnapshot) string {
+	payload, err := snapshot.Canonical()
+	require.NoError(a.t, err)
+	sig, err := a.priv.Sign(payload)
+	require.NoError(a.t, err)
+
+	body, err := json.Marshal(&bundler.SignedArchiveSnapshot{
+		Archive:   snapshot,
+		Signature: "0x" + common.Bytes2Hex(sig),
+	})
+	require.NoError(a.t, err)
+	body, err = jsoncanonicalizer.Transform(body)
+	require.NoError(a.t, err)
+
+	return a.serve(body)
+}
+
+func (a *archiver) serve(body []byte) string {
+	cid, err := ipfs.Cid(body)
+	require.NoError(a.t, err)
+
+	a.ipfs.On("Fetch", mock.Anything, cid).Return(body, nil)
+	return cid
+}
+
+func TestArchiveHistory(t *testing.T) {
+	mipfs := &mocks.MockIPFS{}
+	a := newArchiver(t, mipfs)
+	reader := bundler.NewArchiveReader(mipfs)
+	ctx := context.Background()
+
+	first := a.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    100,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{"0x02", "0x01"},
+	})
+	second := a.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    200,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{"other": first},
+		Operations:   []string{},
+		PrevArchive:  first,
+	})
+	third := a.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    300,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{"0x03", "0x01"},
+		PrevArchive:  second,
+	})
+
+	history, err := reader.History(ctx, third, 0)
+	require.NoError(t, err)
+	assert.Equal(t, a.id.String(), history.Identity)
+	assert.True(t, history.Complete)
+	assert.Equal(t, []string{"0x01", "0x02", "0x03"}, history.Operations)
+	require.Len(t, history.Archives, 3)
+	assert.Equal(t, third, history.Archives[0].Cid)
+	assert.Equal(t, first, history.Archives[2].Cid)
+	assert.Equal(t, map[string]string{"other": first}, history.Archives[1].Snapshot.SeenArchives)
+
+	// Only the last two archives
+	history, err = reader.History(ctx, third, 2)
+	require.NoError(t, err)
+	assert.False(t, history.Complete)
+	assert.Equal(t, []string{"0x01", "0x03"}, history.Operations)
+	assert.Len(t, history.Archives, 2)
+
+	_, err = reader.History(ctx, third, -1)
+	assert.Error(t, err)
+
+	pb := history.ToProto()
+	assert.Equal(t, second, pb.Archives[0].PrevArchive)
+	assert.Equal(t, uint64(300), pb.Archives[0].Timestamp)
+}
+
+func TestArchiveVerification(t *testing.T) {
+	mipfs := &mocks.MockIPFS{}
+	a := newArchiver(t, mipfs)
+	b := newArchiver(t, mipfs)
+	reader := bundler.NewArchiveReader(mipfs)
+	ctx := context.Background()
+
+	valid := a.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    100,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{"0x01"},
+	})
+
+	signed, err := reader.Read(ctx, valid)
+	require.NoError(t, err)
+	assert.NoError(t, signed.Verify())
+
+	// Signed by someone else than the identity it claims
+	forged := b.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    100,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{"0x01", "0x02"},
+	})
+	_, err = reader.Read(ctx, forged)
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+
+	// Operations added after signing
+	signed.Archive.Operations = append(signed.Archive.Operations, "0x02")
+	body, err := json.Marshal(signed)
+	require.NoError(t, err)
+	body, err = jsoncanonicalizer.Transform(body)
+	require.NoError(t, err)
+	_, err = reader.Read(ctx, a.serve(body))
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+
+	// The same archive, but not canonical
+	original, err := mipfs.Fetch(ctx, valid)
+	require.NoError(t, err)
+	var indented map[string]interface{}
+	require.NoError(t, json.Unmarshal(original, &indented))
+	body, err = json.MarshalIndent(indented, "", "  ")
+	require.NoError(t, err)
+	_, err = reader.Read(ctx, a.serve(body))
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+
+	// Content that doesn't match the cid
+	_, err = bundler.ParseArchive(forged, original)
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+
+	// Even when it is large
+	large := a.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    100,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{strings.Repeat("0x01", 128<<10)},
+	})
+	largeBody, err := mipfs.Fetch(ctx, large)
+	require.NoError(t, err)
+	_, err = bundler.ParseArchive(large, largeBody)
+	assert.NoError(t, err)
+	_, err = bundler.ParseArchive(forged, largeBody)
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+
+	// A chain can't change identity
+	next := b.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    200,
+		Identity:     b.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{},
+		PrevArchive:  valid,
+	})
+	_, err = reader.History(ctx, next, 0)
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+
+	// Or go forward in time
+	older := a.publish(&bundler.ArchiveSnapshot{
+		Timestamp:    50,
+		Identity:     a.id.String(),
+		SeenArchives: map[string]string{},
+		Operations:   []string{},
+		PrevArchive:  valid,
+	})
+	_, err = reader.History(ctx, older, 0)
+	assert.ErrorIs(t, err, bundler.ErrInvalidArchive)
+}
@@ -107,6 +107,7 @@ func TestListenArchives(t *testing.T) {
 	ad := &bundler.ArchiveMessage{ArchiveCid: cid}
 	data, err := json.Marshal(ad)
 	assert.Nil(t, err)
+	host.On("ReportPeer", peer.ID("123"), p2p.PeerValidMessage).Once()
 	handler(ctx, peer.ID("123"), data)
 
 	for len(archive.SeenArchives()) == 0 {
@@ -240,3 +241,18 @@ func TestRunArchiver(t *testing.T) {
 	host.AssertExpectations(t)
 	mipfs.AssertExpectations(t)
 }
+
+func TestArchiveCodec(t *testing.T) {
+	codec := bundler.ArchiveCodec{}
+
+	msg := &bundler.ArchiveMessage{ArchiveCid: "bafkreibuoggjkm6bqoycp3ipl7aifamisimrhn5xpk3x4kmfjitsufekky"}
+	data, err := codec.Encode(msg)
+	assert.NoError(t, err)
+
+	decoded, err := codec.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, decoded)
+
+	_, err = codec.Encode("not a message")
+	assert.Error(t, err)
+}
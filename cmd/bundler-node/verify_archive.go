@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/0xsequence/bundler"
+	"github.com/0xsequence/bundler/ipfs"
+	"github.com/spf13/cobra"
+)
+
+var verifyArchiveCmd = &cobra.Command{
+	Use:   "verify-archive <cid>",
+	Short: "verify an archive and the chain of archives before it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The IPFS url of the config is used unless one is given
+		if ipfsUrl == "" {
+			if err := initConfig(); err != nil {
+				return err
+			}
+			ipfsUrl = cfg.NetworkConfig.IPFSUrl
+		}
+
+		if ipfsUrl == "" {
+			return fmt.Errorf("ipfs url not set")
+		}
+
+		reader := bundler.NewArchiveReader(ipfs.NewClient(nil, ipfsUrl))
+		history, err := reader.History(context.Background(), args[0], archiveDepth)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(history.ToProto())
+	},
+}
+
+var (
+	ipfsUrl      string
+	archiveDepth int
+)
+
+func init() {
+	verifyArchiveCmd.Flags().StringVar(&ipfsUrl, "ipfs-url", "", "ipfs api url, defaults to the one in the config")
+	verifyArchiveCmd.Flags().IntVar(&archiveDepth, "depth", 0, "number of archives to follow, 0 follows the chain to the first one")
+
+	rootCmd.AddCommand(verifyArchiveCmd)
+}
@@ -44,9 +44,38 @@ type NetworkConfig struct {
 	RpcUrl  string `toml:"rpc_url"`
 	IPFSUrl string `toml:"ipfs_url"`
 
+	// Multiple rpc endpoints, takes precedence over rpc_url
+	RpcUrls []RpcEndpoint `toml:"rpc_urls"`
+
+	HealthCheckSeconds     uint `toml:"rpc_health_check"`
+	BreakerFailures        uint `toml:"rpc_breaker_failures"`
+	BreakerCooldownSeconds uint `toml:"rpc_breaker_cooldown"`
+	// Blocks an endpoint can be behind the others before it is
+	// considered unhealthy, 0 disables it
+	MaxBlockLag uint `toml:"rpc_max_block_lag"`
+
 	ValidatorContract string `toml:"validator_contract"`
 }
 
+type RpcEndpoint struct {
+	Url string `toml:"url"`
+	// Share of the requests sent to the endpoint,
+	// endpoints with weight 0 are only used as backups
+	Weight uint `toml:"weight"`
+}
+
+func (c *NetworkConfig) Endpoints() []RpcEndpoint {
+	if len(c.RpcUrls) != 0 {
+		return c.RpcUrls
+	}
+
+	if c.RpcUrl == "" {
+		return nil
+	}
+
+	return []RpcEndpoint{{Url: c.RpcUrl, Weight: 1}}
+}
+
 type LinearCalldataModel struct {
 	FixedCost       uint64 `toml:"fixed_cost"`
 	ZeroByteCost    uint64 `toml:"zero_byte_cost"`
@@ -60,24 +89,108 @@ type P2PHostConfig struct {
 	PriorityNodes     []string              `toml:"priority_nodes"`
 	BootNodeAddrs     []multiaddr.Multiaddr `toml:"-"`
 	PriorityNodeAddrs []multiaddr.Multiaddr `toml:"-"`
+
+	// Peers whose score falls below the threshold are disconnected
+	// and blacklisted for the duration, 0 uses the defaults
+	ScoreBlacklistThreshold float64 `toml:"score_blacklist_threshold"`
+	ScoreBlacklistSeconds   uint    `toml:"score_blacklist_duration"`
+
+	// Broadcast signed announcements instead of bare operations, only
+	// once every peer of the network understands the new format
+	SignedAnnouncements bool `toml:"signed_announcements"`
+
+	// Encodings used on the pubsub topics, every encoding is a separate
+	// subtopic, empty uses both the binary encoding and JSON
+	Encodings []string `toml:"encodings"`
+
+	// Private networks only talk to peers with the same pre-shared key,
+	// 32 bytes in hex, and refuse the peers that are not in AllowedPeers,
+	// boot and priority nodes are always allowed
+	PrivateNetworkKey string   `toml:"private_network_key"`
+	AllowedPeers      []string `toml:"allowed_peers"`
+
+	// Only connect to the boot and priority nodes, without the DHT
+	DisableDHT bool `toml:"disable_dht"`
+
+	// Addresses announced to peers instead of the listen
+	// addresses, for nodes behind NAT or in containers
+	AnnounceAddrs      []string              `toml:"announce_addrs"`
+	AnnounceMultiaddrs []multiaddr.Multiaddr `toml:"-"`
+
+	// Circuit relay v2, the client reaches and is reached through relays,
+	// the service relays for others, static relays are used by AutoRelay
+	RelayClient      bool                  `toml:"relay_client"`
+	RelayService     bool                  `toml:"relay_service"`
+	StaticRelays     []string              `toml:"static_relays"`
+	StaticRelayAddrs []multiaddr.Multiaddr `toml:"-"`
+
+	// Also listen for websocket connections on this port, 0 disables it
+	WebsocketPort int `toml:"websocket_port"`
+
+	// Connection manager watermarks, 0 uses the defaults
+	ConnLowWater  int `toml:"conn_low_water"`
+	ConnHighWater int `toml:"conn_high_water"`
+
+	// Per peer rate limits of the messages on each pubsub topic
+	OperationRateLimit RateLimitConfig `toml:"operation_rate_limit"`
+	ArchiveRateLimit   RateLimitConfig `toml:"archive_rate_limit"`
+}
+
+// RateLimitConfig limits what a peer can publish on a topic, in messages
+// and bytes per second. 0 uses the default, a negative value disables
+// the limit. Priority peers use their own limits when they are set.
+type RateLimitConfig struct {
+	Ops           float64 `toml:"ops"`
+	Bytes         float64 `toml:"bytes"`
+	PriorityOps   float64 `toml:"priority_ops"`
+	PriorityBytes float64 `toml:"priority_bytes"`
 }
 
 type MempoolConfig struct {
-	Size        uint `toml:"max_size"`
-	IngressSize uint `toml:"max_ingress_size"`
+	Size uint `toml:"max_size"`
+
+	// Operations received from peers wait in a queue of IngressSize
+	// for one of the IngressWorkers to validate them, 0 uses the defaults
+	IngressSize    uint `toml:"max_ingress_size"`
+	IngressWorkers uint `toml:"ingress_workers"`
+
+	// Peers asked for the operations we are missing on startup, besides
+	// the priority peers, and how often to ask again, 0 only syncs once
+	SyncPeers           uint `toml:"sync_peers"`
+	SyncIntervalSeconds uint `toml:"sync_interval"`
 
 	OverlapLimit  uint `toml:"overlap_limit"`
 	WildcardLimit uint `toml:"wildcard_limit"`
 
 	MaxEndorserGasLimit uint `toml:"max_endorser_gas_limit"`
+
+	// Number of endorser results cached, 0 uses the default
+	EndorserCacheSize uint `toml:"endorser_cache_size"`
+
+	// Failures (reverts, malformed results, out of gas) in excess of successes
+	// before temporarily banning an endorser, 0 disables it
+	MaxEndorserFailures uint `toml:"max_endorser_failures"`
+
+	MaxOperationAgeSeconds uint             `toml:"max_operation_age"`
+	EndorserMaxAges        []EndorserMaxAge `toml:"endorser_max_ages"`
+}
+
+type EndorserMaxAge struct {
+	Address       string `toml:"address"`
+	MaxAgeSeconds uint   `toml:"max_age"`
 }
 
 type PrunerConfig struct {
 	GracePeriodSeconds int `toml:"grace_period"`
 	RunWaitMillis      int `toml:"run_wait_millis"`
 
+	MaxFailures          int `toml:"max_failures"`
+	MaxRetries           int `toml:"max_retries"`
+	FailureBackoffMillis int `toml:"failure_backoff_millis"`
+
 	NoStalePruning  bool `toml:"no_stale_pruning"`
 	NoBannedPruning bool `toml:"no_banned_pruning"`
+	NoBlockPruning  bool `toml:"no_block_pruning"`
 }
 
 type SendersConfig struct {
@@ -118,12 +231,23 @@ type RegistryConfig struct {
 	MinReputation  float64 `toml:"min_reputation"`
 	TempBanSeconds int     `toml:"temp_ban_duration"`
 
+	// Endorsers that use more gas than this on average are
+	// temporarily banned, 0 disables it
+	MaxAverageGas uint64 `toml:"max_average_gas"`
+	// Number of calls averaged before judging the gas usage of an endorser
+	GasSamples uint `toml:"gas_samples"`
+
 	Sources []RegistrySource `toml:"sources"`
 	Trusted []string         `toml:"trusted"`
 }
 
 type DebuggerConfig struct {
 	Mode string `toml:"mode"`
+
+	PoolSize            uint `toml:"pool_size"`
+	HealthCheckInterval uint `toml:"health_check_interval"`
+
+	Tracer string `toml:"tracer"`
 }
 
 type RegistrySource struct {
@@ -174,5 +298,25 @@ func InitP2PHostConfig(cfg *P2PHostConfig) error {
 	}
 	cfg.PriorityNodeAddrs = priorityNodeAddrs
 
+	announceAddrs := make([]multiaddr.Multiaddr, 0, len(cfg.AnnounceAddrs))
+	for _, s := range cfg.AnnounceAddrs {
+		addr, err := multiaddr.NewMultiaddr(s)
+		if err != nil {
+			return err
+		}
+		announceAddrs = append(announceAddrs, addr)
+	}
+	cfg.AnnounceMultiaddrs = announceAddrs
+
+	staticRelayAddrs := make([]multiaddr.Multiaddr, 0, len(cfg.StaticRelays))
+	for _, s := range cfg.StaticRelays {
+		addr, err := multiaddr.NewMultiaddr(s)
+		if err != nil {
+			return err
+		}
+		staticRelayAddrs = append(staticRelayAddrs, addr)
+	}
+	cfg.StaticRelayAddrs = staticRelayAddrs
+
 	return nil
 }
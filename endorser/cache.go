@@ -0,0 +1,169 @@
+package endorser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/go-chi/httplog/v2"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const DefaultCacheSize = 4096
+
+// cacheKey is an operation and the fingerprint of the
+// values of its dependencies when the endorser was called
+type cacheKey struct {
+	op    string
+	state string
+}
+
+type knownState struct {
+	result *EndorserResult
+	state  *EndorserResultState
+}
+
+type knownStateKey struct{}
+
+// WithDependencyState passes the state of the dependencies of the
+// previous result of the operation to IsOperationReady, the cache
+// uses it instead of reading the state again
+func WithDependencyState(ctx context.Context, result *EndorserResult, state *EndorserResultState) context.Context {
+	return context.WithValue(ctx, knownStateKey{}, &knownState{result: result, state: state})
+}
+
+// CachedEndorser reuses the result of isOperationReady for an operation
+// as long as the state it depends on has the same values, so checking
+// the same operation again only costs reading its dependencies.
+type CachedEndorser struct {
+	Interface
+
+	logger  *httplog.Logger
+	metrics *cacheMetrics
+
+	// The last result of every operation, to know which state to read
+	dependencies *lru.Cache[string, *EndorserResult]
+	results      *lru.Cache[cacheKey, *EndorserResult]
+}
+
+var _ Interface = (*CachedEndorser)(nil)
+
+func NewCachedEndorser(logger *httplog.Logger, metrics prometheus.Registerer, endorser Interface, size int) (*CachedEndorser, error) {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	c := &CachedEndorser{
+		Interface: endorser,
+
+		logger:  logger,
+		metrics: createCacheMetrics(metrics),
+	}
+
+	dependencies, err := lru.New[string, *EndorserResult](size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create endorser cache: %w", err)
+	}
+
+	results, err := lru.NewWithEvict(size, func(cacheKey, *EndorserResult) {
+		c.metrics.evictions.Inc()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create endorser cache: %w", err)
+	}
+
+	c.dependencies = dependencies
+	c.results = results
+	return c, nil
+}
+
+func (c *CachedEndorser) IsOperationReady(ctx context.Context, op *types.Operation) (*EndorserResult, error) {
+	hash := op.Hash()
+
+	// The state is read before calling the endorser, if it changes
+	// during the call the result is cached under the older state
+	// and it is not reused once the newer state is read
+	prev, key := c.lookupKey(ctx, hash)
+	if key.state != "" {
+		if cached, ok := c.results.Get(key); ok {
+			c.metrics.hits.Inc()
+
+			// The endorser was not called, no gas was used
+			res := *cached
+			res.GasUsed = 0
+			return &res, nil
+		}
+
+		c.metrics.stale.Inc()
+	}
+
+	c.metrics.misses.Inc()
+
+	res, err := c.Interface.IsOperationReady(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wildcard results can't tell if the state has changed
+	if res.WildcardOnly {
+		return res, nil
+	}
+
+	c.dependencies.Add(hash, res)
+
+	// The state only covers the result if it has the same dependencies
+	if key.state != "" && sameDependencies(prev, res) {
+		c.results.Add(key, res)
+		c.metrics.size.Set(float64(c.results.Len()))
+	}
+
+	return res, nil
+}
+
+// lookupKey returns the previous result of the operation and the key of
+// the current state of its dependencies, the key is empty if the state
+// is unknown
+func (c *CachedEndorser) lookupKey(ctx context.Context, hash string) (*EndorserResult, cacheKey) {
+	if known, ok := ctx.Value(knownStateKey{}).(*knownState); ok && known.result != nil && known.state != nil {
+		return known.result, c.key(hash, known.result, known.state)
+	}
+
+	prev, ok := c.dependencies.Get(hash)
+	if !ok {
+		return nil, cacheKey{}
+	}
+
+	state, err := c.Interface.DependencyState(ctx, prev)
+	if err != nil {
+		c.logger.Debug("endorser cache: unable to read dependency state", "op", hash, "error", err)
+		return prev, cacheKey{}
+	}
+
+	return prev, c.key(hash, prev, state)
+}
+
+func (c *CachedEndorser) key(hash string, result *EndorserResult, state *EndorserResultState) cacheKey {
+	// The values of the state don't say which slots they belong to,
+	// so the dependencies are part of the fingerprint
+	data, err := json.Marshal(struct {
+		GlobalDependency GlobalDependency
+		Dependencies     []Dependency
+		State            *EndorserResultState
+	}{result.GlobalDependency, result.Dependencies, state})
+	if err != nil {
+		c.logger.Debug("endorser cache: unable to fingerprint dependency state", "op", hash, "error", err)
+		return cacheKey{}
+	}
+
+	sum := sha256.Sum256(data)
+	return cacheKey{op: hash, state: hex.EncodeToString(sum[:])}
+}
+
+func sameDependencies(a *EndorserResult, b *EndorserResult) bool {
+	return reflect.DeepEqual(a.GlobalDependency, b.GlobalDependency) && reflect.DeepEqual(a.Dependencies, b.Dependencies)
+}
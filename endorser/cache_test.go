@@ -0,0 +1,101 @@
+package endorser_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/0xsequence/bundler/lib/mocks"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/go-chi/httplog/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCachedEndorser(t *testing.T) {
+	inner := &mocks.MockEndorser{}
+	c, err := endorser.NewCachedEndorser(httplog.NewLogger(""), nil, inner, 2)
+	assert.NoError(t, err)
+
+	addr := common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+	op := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{Data: []byte{1}},
+	}
+
+	result := &endorser.EndorserResult{
+		Readiness:    true,
+		Dependencies: []endorser.Dependency{{Addr: addr, Balance: true}},
+		GasUsed:      21000,
+	}
+
+	state := func(balance int64) *endorser.EndorserResultState {
+		return &endorser.EndorserResultState{
+			AddrDependencies: map[common.Address]*endorser.AddrDependencyState{
+				addr: {Balance: big.NewInt(balance)},
+			},
+		}
+	}
+
+	ctx := context.Background()
+
+	// Nothing is known about the operation, no state is read
+	inner.On("IsOperationReady", mock.Anything, op).Return(result, nil).Twice()
+
+	res, err := c.IsOperationReady(ctx, op)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21000), res.GasUsed)
+	inner.AssertNotCalled(t, "DependencyState", mock.Anything, mock.Anything)
+
+	// The state is read before calling the endorser again,
+	// the result is cached under that state
+	inner.On("DependencyState", mock.Anything, result).Return(state(1), nil).Twice()
+
+	_, err = c.IsOperationReady(ctx, op)
+	assert.NoError(t, err)
+
+	// Same state, the result is reused
+	res, err = c.IsOperationReady(ctx, op)
+	assert.NoError(t, err)
+	assert.True(t, res.Readiness)
+	assert.Equal(t, uint64(0), res.GasUsed)
+
+	// A state read by the caller is used as is
+	inner.On("IsOperationReady", mock.Anything, op).Return(result, nil).Once()
+
+	_, err = c.IsOperationReady(endorser.WithDependencyState(ctx, result, state(2)), op)
+	assert.NoError(t, err)
+
+	res, err = c.IsOperationReady(endorser.WithDependencyState(ctx, result, state(1)), op)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), res.GasUsed)
+
+	inner.AssertExpectations(t)
+	inner.AssertNumberOfCalls(t, "IsOperationReady", 3)
+	inner.AssertNumberOfCalls(t, "DependencyState", 2)
+}
+
+func TestCachedEndorserWildcard(t *testing.T) {
+	inner := &mocks.MockEndorser{}
+	c, err := endorser.NewCachedEndorser(httplog.NewLogger(""), nil, inner, 2)
+	assert.NoError(t, err)
+
+	op := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{Data: []byte{1}},
+	}
+
+	// Wildcard results are never cached
+	result := &endorser.EndorserResult{Readiness: true, WildcardOnly: true}
+	inner.On("IsOperationReady", mock.Anything, op).Return(result, nil).Twice()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := c.IsOperationReady(ctx, op)
+		assert.NoError(t, err)
+	}
+
+	inner.AssertExpectations(t)
+	inner.AssertNotCalled(t, "DependencyState", mock.Anything, mock.Anything)
+}
@@ -2,9 +2,9 @@ package endorser
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
-	"strings"
 	"time"
 
 	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
@@ -16,9 +16,9 @@ import (
 	"github.com/0xsequence/ethkit/go-ethereum/accounts/abi"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
 	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
 	"github.com/go-chi/httplog/v2"
 	"github.com/prometheus/client_golang/prometheus"
-	"golang.org/x/sync/errgroup"
 )
 
 var parsedEndorserABI *abi.ABI
@@ -33,45 +33,51 @@ func useEndorserAbi() *abi.ABI {
 	return parsedEndorserABI
 }
 
-type rpcError struct {
-	Err error
-}
-
-func (re *rpcError) Error() string {
-	return re.Err.Error()
-}
-
-type rejectedError struct {
-	Err    error
-	Reason string
-}
-
-func (re *rejectedError) Error() string {
-	return fmt.Sprintf("rejected: %s", re.Reason)
-}
+// Caller of the simulations, it is the tx.origin seen by the endorser
+var simulationCaller = common.HexToAddress("0xFD095316B59e6224dC84f83E68F9603A684AD8df")
 
 type Endorser struct {
 	parsedEndorserABI *abi.ABI
 	logger            *httplog.Logger
 	metrics           *metrics
+	gasSampler        *gasSampler
 
 	Debugger debugger.Interface
 	Provider *provider.Batched
+
+	// Upper bound of the gas given to the endorser, 0 means no bound
+	MaxGasLimit uint64
 }
 
 var _ Interface = (*Endorser)(nil)
 
-func NewEndorser(logger *httplog.Logger, metrics prometheus.Registerer, provider *provider.Batched, debugger debugger.Interface) *Endorser {
+func NewEndorser(logger *httplog.Logger, metrics prometheus.Registerer, provider *provider.Batched, debugger debugger.Interface, maxGasLimit uint64) *Endorser {
 	return &Endorser{
 		parsedEndorserABI: useEndorserAbi(),
 
-		logger:   logger,
-		metrics:  createMetrics(metrics),
-		Debugger: debugger,
-		Provider: provider,
+		logger:      logger,
+		metrics:     createMetrics(metrics),
+		gasSampler:  newGasSampler(),
+		Debugger:    debugger,
+		Provider:    provider,
+		MaxGasLimit: maxGasLimit,
 	}
 }
 
+// CallGas is the gas given to the endorser when checking the operation,
+// the limit declared by the operation capped by MaxGasLimit, operations
+// that declare no limit get MaxGasLimit
+func (e *Endorser) CallGas(op *types.Operation) uint64 {
+	gas := e.MaxGasLimit
+	if op.EndorserGasLimit != nil && op.EndorserGasLimit.IsUint64() {
+		if limit := op.EndorserGasLimit.Uint64(); limit != 0 && (gas == 0 || limit < gas) {
+			gas = limit
+		}
+	}
+
+	return gas
+}
+
 // SimulationSettings
 
 func (e *Endorser) parseSimulationSettingsRes(res string) ([]*SimulationSetting, error) {
@@ -316,34 +322,32 @@ func (e *Endorser) isOperationReadyCall(ctx context.Context, op *types.Operation
 	}
 
 	endorserCall := &struct {
-		To   common.Address `json:"to"`
-		Data string         `json:"data"`
+		To   common.Address  `json:"to"`
+		Data string          `json:"data"`
+		Gas  *hexutil.Uint64 `json:"gas,omitempty"`
 	}{
 		To:   to,
 		Data: data,
 	}
 
+	if gas := e.CallGas(op); gas != 0 {
+		callGas := hexutil.Uint64(gas)
+		endorserCall.Gas = &callGas
+	}
+
 	var res string
 	// Some RPC providers may not support the debugOverrideArgs
 	rpcCall := ethrpc.NewCallBuilder[string]("eth_call", nil, endorserCall, "latest", debugOverrideArgs)
 	_, err = e.Provider.Do(ctx, rpcCall.Into(&res))
 	if err != nil {
 		e.metrics.isOperationReadyError.Inc()
-		if strings.Contains(err.Error(), "execution reverted") {
-			reason := err.Error()
-			reason = strings.TrimPrefix(reason, "jsonrpc error 3: ")
-			reason = strings.TrimPrefix(reason, "execution reverted: ")
-			reason = strings.TrimPrefix(reason, "reverted: ")
-			return nil, &rejectedError{Err: err, Reason: reason}
-		}
-
-		return nil, &rpcError{Err: err}
+		return nil, callError(err)
 	}
 
 	endorserResult, err := e.parseIsOperationReadyRes(res)
 	if err != nil {
 		e.metrics.isOperationReadyReverts.Inc()
-		return nil, fmt.Errorf("unable to parse isOperationReady result: %w", err)
+		return nil, &MalformedResultError{Err: fmt.Errorf("unable to parse isOperationReady result: %w", err)}
 	}
 
 	// NOTICE: Untrusted context operations should be handled
@@ -356,6 +360,13 @@ func (e *Endorser) isOperationReadyCall(ctx context.Context, op *types.Operation
 
 	if endorserResult.Readiness {
 		e.metrics.isOperationReadyTrue.Inc()
+
+		// The call doesn't report the gas it used, the registry needs it
+		// to rate the endorser, but estimating it is expensive, so only
+		// some of the checks of every endorser are sampled
+		if e.gasSampler.sample(op.Endorser) {
+			endorserResult.GasUsed = e.estimateGas(ctx, endorserCall, debugOverrideArgs)
+		}
 	} else {
 		e.metrics.isOperationReadyFalse.Inc()
 	}
@@ -367,6 +378,25 @@ func (e *Endorser) isOperationReadyCall(ctx context.Context, op *types.Operation
 	return endorserResult, nil
 }
 
+// estimateGas returns the gas used by the call, or 0 if the provider
+// can't estimate it, the result of the call is already known so
+// errors are not reported
+func (e *Endorser) estimateGas(ctx context.Context, call any, overrides *debugger.DebugOverrideArgs) uint64 {
+	params := []any{call, "latest"}
+	if overrides != nil && len(*overrides) != 0 {
+		params = append(params, overrides)
+	}
+
+	var gas hexutil.Uint64
+	rpcCall := ethrpc.NewCallBuilder[hexutil.Uint64]("eth_estimateGas", nil, params...)
+	if _, err := e.Provider.Do(ctx, rpcCall.Into(&gas)); err != nil {
+		e.logger.Debug("endorser: unable to estimate gas", "error", err)
+		return 0
+	}
+
+	return uint64(gas)
+}
+
 func (e *Endorser) isOperationReadyDebugger(ctx context.Context, op *types.Operation) (*EndorserResult, error) {
 	start := time.Now()
 
@@ -388,14 +418,19 @@ func (e *Endorser) isOperationReadyDebugger(ctx context.Context, op *types.Opera
 	// Use random caller
 	// NOTICE: This is a temporary solution
 	debugCallArgs := &debugger.DebugCallArgs{
-		From: common.HexToAddress("0xFD095316B59e6224dC84f83E68F9603A684AD8df"),
+		From: simulationCaller,
 		To:   to,
 		Data: common.FromHex(data),
+		Gas:  e.CallGas(op),
 	}
 
 	trace, err := e.Debugger.DebugTraceCall(ctx, debugCallArgs, debugOverrideArgs)
 	if err != nil {
-		return nil, fmt.Errorf("unable to trace call: %w", err)
+		return nil, &ProviderError{Err: fmt.Errorf("unable to trace call: %w", err)}
+	}
+
+	if trace.Failed {
+		return nil, traceError(trace)
 	}
 	// Log the trace
 	for _, log := range trace.StructLogs {
@@ -407,7 +442,7 @@ func (e *Endorser) isOperationReadyDebugger(ctx context.Context, op *types.Opera
 
 	er1, err := e.parseIsOperationReadyRes(trace.ReturnValue)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse isOperationReady debugger result: %w", err)
+		return nil, &MalformedResultError{Err: fmt.Errorf("unable to parse isOperationReady debugger result: %w", err)}
 	}
 
 	// Generate dependencies from untrusted context
@@ -417,6 +452,7 @@ func (e *Endorser) isOperationReadyDebugger(ctx context.Context, op *types.Opera
 	}
 
 	merged := er1.Or(er2)
+	merged.GasUsed = uint64(trace.Gas)
 
 	e.metrics.isOperationDebugReadyDuration.Observe(time.Since(start).Seconds())
 	egl, _ := op.EndorserGasLimit.Float64()
@@ -444,7 +480,7 @@ func (e *Endorser) simulateCall(ctx context.Context, op *types.Operation) (*Endo
 	_, err := e.Provider.Do(ctx, rpcCall.Into(&res))
 	if err != nil {
 		e.metrics.failoverSimulationError.Inc()
-		return nil, fmt.Errorf("unable to simulate call: %w", err)
+		return nil, callError(fmt.Errorf("unable to simulate call: %w", err))
 	}
 	e.metrics.failoverSimulationSuccess.Inc()
 
@@ -465,14 +501,17 @@ func (e *Endorser) simulateCall(ctx context.Context, op *types.Operation) (*Endo
 
 func (e *Endorser) IsOperationReady(ctx context.Context, op *types.Operation) (*EndorserResult, error) {
 	if e.Debugger != nil && op.HasUntrustedContext {
-		// TODO: Sometimes the endorser reverts instead of failing,
-		// we should have a different sort of error for these, or else
-		// we will have to verify them twice.
 		res, err := e.isOperationReadyDebugger(ctx, op)
 		if err == nil {
 			return res, nil
 		}
 
+		// The endorser itself failed, calling it
+		// again without the debugger won't help
+		if errors.Is(err, ErrReverted) || errors.Is(err, ErrOutOfGas) || errors.Is(err, ErrMalformedResult) {
+			return nil, err
+		}
+
 		e.metrics.isOperationReadyDebuggerFailed.Inc()
 		e.logger.Warn("unable to use debugger, falling back to eth_call and ignoring untrusted context", "error", err)
 	}
@@ -480,8 +519,7 @@ func (e *Endorser) IsOperationReady(ctx context.Context, op *types.Operation) (*
 	// Use eth_call
 	res, err := e.isOperationReadyCall(ctx, op)
 	if err != nil {
-		_, ok := err.(*rpcError)
-		if ok {
+		if errors.Is(err, ErrProvider) {
 			// Fail over to pure calldata simulation
 			e.logger.Warn("unable to use endorser, falling back to call simulation and ignoring dependencies", "error", err)
 			return e.simulateCall(ctx, op)
@@ -494,152 +532,249 @@ func (e *Endorser) IsOperationReady(ctx context.Context, op *types.Operation) (*
 }
 
 func (e *Endorser) SingleDependencyState(ctx context.Context, dep abiendorser.IEndorserDependency) (*AddrDependencyState, error) {
-	balance := make(chan *big.Int, 1)
-	code := make(chan int, 1)
-	nonce := make(chan uint64, 1)
-	slots := make(chan [][32]byte, 1)
-
-	defer func() {
-		close(balance)
-		close(nonce)
-		close(code)
-		close(slots)
-	}()
-
-	eg, ctx := errgroup.WithContext(ctx)
-
-	if dep.Balance {
-		eg.Go(func() error {
-			b, err := e.Provider.BalanceAt(ctx, dep.Addr, nil)
-			if err != nil {
-				return fmt.Errorf("unable to read balance for %v: %w", dep.Addr, err)
-			}
-
-			balance <- b
-			return nil
-		})
+	state, err := e.readState(ctx, &EndorserResult{Dependencies: []Dependency{dep}}, true)
+	if err != nil {
+		return nil, err
 	}
 
-	if dep.Code {
-		eg.Go(func() error {
-			c, err := e.Provider.CodeAt(ctx, dep.Addr, nil)
-			if err != nil {
-				return fmt.Errorf("unable to read code for %v: %w", dep.Addr, err)
-			}
+	return state.AddrDependencies[dep.Addr], nil
+}
 
-			code <- len(c)
-			return nil
-		})
+func (e *Endorser) GlobalDependencyState(ctx context.Context, dep *GlobalDependency) (*GlobalDependencyState, error) {
+	head, err := e.Provider.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read head block: %w", err)
 	}
 
-	if dep.Nonce {
-		eg.Go(func() error {
-			n, err := e.Provider.NonceAt(ctx, dep.Addr, nil)
-			if err != nil {
-				return fmt.Errorf("unable to read nonce for %v: %w", dep.Addr, err)
-			}
+	return e.globalState(ctx, dep, head)
+}
 
-			nonce <- n
-			return nil
-		})
+// globalState builds the global state from the head block,
+// the chain id is memoized by the provider
+func (e *Endorser) globalState(ctx context.Context, dep *GlobalDependency, head *ethtypes.Header) (*GlobalDependencyState, error) {
+	if head == nil {
+		return nil, fmt.Errorf("unable to read head block: not found")
 	}
 
-	if len(dep.Slots) > 0 {
-		eg.Go(func() error {
-			s, err := e.Provider.StorageAtBatch(ctx, dep.Addr, dep.Slots)
-			if err != nil {
-				return fmt.Errorf("unable to read storage for %v: %w", dep.Addr, err)
-			}
+	state := &GlobalDependencyState{
+		Basefee:    head.BaseFee,
+		Coinbase:   head.Coinbase,
+		Difficulty: head.Difficulty,
+		GasLimit:   new(big.Int).SetUint64(head.GasLimit),
+		Number:     head.Number,
+		Timestamp:  new(big.Int).SetUint64(head.Time),
 
-			slots <- s
-			return nil
-		})
+		// The simulations always run with the same
+		// caller and with a zero gas price
+		TxOrigin:   simulationCaller,
+		TxGasPrice: new(big.Int),
 	}
 
-	err := eg.Wait()
-	if err != nil {
-		return nil, err
+	// After the merge DIFFICULTY returns the prevrandao
+	if head.Difficulty == nil || head.Difficulty.Sign() == 0 {
+		state.Difficulty = new(big.Int).SetBytes(head.MixDigest[:])
 	}
 
-	state := &AddrDependencyState{}
-
-	for {
-		select {
-		case b := <-balance:
-			state.Balance = b
-		case n := <-nonce:
-			state.Nonce = &n
-		case c := <-code:
-			state.Code = &c
-		case s := <-slots:
-			state.Slots = s
-		default:
-			return state, nil
+	// The blob base fee is not part of the header, leaving
+	// it unknown makes any dependency on it always change
+
+	if dep.ChainId {
+		chainID, err := e.Provider.ChainID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read chain id: %w", err)
 		}
+
+		state.Chainid = chainID
 	}
+
+	return state, nil
 }
 
+// DependencyState reads the state of the dependencies of the result,
+// the constrained slots are read too, so the constraints can be checked
+// on the same state
 func (e *Endorser) DependencyState(ctx context.Context, result *EndorserResult) (*EndorserResultState, error) {
-	type SingleDependencyStateResult struct {
-		Addr common.Address
-		Res  *AddrDependencyState
-	}
+	return e.readState(ctx, result, true)
+}
 
-	deps := make(chan *SingleDependencyStateResult, len(result.Dependencies))
-	defer close(deps)
+// readState reads the state of the result with a single JSON-RPC batch,
+// only the constrained slots are read when dependencies is false
+func (e *Endorser) readState(ctx context.Context, result *EndorserResult, dependencies bool) (*EndorserResultState, error) {
+	var calls []ethrpc.Call
 
-	eg, ctx := errgroup.WithContext(ctx)
+	var head *ethtypes.Header
+	global := dependencies && HasGlobalDependency(&result.GlobalDependency)
+	if global {
+		calls = append(calls, ethrpc.HeaderByNumber(nil).Into(&head))
+	}
 
+	// An address may be used by more than one dependency,
+	// every account field and slot is only read once
+	merged := make(map[common.Address]*Dependency, len(result.Dependencies))
 	for _, dep := range result.Dependencies {
-		capturedDep := dep
-		eg.Go(func() error {
-			res, err := e.SingleDependencyState(ctx, capturedDep)
-			if err != nil {
-				return err
+		m, ok := merged[dep.Addr]
+		if !ok {
+			m = &Dependency{Addr: dep.Addr}
+			merged[dep.Addr] = m
+		}
+
+		m.Balance = m.Balance || dep.Balance
+		m.Code = m.Code || dep.Code
+		m.Nonce = m.Nonce || dep.Nonce
+	}
+
+	request := make(map[common.Address][][32]byte)
+	index := make(map[common.Address]map[[32]byte]int)
+	use := func(addr common.Address, slot [32]byte) {
+		if index[addr] == nil {
+			index[addr] = make(map[[32]byte]int)
+		}
+
+		if _, ok := index[addr][slot]; !ok {
+			index[addr][slot] = len(request[addr])
+			request[addr] = append(request[addr], slot)
+		}
+	}
+
+	// The dependency slots go first, the state of an
+	// address has them in the order they are requested
+	if dependencies {
+		for _, dep := range result.Dependencies {
+			for _, slot := range dep.Slots {
+				use(dep.Addr, slot)
 			}
+		}
+	}
 
-			deps <- &SingleDependencyStateResult{Addr: capturedDep.Addr, Res: res}
-			return nil
-		})
+	slotCount := make(map[common.Address]int, len(request))
+	for addr, slots := range request {
+		slotCount[addr] = len(slots)
 	}
 
-	err := eg.Wait()
-	if err != nil {
-		return nil, err
+	for _, dep := range result.Dependencies {
+		for _, constraint := range dep.Constraints {
+			use(dep.Addr, constraint.Slot)
+		}
+	}
+
+	state := &EndorserResultState{
+		AddrDependencies: make(map[common.Address]*AddrDependencyState, len(merged)),
+	}
+
+	codes := make(map[common.Address]*[]byte)
+	for addr, dep := range merged {
+		s := &AddrDependencyState{}
+		state.AddrDependencies[addr] = s
+
+		if !dependencies {
+			continue
+		}
+
+		if dep.Balance {
+			calls = append(calls, ethrpc.BalanceAt(addr, nil).Into(&s.Balance))
+		}
+
+		if dep.Code {
+			codes[addr] = new([]byte)
+			calls = append(calls, ethrpc.CodeAt(addr, nil).Into(codes[addr]))
+		}
+
+		if dep.Nonce {
+			s.Nonce = new(uint64)
+			calls = append(calls, ethrpc.NonceAt(addr, nil).Into(s.Nonce))
+		}
 	}
 
-	res := make(map[common.Address]*AddrDependencyState, len(result.Dependencies))
-	for {
-		select {
-		case dep := <-deps:
-			res[dep.Addr] = dep.Res
-		default:
-			return &EndorserResultState{AddrDependencies: res}, nil
+	var decodeSlots func() (map[common.Address][][32]byte, error)
+	if len(request) != 0 {
+		slotCalls, decode, err := e.Provider.SlotsCalls(request)
+		if err != nil {
+			e.metrics.dependencyStateError.With(e.metrics.dependencyStateErrorSlots).Inc()
+			return nil, fmt.Errorf("unable to read storage: %w", err)
 		}
+
+		calls = append(calls, slotCalls...)
+		decodeSlots = decode
 	}
-}
 
-func (e *Endorser) ConstraintsMet(ctx context.Context, result *EndorserResult) (bool, error) {
-	start := time.Now()
+	if _, err := e.Provider.Do(ctx, calls...); err != nil {
+		return nil, fmt.Errorf("unable to read state: %w", err)
+	}
 
-	for _, dependency := range result.Dependencies {
-		for _, constraint := range dependency.Constraints {
-			start2 := time.Now()
-			ok, err := e.CheckConstraint(ctx, dependency.Addr, constraint.Slot, constraint.MinValue, constraint.MaxValue)
-			e.metrics.constraintMetDuration.Observe(time.Since(start2).Seconds())
+	if global {
+		res, err := e.globalState(ctx, &result.GlobalDependency, head)
+		if err != nil {
+			return nil, err
+		}
 
-			if err != nil {
-				e.metrics.constraintsMetError.Inc()
-				return false, err
+		state.GlobalDependency = res
+	}
+
+	for addr, code := range codes {
+		size := len(*code)
+		state.AddrDependencies[addr].Code = &size
+	}
+
+	if decodeSlots != nil {
+		values, err := decodeSlots()
+		if err != nil {
+			e.metrics.dependencyStateError.With(e.metrics.dependencyStateErrorSlots).Inc()
+			return nil, fmt.Errorf("unable to read storage: %w", err)
+		}
+
+		for addr, slots := range request {
+			if len(values[addr]) != len(slots) {
+				e.metrics.dependencyStateError.With(e.metrics.dependencyStateErrorSlots).Inc()
+				return nil, fmt.Errorf("missing storage for %v", addr)
+			}
+
+			if n := slotCount[addr]; n != 0 {
+				state.AddrDependencies[addr].Slots = values[addr][:n]
 			}
+		}
 
-			if !ok {
-				e.metrics.constraintsNotMet.Inc()
-				return false, nil
+		for _, dep := range result.Dependencies {
+			for _, constraint := range dep.Constraints {
+				s := state.AddrDependencies[dep.Addr]
+				if s.Constraints == nil {
+					s.Constraints = make(map[[32]byte][32]byte)
+				}
+
+				s.Constraints[constraint.Slot] = values[dep.Addr][index[dep.Addr][constraint.Slot]]
 			}
 		}
 	}
 
+	return state, nil
+}
+
+func (e *Endorser) ConstraintsMet(ctx context.Context, result *EndorserResult) (bool, error) {
+	start := time.Now()
+
+	if !result.HasConstraints() {
+		e.metrics.constraintsMet.Inc()
+		return true, nil
+	}
+
+	// Every constrained slot is read with a single call
+	state, err := e.readState(ctx, result, false)
+	e.metrics.constraintMetDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		e.metrics.constraintsMetError.Inc()
+		return false, fmt.Errorf("unable to read constrained storage: %w", err)
+	}
+
+	ok, err := result.ConstraintsMet(state)
+	if err != nil {
+		e.metrics.constraintsMetError.Inc()
+		return false, err
+	}
+
+	if !ok {
+		e.metrics.constraintsNotMet.Inc()
+		return false, nil
+	}
+
 	e.metrics.constraintsMet.Inc()
 	e.metrics.constraintsMetDuration.Observe(time.Since(start).Seconds())
 	return true, nil
@@ -651,13 +786,13 @@ func (e *Endorser) CheckConstraint(ctx context.Context, addr common.Address, slo
 		return false, fmt.Errorf("unable to read storage for %v at %v: %w", addr, hexutil.Encode(slot[:]), err)
 	}
 
+	return constraintHolds(value, minValue, maxValue), nil
+}
+
+func constraintHolds(value []byte, minValue, maxValue [32]byte) bool {
 	bnMin := new(big.Int).SetBytes(minValue[:])
 	bnMax := new(big.Int).SetBytes(maxValue[:])
-	bnValue := new(big.Int).SetBytes(value[:])
+	bnValue := new(big.Int).SetBytes(value)
 
-	if bnValue.Cmp(bnMin) < 0 || bnValue.Cmp(bnMax) > 0 {
-		return false, nil
-	}
-
-	return true, nil
+	return bnValue.Cmp(bnMin) >= 0 && bnValue.Cmp(bnMax) <= 0
 }
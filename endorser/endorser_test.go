@@ -0,0 +1,162 @@
+package endorser_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/0xsequence/bundler/lib/provider"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/ethkit/ethrpc"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/go-chi/httplog/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallGas(t *testing.T) {
+	e := &endorser.Endorser{MaxGasLimit: 100_000}
+
+	withLimit := func(limit *big.Int) *types.Operation {
+		return &types.Operation{EndorserGasLimit: limit}
+	}
+
+	assert.Equal(t, uint64(50_000), e.CallGas(withLimit(big.NewInt(50_000))))
+	assert.Equal(t, uint64(100_000), e.CallGas(withLimit(big.NewInt(200_000))))
+
+	// Operations without a limit can't bypass the max
+	assert.Equal(t, uint64(100_000), e.CallGas(withLimit(nil)))
+	assert.Equal(t, uint64(100_000), e.CallGas(withLimit(big.NewInt(0))))
+
+	unbounded := &endorser.Endorser{}
+	assert.Equal(t, uint64(50_000), unbounded.CallGas(withLimit(big.NewInt(50_000))))
+	assert.Equal(t, uint64(0), unbounded.CallGas(withLimit(big.NewInt(0))))
+}
+
+// storageNode answers every slot with its own key, it counts the requests
+type storageNode struct {
+	requests atomic.Int32
+}
+
+func (n *storageNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.requests.Add(1)
+
+	var reqs []struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	batch := len(body) != 0 && body[0] == '['
+	if !batch {
+		body = append(append([]byte{'['}, body...), ']')
+	}
+	_ = json.Unmarshal(body, &reqs)
+
+	results := make([]map[string]interface{}, len(reqs))
+	for i, req := range reqs {
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+
+		switch req.Method {
+		case "eth_getBalance":
+			res["result"] = "0x10"
+		case "eth_getTransactionCount":
+			res["result"] = "0x2"
+		case "eth_getCode":
+			res["result"] = "0x600060"
+		case "eth_call":
+			// The batch caller takes max_size(32):(address(32):size(32):calldata)[]
+			// and returns (size(32):returndata)[], the fetcher returns the keys
+			var call struct {
+				Data string `json:"data"`
+			}
+			_ = json.Unmarshal(req.Params[0], &call)
+			data := common.FromHex(call.Data)[32:]
+
+			var out []byte
+			for len(data) != 0 {
+				size := new(big.Int).SetBytes(data[32:64]).Int64()
+				out = append(out, data[32:64]...)
+				out = append(out, data[64:64+size]...)
+				data = data[64+size:]
+			}
+			res["result"] = hexutil.Encode(out)
+		default:
+			res["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+
+		results[i] = res
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !batch {
+		_ = json.NewEncoder(w).Encode(results[0])
+		return
+	}
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+func TestDependencyStateSingleRequest(t *testing.T) {
+	node := &storageNode{}
+	server := httptest.NewServer(node)
+	defer server.Close()
+
+	p, err := ethrpc.NewProvider(server.URL)
+	require.NoError(t, err)
+
+	e := endorser.NewEndorser(httplog.NewLogger(""), nil, provider.NewBatched(provider.NewExtended(p, false, true), time.Millisecond), nil, 0)
+
+	a := common.HexToAddress("0x1234")
+	b := common.HexToAddress("0x5678")
+
+	// The address a is used twice, the slots of both dependencies are read
+	result := &endorser.EndorserResult{
+		Readiness: true,
+		Dependencies: []endorser.Dependency{
+			{Addr: a, Balance: true, Slots: [][32]byte{{1}, {2}}},
+			{Addr: b, Code: true, Constraints: []endorser.Constraint{
+				{Slot: [32]byte{3}, MaxValue: [32]byte{4}},
+			}},
+			{Addr: a, Nonce: true, Slots: [][32]byte{{2}, {5}}, Constraints: []endorser.Constraint{
+				{Slot: [32]byte{1}, MinValue: [32]byte{2}, MaxValue: [32]byte{3}},
+			}},
+		},
+	}
+
+	state, err := e.DependencyState(context.Background(), result)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), node.requests.Load())
+
+	require.Len(t, state.AddrDependencies, 2)
+	sa := state.AddrDependencies[a]
+	assert.Equal(t, big.NewInt(16), sa.Balance)
+	assert.Equal(t, uint64(2), *sa.Nonce)
+	assert.Nil(t, sa.Code)
+	assert.Equal(t, [][32]byte{{1}, {2}, {5}}, sa.Slots)
+	assert.Equal(t, map[[32]byte][32]byte{{1}: {1}}, sa.Constraints)
+
+	sb := state.AddrDependencies[b]
+	assert.Nil(t, sb.Balance)
+	assert.Equal(t, 3, *sb.Code)
+	assert.Empty(t, sb.Slots)
+	assert.Equal(t, map[[32]byte][32]byte{{3}: {3}}, sb.Constraints)
+
+	// The slot 1 of a is below its minimum
+	ok, err := result.ConstraintsMet(state)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Only the constrained slots are read
+	ok, err = e.ConstraintsMet(context.Background(), result)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int32(2), node.requests.Load())
+}
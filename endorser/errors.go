@@ -0,0 +1,141 @@
+package endorser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/0xsequence/bundler/lib/debugger"
+	"github.com/0xsequence/ethkit/go-ethereum/accounts/abi"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+)
+
+// Kinds of failures when asking an endorser about an operation,
+// use errors.Is to tell them apart
+var (
+	// The node failed to run the call, the operation may still be valid
+	ErrProvider = errors.New("provider error")
+	// The endorser reverted instead of returning a readiness
+	ErrReverted = errors.New("endorser reverted")
+	// The endorser returned something that is not a valid result
+	ErrMalformedResult = errors.New("malformed endorser result")
+	// The endorser ran out of gas before returning
+	ErrOutOfGas = errors.New("endorser out of gas")
+	// The endorser returned a readiness of false
+	ErrNotReady = errors.New("operation not ready")
+)
+
+type ProviderError struct {
+	Err error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("provider error: %v", e.Err)
+}
+
+func (e *ProviderError) Unwrap() []error {
+	return []error{ErrProvider, e.Err}
+}
+
+type RevertError struct {
+	Err    error
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	return fmt.Sprintf("rejected: %s", e.Reason)
+}
+
+func (e *RevertError) Unwrap() []error {
+	return []error{ErrReverted, e.Err}
+}
+
+type MalformedResultError struct {
+	Err error
+}
+
+func (e *MalformedResultError) Error() string {
+	return fmt.Sprintf("malformed result: %v", e.Err)
+}
+
+func (e *MalformedResultError) Unwrap() []error {
+	return []error{ErrMalformedResult, e.Err}
+}
+
+type OutOfGasError struct {
+	Err error
+}
+
+func (e *OutOfGasError) Error() string {
+	return fmt.Sprintf("out of gas: %v", e.Err)
+}
+
+func (e *OutOfGasError) Unwrap() []error {
+	return []error{ErrOutOfGas, e.Err}
+}
+
+// ErrorKind returns a short name for the kind of the error, to be used as a metric label
+func ErrorKind(err error) string {
+	switch {
+	case err == nil:
+		return "none"
+	case errors.Is(err, ErrProvider):
+		return "provider"
+	case errors.Is(err, ErrOutOfGas):
+		return "out_of_gas"
+	case errors.Is(err, ErrReverted):
+		return "revert"
+	case errors.Is(err, ErrMalformedResult):
+		return "malformed"
+	case errors.Is(err, ErrNotReady):
+		return "not_ready"
+	default:
+		return "unknown"
+	}
+}
+
+// callError classifies the error of an eth_call to the endorser
+func callError(err error) error {
+	msg := err.Error()
+
+	if strings.Contains(msg, "out of gas") || strings.Contains(msg, "gas required exceeds") {
+		return &OutOfGasError{Err: err}
+	}
+
+	if strings.Contains(msg, "execution reverted") {
+		reason := msg
+		reason = strings.TrimPrefix(reason, "jsonrpc error 3: ")
+		reason = strings.TrimPrefix(reason, "execution reverted: ")
+		reason = strings.TrimPrefix(reason, "reverted: ")
+		return &RevertError{Err: err, Reason: reason}
+	}
+
+	return &ProviderError{Err: err}
+}
+
+// revertReason decodes the reason of a revert, if it is an Error(string)
+func revertReason(data []byte) string {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+
+	if len(data) == 0 {
+		return "no reason"
+	}
+
+	return "0x" + common.Bytes2Hex(data)
+}
+
+// traceError classifies a failed trace of the endorser, running out of gas
+// leaves the last step with less gas than its cost
+func traceError(trace *debugger.TransactionTrace) error {
+	if n := len(trace.StructLogs); n != 0 {
+		last := trace.StructLogs[n-1]
+		if last.Gas < last.GasCost {
+			return &OutOfGasError{Err: fmt.Errorf("%s at pc %v", last.Op, last.PC)}
+		}
+	}
+
+	data := common.FromHex(trace.ReturnValue)
+	return &RevertError{Err: fmt.Errorf("trace failed"), Reason: revertReason(data)}
+}
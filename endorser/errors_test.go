@@ -0,0 +1,48 @@
+package endorser_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKind(t *testing.T) {
+	cause := fmt.Errorf("cause")
+
+	tests := []struct {
+		err      error
+		sentinel error
+		kind     string
+	}{
+		{&endorser.ProviderError{Err: cause}, endorser.ErrProvider, "provider"},
+		{&endorser.RevertError{Err: cause, Reason: "nope"}, endorser.ErrReverted, "revert"},
+		{&endorser.MalformedResultError{Err: cause}, endorser.ErrMalformedResult, "malformed"},
+		{&endorser.OutOfGasError{Err: cause}, endorser.ErrOutOfGas, "out_of_gas"},
+		{endorser.ErrNotReady, endorser.ErrNotReady, "not_ready"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			// The kind survives wrapping
+			wrapped := fmt.Errorf("IsOperationReady failed: %w", tt.err)
+
+			assert.ErrorIs(t, wrapped, tt.sentinel)
+			assert.Equal(t, tt.kind, endorser.ErrorKind(wrapped))
+
+			if tt.err != tt.sentinel {
+				assert.ErrorIs(t, wrapped, cause)
+			}
+		})
+	}
+
+	assert.Equal(t, "none", endorser.ErrorKind(nil))
+	assert.Equal(t, "unknown", endorser.ErrorKind(cause))
+
+	var revert *endorser.RevertError
+	err := fmt.Errorf("wrapped: %w", &endorser.RevertError{Err: cause, Reason: "nope"})
+	assert.True(t, errors.As(err, &revert))
+	assert.Equal(t, "nope", revert.Reason)
+}
@@ -38,6 +38,10 @@ type AddrDependencyState struct {
 	Code    *int
 	Nonce   *uint64
 	Slots   [][32]byte
+
+	// Values of the constrained slots, they are not part of the
+	// dependency, they are read so the constraints can be checked
+	Constraints map[[32]byte][32]byte
 }
 
 type GlobalDependency = abiendorser.IEndorserGlobalDependency
@@ -50,6 +54,10 @@ type EndorserResult struct {
 	Readiness        bool             `json:"readiness"`
 	GlobalDependency GlobalDependency `json:"global_dependency"`
 	Dependencies     []Dependency     `json:"dependencies"`
+
+	// Gas used by the endorser, known when traced by the debugger or
+	// when the check was sampled, 0 when it is not known
+	GasUsed uint64 `json:"-"`
 }
 
 type EndorserResultState struct {
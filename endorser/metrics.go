@@ -161,7 +161,7 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 
 	constraintMetDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name:    "endorser_constraint_met_duration",
-		Help:    "Duration to check if one constraint is met",
+		Help:    "Duration to read the constrained slots",
 		Buckets: prometheus.DefBuckets,
 	})
 
@@ -232,3 +232,56 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		dependencyStateErrorSlots:   prometheus.Labels{"reason": "slots"},
 	}
 }
+
+type cacheMetrics struct {
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	stale     prometheus.Counter
+	evictions prometheus.Counter
+	size      prometheus.Gauge
+}
+
+func createCacheMetrics(reg prometheus.Registerer) *cacheMetrics {
+	hits := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "endorser_cache_hits",
+		Help: "Number of endorser results reused from the cache",
+	})
+
+	misses := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "endorser_cache_misses",
+		Help: "Number of endorser calls not served by the cache",
+	})
+
+	stale := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "endorser_cache_stale",
+		Help: "Number of lookups of operations cached under a different dependency state",
+	})
+
+	evictions := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "endorser_cache_evictions",
+		Help: "Number of cached endorser results evicted",
+	})
+
+	size := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "endorser_cache_size",
+		Help: "Number of cached endorser results",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			hits,
+			misses,
+			stale,
+			evictions,
+			size,
+		)
+	}
+
+	return &cacheMetrics{
+		hits:      hits,
+		misses:    misses,
+		stale:     stale,
+		evictions: evictions,
+		size:      size,
+	}
+}
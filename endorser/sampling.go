@@ -0,0 +1,49 @@
+package endorser
+
+import (
+	"sync"
+
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+const (
+	// The first checks of every endorser have their gas sampled,
+	// then only one in gasSampleEvery, estimating it runs the
+	// endorser many times
+	gasSampleFirst = 4
+	gasSampleEvery = 32
+
+	// Endorsers whose checks are counted
+	maxGasSampled = 1 << 12
+)
+
+// gasSampler decides which checks of an endorser estimate the gas it used
+type gasSampler struct {
+	lock   sync.Mutex
+	checks *lru.Cache[common.Address, uint64]
+}
+
+func newGasSampler() *gasSampler {
+	// The size is constant and positive
+	checks, _ := lru.New[common.Address, uint64](maxGasSampled)
+
+	return &gasSampler{checks: checks}
+}
+
+// sample counts a check of the endorser, and returns
+// true if the gas it used must be estimated
+func (s *gasSampler) sample(endorser common.Address) bool {
+	if s == nil {
+		return false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n, _ := s.checks.Get(endorser)
+	n++
+	s.checks.Add(endorser, n)
+
+	return n <= gasSampleFirst || n%gasSampleEvery == 0
+}
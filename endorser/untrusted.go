@@ -2,6 +2,7 @@ package endorser
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/0xsequence/bundler/lib/debugger"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
@@ -22,51 +23,156 @@ func isZeros(b []byte) bool {
 	return true
 }
 
-// TODO: Handle CREATE and CREATE2
+// Precompiles live on the lowest addresses (and the zero address has no code)
+func isPrecompile(addr common.Address) bool {
+	return new(big.Int).SetBytes(addr.Bytes()).Cmp(big.NewInt(0x0a)) <= 0
+}
+
+func stackTop(log *debugger.LogEntry, n int) (string, bool) {
+	l := len(log.Stack)
+	if l < n {
+		return "", false
+	}
+	return log.Stack[l-n], true
+}
+
+// returnOf finds the first log after i that runs at the same
+// depth, that is the step right after the opcode completes
+func returnOf(tt *debugger.TransactionTrace, i int) *debugger.LogEntry {
+	depth := tt.StructLogs[i].Depth
+	for j := i + 1; j < len(tt.StructLogs); j++ {
+		if tt.StructLogs[j].Depth == depth {
+			return &tt.StructLogs[j]
+		}
+		if tt.StructLogs[j].Depth < depth {
+			return nil
+		}
+	}
+	return nil
+}
+
+// entersFrame returns true if the opcode at i started a new call frame,
+// calls to accounts without code or failed calls don't create one
+func entersFrame(tt *debugger.TransactionTrace, i int) bool {
+	ni := i + 1
+	return len(tt.StructLogs) > ni && tt.StructLogs[ni].Depth == tt.StructLogs[i].Depth+1
+}
+
 func ParseUntrustedDebug(tt *debugger.TransactionTrace) (*EndorserResult, error) {
 	result := &EndorserResult{}
 
+	// The self address of each call frame, indexed by depth - 1
+	// frames end by RETURN, REVERT, STOP, SELFDESTRUCT or by an
+	// exceptional halt, so they are dropped based on the depth
 	selfstack := make([]common.Address, 1)
-	selfstack[0] = tt.From
+	selfstack[0] = tt.To
 
 	untrustedDepth := 0
 	var depthOfUntrusted *float64
 
+	startedSig := common.HexToHash(UNTRUSTED_STARTED_SIG)
+	endedSig := common.HexToHash(UNTRUSTED_ENDED_SIG)
+
 	// Iterate over every opcode
-	for i, log := range tt.StructLogs {
+	for i := range tt.StructLogs {
+		log := &tt.StructLogs[i]
+
+		depth := int(log.Depth)
+		if depth < 1 || depth > len(selfstack) {
+			return nil, fmt.Errorf("selfstack out of sync at step %d: depth %d, frames %d", i, depth, len(selfstack))
+		}
+		selfstack = selfstack[:depth]
+		self := selfstack[depth-1]
+
+		// If the frame that started the untrusted code ended
+		// without emitting the end event, the untrusted code ended too
+		if depthOfUntrusted != nil && log.Depth < *depthOfUntrusted {
+			untrustedDepth = 0
+			depthOfUntrusted = nil
+		}
+
 		switch log.Op {
-		case "CALL", "STATICCALL":
-			// Change the self address
-			l := len(log.Stack)
-			if l >= 2 {
-				selfstack = append(selfstack, common.HexToAddress(log.Stack[l-2]))
+		case "CALL", "CALLCODE", "DELEGATECALL", "STATICCALL":
+			cand, ok := stackTop(log, 2)
+			if !ok {
+				return nil, fmt.Errorf("%s without address at step %d", log.Op, i)
 			}
+			target := common.HexToAddress(cand)
 
-		case "CALLDCODE", "DELEGATECALL":
-			// Change the self address (to self again)
-			selfstack = append(selfstack, selfstack[len(selfstack)-1])
+			if untrustedDepth > 0 {
+				// Sending value depends on the balance of the sender
+				if log.Op == "CALL" || log.Op == "CALLCODE" {
+					if value, ok := stackTop(log, 3); ok && !isZeros(common.FromHex(value)) {
+						result.SetBalance(self, true)
+					}
+				}
 
-		case "RETURN", "REVERT":
-			// Change the self address
-			if len(selfstack) == 0 {
-				return nil, fmt.Errorf("selfstack is empty")
+				// Calling an account without code depends on it not having code
+				if !entersFrame(tt, i) && !isPrecompile(target) {
+					result.SetCode(target, true)
+				}
+			}
+
+			if entersFrame(tt, i) {
+				if log.Op == "CALL" || log.Op == "STATICCALL" {
+					// Change the self address
+					selfstack = append(selfstack, target)
+				} else {
+					// CALLCODE and DELEGATECALL run on the self context
+					selfstack = append(selfstack, self)
+				}
 			}
 
-			selfstack = selfstack[:len(selfstack)-1]
+		case "CREATE", "CREATE2":
+			// The address of the created contract is left on the stack once
+			// the creation returns, or zero if the creation failed
+			addr := common.Address{}
+			if ret := returnOf(tt, i); ret != nil {
+				if cand, ok := stackTop(ret, 1); ok {
+					addr = common.HexToAddress(cand)
+				}
+			}
+
+			if untrustedDepth > 0 {
+				// CREATE derives the address from the nonce of the creator
+				// CREATE2 derives it from the salt and the init code
+				if log.Op == "CREATE" {
+					result.SetNonce(self, true)
+				}
+
+				// Creating a contract may send value
+				if value, ok := stackTop(log, 1); ok && !isZeros(common.FromHex(value)) {
+					result.SetBalance(self, true)
+				}
+
+				// The creation fails if there is already code on the address
+				if addr != (common.Address{}) {
+					result.SetCode(addr, true)
+				}
+			}
+
+			if entersFrame(tt, i) {
+				selfstack = append(selfstack, addr)
+			}
+
+		case "SELFDESTRUCT":
+			if untrustedDepth > 0 {
+				// The whole balance is sent to the beneficiary
+				result.SetBalance(self, true)
+			}
 
 		case "LOG1":
 			// The execution may be entering or leaving the untrusted code
 			// LOG1 opcode takes offset, size, topic
 			// we only care about the topic being one of the two
-			l := len(log.Stack)
-			if l >= 3 {
-				cand := log.Stack[l-3]
-				if cand == UNTRUSTED_STARTED_SIG {
+			if cand, ok := stackTop(log, 3); ok {
+				topic := common.HexToHash(cand)
+				if topic == startedSig {
 					untrustedDepth++
 					if depthOfUntrusted == nil {
 						depthOfUntrusted = &log.Depth
 					}
-				} else if cand == UNTRUSTED_ENDED_SIG {
+				} else if topic == endedSig {
 					// Ignore if we aren't in the right depth
 					if depthOfUntrusted != nil && log.Depth == *depthOfUntrusted {
 						untrustedDepth--
@@ -79,10 +185,8 @@ func ParseUntrustedDebug(tt *debugger.TransactionTrace) (*EndorserResult, error)
 
 		case "BALANCE":
 			if untrustedDepth > 0 {
-				l := len(log.Stack)
-				if l >= 1 {
-					addr := common.HexToAddress(log.Stack[l-1])
-					result.SetBalance(addr, true)
+				if cand, ok := stackTop(log, 1); ok {
+					result.SetBalance(common.HexToAddress(cand), true)
 				}
 			}
 
@@ -100,7 +204,7 @@ func ParseUntrustedDebug(tt *debugger.TransactionTrace) (*EndorserResult, error)
 			if untrustedDepth > 0 {
 				l := len(log.Stack)
 				ni := i + 1
-				if l >= 1 && len(tt.StructLogs) > ni {
+				if l >= 1 && len(tt.StructLogs) > ni && len(tt.StructLogs[ni].Stack) >= l {
 					// The result and the argument use the same position on the stack
 					// as the opcodes takes 1 and returns 1
 					sres := common.FromHex(tt.StructLogs[ni].Stack[l-1])
@@ -138,7 +242,7 @@ func ParseUntrustedDebug(tt *debugger.TransactionTrace) (*EndorserResult, error)
 
 		case "SELFBALANCE":
 			if untrustedDepth > 0 {
-				result.SetBalance(selfstack[len(selfstack)-1], true)
+				result.SetBalance(self, true)
 			}
 
 		case "BASEFEE":
@@ -148,33 +252,11 @@ func ParseUntrustedDebug(tt *debugger.TransactionTrace) (*EndorserResult, error)
 
 		case "SLOAD":
 			if untrustedDepth > 0 {
-				l := len(log.Stack)
-				if l >= 1 {
-					result.SetStorageSlot(selfstack[len(selfstack)-1], common.HexToHash(log.Stack[l-1]), true)
+				if cand, ok := stackTop(log, 1); ok {
+					result.SetStorageSlot(self, common.HexToHash(cand), true)
 				}
 			}
 
-		case "CREATE":
-			if untrustedDepth > 0 {
-				return nil, fmt.Errorf("CREATE is not supported on untrusted code")
-			}
-
-		case "CREATE2":
-			if untrustedDepth > 0 {
-				// Loop through ops to find the address of the created contract set on depth return
-				addr := common.Address{}
-				createDepth := log.Depth
-				for j := i + 1; j < len(tt.StructLogs); j++ {
-					if tt.StructLogs[j].Depth == createDepth {
-						l := len(tt.StructLogs[j].Stack)
-						addr = common.HexToAddress(tt.StructLogs[j].Stack[l-1])
-						result.SetCode(addr, true)
-						break
-					}
-				}
-				selfstack = append(selfstack, addr)
-			}
-
 		default:
 		}
 	}
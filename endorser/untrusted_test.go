@@ -0,0 +1,146 @@
+package endorser_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/0xsequence/bundler/lib/debugger"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTrace(t *testing.T, name string) *debugger.TransactionTrace {
+	data, err := os.ReadFile(filepath.Join("testdata", "untrusted", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := &debugger.TransactionTrace{}
+	if err := json.Unmarshal(data, tt); err != nil {
+		t.Fatal(err)
+	}
+
+	return tt
+}
+
+func slot(v int64) [32]byte {
+	return common.BigToHash(big.NewInt(v))
+}
+
+func TestParseUntrustedDebug(t *testing.T) {
+	u := common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+	v := common.HexToAddress("0x000000000000000000000000000000000000bbbb")
+	l := common.HexToAddress("0x000000000000000000000000000000000000cccc")
+	e := common.HexToAddress("0x000000000000000000000000000000000000eeee")
+
+	// Addresses derived by the recorded traces
+	created := common.HexToAddress("0xcfec6955f6ad8ea9f7b9ada2d00f6d9839165c67")
+	created2 := common.HexToAddress("0xc43bd7913d6861c7c85c6d3687f844869fef89d4")
+
+	tests := []struct {
+		name     string
+		expected []endorser.Dependency
+	}{
+		{
+			// CREATE depends on the creator nonce and the new address having no code,
+			// the constructor runs on the new address (SELFBALANCE)
+			name: "create",
+			expected: []endorser.Dependency{
+				{Addr: u, Nonce: true},
+				{Addr: created, Code: true, Balance: true},
+			},
+		},
+		{
+			// CREATE2 does not depend on the nonce
+			name: "create2",
+			expected: []endorser.Dependency{
+				{Addr: created2, Code: true, Balance: true},
+			},
+		},
+		{
+			// CALLCODE runs on the self context, calling an account
+			// without code depends on it not having code
+			name: "callcode",
+			expected: []endorser.Dependency{
+				{Addr: u, Slots: [][32]byte{slot(5), slot(6)}},
+				{Addr: e, Code: true},
+			},
+		},
+		{
+			// SELFDESTRUCT sends the balance of the destructed contract
+			name: "selfdestruct",
+			expected: []endorser.Dependency{
+				{Addr: v, Balance: true},
+				{Addr: u, Slots: [][32]byte{slot(6)}},
+			},
+		},
+		{
+			// The frame that halts exceptionally is dropped
+			name: "halt",
+			expected: []endorser.Dependency{
+				{Addr: v, Slots: [][32]byte{slot(2)}},
+				{Addr: u, Slots: [][32]byte{slot(3), slot(4)}},
+				{Addr: l, Slots: [][32]byte{slot(5)}},
+			},
+		},
+		{
+			// The untrusted code ends with the frame that started it
+			name: "unterminated",
+			expected: []endorser.Dependency{
+				{Addr: v, Slots: [][32]byte{slot(2)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := endorser.ParseUntrustedDebug(loadTrace(t, tt.name))
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.expected, res.Dependencies)
+		})
+	}
+}
+
+func TestParseUntrustedDebugOutOfSync(t *testing.T) {
+	tt := &debugger.TransactionTrace{
+		StructLogs: []debugger.LogEntry{
+			{Op: "PUSH1", Depth: 1, Stack: []string{}},
+			// Jumps two frames deep without a call
+			{Op: "SLOAD", Depth: 3, Stack: []string{"0x1"}},
+		},
+	}
+
+	_, err := endorser.ParseUntrustedDebug(tt)
+	assert.Error(t, err)
+}
+
+func TestMergeUntrustedDebug(t *testing.T) {
+	u := common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+	e := common.HexToAddress("0x000000000000000000000000000000000000eeee")
+	w := common.HexToAddress("0x000000000000000000000000000000000000ffff")
+
+	untrusted, err := endorser.ParseUntrustedDebug(loadTrace(t, "callcode"))
+	assert.NoError(t, err)
+
+	// The debugger merges the result of isOperationReady with the trace
+	ready := &endorser.EndorserResult{
+		Readiness:    true,
+		Dependencies: []endorser.Dependency{{Addr: w, Balance: true}},
+	}
+
+	merged := ready.Or(untrusted)
+	assert.True(t, merged.Readiness)
+	assert.ElementsMatch(t, []endorser.Dependency{
+		{Addr: w, Balance: true},
+		{Addr: u, Slots: [][32]byte{slot(5), slot(6)}},
+		{Addr: e, Code: true},
+	}, merged.Dependencies)
+
+	// The trace never makes an operation ready
+	notReady := &endorser.EndorserResult{}
+	assert.False(t, notReady.Or(untrusted).Readiness)
+}
@@ -2,10 +2,12 @@ package endorser
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
 	"github.com/0xsequence/bundler/contracts/gen/solabis/abivalidator"
 	"github.com/0xsequence/ethkit/go-ethereum/accounts/abi"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
 )
 
 func (r *EndorserResult) Encode() ([]byte, error) {
@@ -213,9 +215,119 @@ func Validate(d *Dependency, state *AddrDependencyState) error {
 	return nil
 }
 
-func (r *EndorserResult) HasChanged(x, y *EndorserResultState) (bool, error) {
-	// TODO: Check global dependencies
+func HasGlobalDependency(d *GlobalDependency) bool {
+	return d.BaseFee ||
+		d.BlobBaseFee ||
+		d.ChainId ||
+		d.CoinBase ||
+		d.Difficulty ||
+		d.GasLimit ||
+		d.Number ||
+		d.Timestamp ||
+		d.TxOrigin ||
+		d.TxGasPrice
+}
+
+// Unknown values (nil) are always considered changed
+func bigChanged(x, y *big.Int) bool {
+	if x == nil || y == nil {
+		return true
+	}
+
+	return x.Cmp(y) != 0
+}
+
+func HasGlobalChanged(d *GlobalDependency, x, y *GlobalDependencyState) (bool, error) {
+	if !HasGlobalDependency(d) {
+		return false, nil
+	}
+
+	if x == nil {
+		return false, fmt.Errorf("x is missing the global dependency state")
+	}
+	if y == nil {
+		return false, fmt.Errorf("y is missing the global dependency state")
+	}
+
+	if d.BaseFee && bigChanged(x.Basefee, y.Basefee) {
+		return true, nil
+	}
+
+	if d.BlobBaseFee && bigChanged(x.Blobbasefee, y.Blobbasefee) {
+		return true, nil
+	}
+
+	if d.ChainId && bigChanged(x.Chainid, y.Chainid) {
+		return true, nil
+	}
+
+	if d.CoinBase && x.Coinbase != y.Coinbase {
+		return true, nil
+	}
+
+	if d.Difficulty && bigChanged(x.Difficulty, y.Difficulty) {
+		return true, nil
+	}
+
+	if d.GasLimit && bigChanged(x.GasLimit, y.GasLimit) {
+		return true, nil
+	}
+
+	if d.Number && bigChanged(x.Number, y.Number) {
+		return true, nil
+	}
+
+	if d.Timestamp && bigChanged(x.Timestamp, y.Timestamp) {
+		return true, nil
+	}
+
+	if d.TxOrigin && x.TxOrigin != y.TxOrigin {
+		return true, nil
+	}
+
+	if d.TxGasPrice && bigChanged(x.TxGasPrice, y.TxGasPrice) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// HasConstraints returns true if any dependency constrains the value of a slot
+func (r *EndorserResult) HasConstraints() bool {
+	for _, dep := range r.Dependencies {
+		if len(dep.Constraints) != 0 {
+			return true
+		}
+	}
 
+	return false
+}
+
+// ConstraintsMet checks the constraints of the result on the
+// constrained slots that were read along with the state
+func (r *EndorserResult) ConstraintsMet(state *EndorserResultState) (bool, error) {
+	for _, dep := range r.Dependencies {
+		for _, constraint := range dep.Constraints {
+			var value [32]byte
+			var ok bool
+			if ad := state.AddrDependencies[dep.Addr]; ad != nil {
+				value, ok = ad.Constraints[constraint.Slot]
+			}
+
+			if !ok {
+				return false, fmt.Errorf("missing storage for %v at %v", dep.Addr, hexutil.Encode(constraint.Slot[:]))
+			}
+
+			if !constraintHolds(value[:], constraint.MinValue, constraint.MaxValue) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+func (r *EndorserResult) HasChanged(x, y *EndorserResultState) (bool, error) {
 	if err := r.Validate(x); err != nil {
 		return false, fmt.Errorf("x is not a valid state for endorser result: %w", err)
 	}
@@ -223,6 +335,15 @@ func (r *EndorserResult) HasChanged(x, y *EndorserResultState) (bool, error) {
 		return false, fmt.Errorf("y is not a valid state for endorser result: %w", err)
 	}
 
+	hasChanged, err := HasGlobalChanged(&r.GlobalDependency, x.GlobalDependency, y.GlobalDependency)
+	if err != nil {
+		return false, err
+	}
+
+	if hasChanged {
+		return true, nil
+	}
+
 	for _, dependency := range r.Dependencies {
 		xd := x.AddrDependencies[dependency.Addr]
 		yd := y.AddrDependencies[dependency.Addr]
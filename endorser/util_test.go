@@ -0,0 +1,85 @@
+package endorser_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasChangedGlobal(t *testing.T) {
+	state := func(number, basefee int64) *endorser.EndorserResultState {
+		return &endorser.EndorserResultState{
+			GlobalDependency: &endorser.GlobalDependencyState{
+				Basefee:  big.NewInt(basefee),
+				Chainid:  big.NewInt(1),
+				Coinbase: common.HexToAddress("0x000000000000000000000000000000000000c0de"),
+				Number:   big.NewInt(number),
+			},
+			AddrDependencies: map[common.Address]*endorser.AddrDependencyState{},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		dep      endorser.GlobalDependency
+		x, y     *endorser.EndorserResultState
+		expected bool
+	}{
+		{
+			name:     "no global dependency",
+			dep:      endorser.GlobalDependency{},
+			x:        state(1, 10),
+			y:        state(2, 11),
+			expected: false,
+		},
+		{
+			name:     "undeclared field changed",
+			dep:      endorser.GlobalDependency{ChainId: true, CoinBase: true},
+			x:        state(1, 10),
+			y:        state(2, 11),
+			expected: false,
+		},
+		{
+			name:     "number changed",
+			dep:      endorser.GlobalDependency{Number: true},
+			x:        state(1, 10),
+			y:        state(2, 10),
+			expected: true,
+		},
+		{
+			name:     "basefee unchanged",
+			dep:      endorser.GlobalDependency{BaseFee: true},
+			x:        state(1, 10),
+			y:        state(2, 10),
+			expected: false,
+		},
+		{
+			// The blob base fee is never known
+			name:     "unknown value",
+			dep:      endorser.GlobalDependency{BlobBaseFee: true},
+			x:        state(1, 10),
+			y:        state(1, 10),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &endorser.EndorserResult{GlobalDependency: tt.dep}
+			changed, err := r.HasChanged(tt.x, tt.y)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, changed)
+		})
+	}
+}
+
+func TestHasChangedGlobalMissingState(t *testing.T) {
+	r := &endorser.EndorserResult{GlobalDependency: endorser.GlobalDependency{Timestamp: true}}
+	x := &endorser.EndorserResultState{AddrDependencies: map[common.Address]*endorser.AddrDependencyState{}}
+
+	_, err := r.HasChanged(x, x)
+	assert.Error(t, err)
+}
@@ -30,7 +30,7 @@ func (e *EndorserResult) UseDependency(address common.Address) *Dependency {
 	}
 	e.Dependencies = append(e.Dependencies, dep)
 
-	return &dep
+	return &e.Dependencies[len(e.Dependencies)-1]
 }
 
 func (e *EndorserResult) UseGlobalDependency() *GlobalDependency {
@@ -47,6 +47,11 @@ func (e *EndorserResult) SetCode(address common.Address, enabled bool) {
 	dep.Code = enabled
 }
 
+func (e *EndorserResult) SetNonce(address common.Address, enabled bool) {
+	dep := e.UseDependency(address)
+	dep.Nonce = enabled
+}
+
 func (e *EndorserResult) SetStorageSlot(address common.Address, slot [32]byte, enabled bool) {
 	dep := e.UseDependency(address)
 
@@ -102,6 +107,8 @@ func (e *EndorserResult) SetBasefee(enabled bool) {
 	dep.BaseFee = enabled
 }
 
+// Or merges the dependencies of both results, the readiness is the one
+// of e1, e2 only adds the dependencies, e.g. derived from a trace
 func (e1 *EndorserResult) Or(e2 *EndorserResult) *EndorserResult {
 	if e1 == nil {
 		return e2
@@ -114,11 +121,11 @@ func (e1 *EndorserResult) Or(e2 *EndorserResult) *EndorserResult {
 	e3 := &EndorserResult{}
 
 	e3.WildcardOnly = e1.WildcardOnly || e2.WildcardOnly
-	e3.Readiness = e1.Readiness && e2.Readiness
+	e3.Readiness = e1.Readiness
 	e3.GlobalDependency = CombineGlobalDependency(e1.GlobalDependency, e2.GlobalDependency)
 	e3.Dependencies = CombineDependencies(e1.Dependencies, e2.Dependencies)
 
-	return e1
+	return e3
 }
 
 func CombineGlobalDependency(d1 GlobalDependency, d2 GlobalDependency) GlobalDependency {
@@ -197,10 +204,13 @@ func CombineDependency(d1 *Dependency, d2 *Dependency) *Dependency {
 	}
 
 	d3 := &Dependency{
-		Addr:    d1.Addr,
-		Balance: d1.Balance || d2.Balance,
-		Code:    d1.Code || d2.Code,
-		Slots:   CombineSlots(d1.Slots, d2.Slots),
+		Addr:        d1.Addr,
+		Balance:     d1.Balance || d2.Balance,
+		Code:        d1.Code || d2.Code,
+		Nonce:       d1.Nonce || d2.Nonce,
+		AllSlots:    d1.AllSlots || d2.AllSlots,
+		Slots:       CombineSlots(d1.Slots, d2.Slots),
+		Constraints: append(append([]Constraint{}, d1.Constraints...), d2.Constraints...),
 	}
 
 	return d3
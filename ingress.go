@@ -2,24 +2,48 @@ package bundler
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/endorser"
 	"github.com/0xsequence/bundler/lib/collector"
+	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/mempool"
 	"github.com/0xsequence/bundler/p2p"
 	"github.com/0xsequence/bundler/proto"
 	"github.com/go-chi/httplog/v2"
+	lru "github.com/hashicorp/golang-lru/v2"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	DefaultIngressSize    = 1000
+	DefaultIngressWorkers = 8
+
+	// Operations whose first-seen provenance is remembered
+	provenanceCacheSize = 10000
+
+	// Announcements from further in the future are ignored
+	maxAnnouncementSkew = time.Minute
+)
+
+// Provenance is where an operation was first seen, announcements
+// without an envelope have no announcer
+type Provenance struct {
+	Announcer   string
+	AnnouncedAt time.Time
+	Relayer     peer.ID
+	ReceivedAt  time.Time
+}
+
 type ingressMetrics struct {
 	pendingOps prometheus.Gauge
+	queueDepth prometheus.Gauge
 
 	processTime prometheus.Histogram
 
@@ -28,18 +52,39 @@ type ingressMetrics struct {
 
 	dropReasonUnmarshal    prometheus.Labels
 	dropReasonFromProto    prometheus.Labels
+	dropReasonVersion      prometheus.Labels
+	dropReasonSignature    prometheus.Labels
+	dropReasonTimestamp    prometheus.Labels
 	dropReasonLowFee       prometheus.Labels
 	dropReasonErrorPayment prometheus.Labels
+	dropReasonKnown        prometheus.Labels
+	dropReasonRegistry     prometheus.Labels
+	dropReasonQueueFull    prometheus.Labels
+	dropReasonShed         prometheus.Labels
 	dropReasonMempool      prometheus.Labels
+	dropReasonProvider     prometheus.Labels
+	dropReasonEndorser     prometheus.Labels
+	dropReasonNotReady     prometheus.Labels
 }
 
+// Ingress receives operations from the network, the stateless checks run
+// in the pubsub validator, and the endorser validation runs in a bounded
+// pool of workers, so the validator never waits for the RPC. Operations are
+// ignored by the validator and relayed again once the endorser accepts them,
+// so only validated operations propagate.
 type Ingress struct {
 	logger  *httplog.Logger
 	metrics *ingressMetrics
 
+	queue   *ingressQueue
+	workers int
+
+	provenance *lru.Cache[string, *Provenance]
+
 	Host      p2p.Interface
 	Mempool   mempool.Interface
 	Collector collector.Interface
+	Registry  registry.Interface
 }
 
 func createIngressMetrics(reg prometheus.Registerer) *ingressMetrics {
@@ -50,7 +95,12 @@ func createIngressMetrics(reg prometheus.Registerer) *ingressMetrics {
 
 	pendingOps := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "ingress_pending_ops",
-		Help: "Number of operations pending",
+		Help: "Number of operations being validated by the endorser",
+	})
+
+	queueDepth := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ingress_queue_depth",
+		Help: "Number of operations waiting for the endorser validation",
 	})
 
 	droppedOps := prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -60,7 +110,7 @@ func createIngressMetrics(reg prometheus.Registerer) *ingressMetrics {
 
 	processTime := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name:    "ingress_process_time",
-		Help:    "Time it takes to process an operation",
+		Help:    "Time it takes to validate an operation with the endorser",
 		Buckets: prometheus.DefBuckets,
 	})
 
@@ -68,6 +118,7 @@ func createIngressMetrics(reg prometheus.Registerer) *ingressMetrics {
 		reg.MustRegister(
 			acceptedOps,
 			pendingOps,
+			queueDepth,
 			droppedOps,
 			processTime,
 		)
@@ -76,14 +127,25 @@ func createIngressMetrics(reg prometheus.Registerer) *ingressMetrics {
 	return &ingressMetrics{
 		acceptedOps: acceptedOps,
 		pendingOps:  pendingOps,
+		queueDepth:  queueDepth,
 		droppedOps:  droppedOps,
 		processTime: processTime,
 
 		dropReasonUnmarshal:    prometheus.Labels{"reason": "unmarshal"},
 		dropReasonFromProto:    prometheus.Labels{"reason": "from_proto"},
+		dropReasonVersion:      prometheus.Labels{"reason": "version"},
+		dropReasonSignature:    prometheus.Labels{"reason": "signature"},
+		dropReasonTimestamp:    prometheus.Labels{"reason": "timestamp"},
 		dropReasonLowFee:       prometheus.Labels{"reason": "low_fee"},
 		dropReasonErrorPayment: prometheus.Labels{"reason": "error_payment"},
+		dropReasonKnown:        prometheus.Labels{"reason": "known"},
+		dropReasonRegistry:     prometheus.Labels{"reason": "registry"},
+		dropReasonQueueFull:    prometheus.Labels{"reason": "queue_full"},
+		dropReasonShed:         prometheus.Labels{"reason": "shed"},
 		dropReasonMempool:      prometheus.Labels{"reason": "mempool"},
+		dropReasonProvider:     prometheus.Labels{"reason": "provider"},
+		dropReasonEndorser:     prometheus.Labels{"reason": "endorser"},
+		dropReasonNotReady:     prometheus.Labels{"reason": "not_ready"},
 	}
 }
 
@@ -93,82 +155,265 @@ func NewIngress(
 	metrics prometheus.Registerer,
 	mempool mempool.Interface,
 	collector collector.Interface,
+	registry registry.Interface,
 	host p2p.Interface,
 ) *Ingress {
+	size := int(cfg.IngressSize)
+	if size == 0 {
+		size = DefaultIngressSize
+	}
+
+	workers := int(cfg.IngressWorkers)
+	if workers == 0 {
+		workers = DefaultIngressWorkers
+	}
+
+	provenance, _ := lru.New[string, *Provenance](provenanceCacheSize)
+
 	return &Ingress{
 		logger:  logger,
 		metrics: createIngressMetrics(metrics),
 
+		queue:   newIngressQueue(size),
+		workers: workers,
+
+		provenance: provenance,
+
 		Host:      host,
 		Mempool:   mempool,
 		Collector: collector,
+		Registry:  registry,
 	}
 }
 
 func (i *Ingress) registerHandler(ctx context.Context) {
-	i.Host.HandleTopic(ctx, p2p.OperationTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
-		i.metrics.pendingOps.Inc()
-		i.logger.Info("ingress: received operation")
+	i.Host.HandleTopic(ctx, p2p.OperationTopic, i.handleGossip)
 
-		start := time.Now()
+	i.logger.Info("ingress: handler registered")
+}
 
-		defer func() {
-			i.metrics.pendingOps.Dec()
-			i.metrics.processTime.Observe(time.Since(start).Seconds())
-		}()
+// handleGossip queues operations received from the operations topic,
+// they are relayed again once the endorser accepts them
+func (i *Ingress) handleGossip(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+	return i.handleOperation(ctx, p, data, true)
+}
 
-		// Try to parse the operation
-		var protoOp proto.Operation
-		err := json.Unmarshal(data, &protoOp)
-		if err != nil {
-			i.metrics.droppedOps.With(i.metrics.dropReasonUnmarshal).Inc()
-			i.logger.Warn("invalid operation message - parse proto", "err", err)
+// HandleOperation runs the stateless checks on an operation fetched from a peer
+// outside of gossip and queues it for the endorser validation, it is not relayed.
+func (i *Ingress) HandleOperation(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+	return i.handleOperation(ctx, p, data, false)
+}
+
+// handleOperation runs the stateless checks and queues the operation, queued
+// operations are ignored since the endorser has not validated them yet.
+func (i *Ingress) handleOperation(ctx context.Context, p peer.ID, data []byte, relay bool) pubsub.ValidationResult {
+	i.logger.Info("ingress: received operation")
+
+	// Try to parse the announcement, newer versions may be
+	// valid for peers that understand them, so only ignore them
+	announcement, err := types.ParseAnnouncement(data)
+	if errors.Is(err, types.ErrUnsupportedAnnouncement) {
+		i.metrics.droppedOps.With(i.metrics.dropReasonVersion).Inc()
+		i.logger.Debug("ingress: unsupported announcement", "err", err)
+		return pubsub.ValidationIgnore
+	}
+	if err != nil {
+		i.metrics.droppedOps.With(i.metrics.dropReasonUnmarshal).Inc()
+		i.logger.Warn("invalid operation message - parse proto", "err", err)
+		i.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+		return pubsub.ValidationReject
+	}
+
+	if announcement.Signed() {
+		if err := announcement.Verify(); err != nil {
+			i.metrics.droppedOps.With(i.metrics.dropReasonSignature).Inc()
+			i.logger.Warn("invalid operation message - signature", "announcer", announcement.Announcer, "err", err)
+			i.Host.ReportPeer(p, p2p.PeerInvalidMessage)
 			return pubsub.ValidationReject
 		}
 
-		// Try to convert the operation
-		op, err := types.NewOperationFromProto(&protoOp)
-		if err != nil {
-			i.metrics.droppedOps.With(i.metrics.dropReasonFromProto).Inc()
-			i.logger.Warn("invalid operation message - parse operation", "err", err)
-			return pubsub.ValidationReject
+		if time.Unix(int64(announcement.Timestamp), 0).After(time.Now().Add(maxAnnouncementSkew)) {
+			i.metrics.droppedOps.With(i.metrics.dropReasonTimestamp).Inc()
+			i.logger.Info("ingress: announcement from the future", "announcer", announcement.Announcer, "time", announcement.Timestamp)
+			return pubsub.ValidationIgnore
+		}
+	}
+
+	// Try to convert the operation
+	op, err := types.NewOperationFromProto(announcement.Operation)
+	if err != nil {
+		i.metrics.droppedOps.With(i.metrics.dropReasonFromProto).Inc()
+		i.logger.Warn("invalid operation message - parse operation", "err", err)
+		i.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+		return pubsub.ValidationReject
+	}
+
+	// Pass it trough the collector, since
+	// it can quickly reject it if it doesn't
+	// pay enough fees. Don't reject it, only ignore it
+	// since it may be a valid operation.
+	if err := i.Collector.ValidatePayment(op); err != nil {
+		if errors.Is(err, collector.InsufficientFeeError) {
+			i.logger.Info("ingress: insufficient fee", "err", err)
+			i.metrics.droppedOps.With(i.metrics.dropReasonLowFee).Inc()
+			return pubsub.ValidationIgnore
+		} else {
+			i.metrics.droppedOps.With(i.metrics.dropReasonErrorPayment).Inc()
+			return pubsub.ValidationIgnore
 		}
+	}
+
+	oph := op.Hash()
+	if i.Mempool.IsKnownOp(op) || i.queue.has(oph) {
+		i.metrics.droppedOps.With(i.metrics.dropReasonKnown).Inc()
+		return pubsub.ValidationIgnore
+	}
+
+	if !i.Registry.IsAcceptedEndorser(op.Endorser) {
+		i.metrics.droppedOps.With(i.metrics.dropReasonRegistry).Inc()
+		i.logger.Info("ingress: endorser not accepted", "op", oph, "endorser", op.Endorser)
+		return pubsub.ValidationIgnore
+	}
 
-		// Pass it trough the collector, since
-		// it can quickly reject it if it doesn't
-		// pay enough fees. Don't reject it, only ignore it
-		// since it may be a valid operation.
-		if err := i.Collector.ValidatePayment(op); err != nil {
-			if errors.Is(err, collector.InsufficientFeeError) {
-				i.logger.Info("%v", err)
-				i.metrics.droppedOps.With(i.metrics.dropReasonLowFee).Inc()
-				return pubsub.ValidationIgnore
-			} else {
-				i.metrics.droppedOps.With(i.metrics.dropReasonErrorPayment).Inc()
-				return pubsub.ValidationIgnore
-			}
+	fees, _ := i.Collector.NativeFeesPerGas(op)
+	job := &ingressJob{op: op, hash: oph, peer: p, fees: fees}
+	if relay {
+		job.announcement = announcement
+	}
+
+	ok, shed := i.queue.push(job)
+	if shed != nil {
+		i.metrics.droppedOps.With(i.metrics.dropReasonShed).Inc()
+		i.logger.Info("ingress: queue full, shed operation", "op", shed.hash)
+	}
+	i.metrics.queueDepth.Set(float64(i.queue.len()))
+
+	if !ok {
+		i.metrics.droppedOps.With(i.metrics.dropReasonQueueFull).Inc()
+		i.logger.Info("ingress: queue full, dropped operation", "op", job.hash)
+		return pubsub.ValidationIgnore
+	}
+
+	i.recordProvenance(job.hash, p, announcement)
+	return pubsub.ValidationIgnore
+}
+
+// recordProvenance remembers who announced an operation the first time it was seen
+func (i *Ingress) recordProvenance(oph string, p peer.ID, announcement *types.Announcement) {
+	provenance := &Provenance{
+		Relayer:    p,
+		ReceivedAt: time.Now(),
+	}
+
+	if announcement.Signed() {
+		provenance.Announcer = announcement.Announcer
+		provenance.AnnouncedAt = time.Unix(int64(announcement.Timestamp), 0)
+	}
+
+	i.provenance.ContainsOrAdd(oph, provenance)
+}
+
+// Provenance returns where the operation was first seen, if it is remembered
+func (i *Ingress) Provenance(oph string) (*Provenance, bool) {
+	return i.provenance.Get(oph)
+}
+
+func (p *Provenance) ToProto() *proto.OperationProvenance {
+	provenance := &proto.OperationProvenance{
+		Announcer:  p.Announcer,
+		Relayer:    p.Relayer.String(),
+		ReceivedAt: p.ReceivedAt,
+	}
+
+	if p.Announcer != "" {
+		announcedAt := p.AnnouncedAt
+		provenance.AnnouncedAt = &announcedAt
+	}
+
+	return provenance
+}
+
+func (i *Ingress) runWorker(ctx context.Context) {
+	for {
+		job := i.queue.pop(ctx)
+		if job == nil {
+			return
 		}
 
-		// If the mempool reject it, only ignore it
-		// as it may be a valid operation, our mempool
-		// may be full or the operation may have been invalidated
-		// in flight.
-		err = i.Mempool.AddOperation(ctx, op, false)
-		if err != nil {
+		i.metrics.queueDepth.Set(float64(i.queue.len()))
+		i.process(ctx, job)
+	}
+}
+
+func (i *Ingress) process(ctx context.Context, job *ingressJob) {
+	i.metrics.pendingOps.Inc()
+	start := time.Now()
+
+	defer func() {
+		i.metrics.pendingOps.Dec()
+		i.metrics.processTime.Observe(time.Since(start).Seconds())
+	}()
+
+	op := job.op
+
+	// If the mempool reject it, only ignore it
+	// as it may be a valid operation, our mempool
+	// may be full or the operation may have been invalidated
+	// in flight.
+	err := i.Mempool.AddOperation(mempool.WithSource(ctx, job.peer.String()), op, false)
+	if err != nil {
+		switch {
+		case errors.Is(err, endorser.ErrProvider):
+			// Our node failed, the operation was never evaluated
+			i.metrics.droppedOps.With(i.metrics.dropReasonProvider).Inc()
+			i.logger.Warn("ingress: unable to evaluate operation", "error", err, "op", job.hash)
+		case errors.Is(err, endorser.ErrReverted), errors.Is(err, endorser.ErrOutOfGas), errors.Is(err, endorser.ErrMalformedResult):
+			i.metrics.droppedOps.With(i.metrics.dropReasonEndorser).Inc()
+			i.logger.Info("ingress: endorser failed", "error", err, "kind", endorser.ErrorKind(err), "op", job.hash, "endorser", op.Endorser)
+			i.Host.ReportPeer(job.peer, p2p.PeerInvalidOperation)
+		case errors.Is(err, endorser.ErrNotReady):
+			i.metrics.droppedOps.With(i.metrics.dropReasonNotReady).Inc()
+			i.logger.Info("ingress: operation not ready", "op", job.hash)
+		default:
 			i.metrics.droppedOps.With(i.metrics.dropReasonMempool).Inc()
-			i.logger.Info("ingress: rejected by the mempool", "error", err, "op", op.Hash())
-			return pubsub.ValidationIgnore
+			i.logger.Info("ingress: rejected by the mempool", "error", err, "op", job.hash)
 		}
+		return
+	}
 
-		i.metrics.acceptedOps.Inc()
-		return pubsub.ValidationAccept
-	})
+	i.metrics.acceptedOps.Inc()
+	i.Host.TrackOperation(job.peer, job.hash, op.Endorser)
 
-	i.logger.Info("ingress: handler registered")
+	if job.announcement != nil {
+		i.relay(ctx, job)
+	}
+}
+
+// relay broadcasts an operation the endorser accepted, signed announcements
+// are relayed untouched so the announcer can still be verified
+func (i *Ingress) relay(ctx context.Context, job *ingressJob) {
+	var payload interface{} = job.announcement.Operation
+	if job.announcement.Signed() {
+		payload = job.announcement
+	}
+
+	if err := i.Host.Broadcast(ctx, p2p.OperationTopic, payload); err != nil {
+		i.logger.Warn("ingress: unable to relay operation", "op", job.hash, "err", err)
+	}
 }
 
 func (i *Ingress) Run(ctx context.Context) error {
 	i.registerHandler(ctx)
 
+	var wg sync.WaitGroup
+	for w := 0; w < i.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.runWorker(ctx)
+		}()
+	}
+
+	wg.Wait()
 	return nil
 }
@@ -0,0 +1,145 @@
+package bundler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/0xsequence/bundler/lib/collector"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ingressJob is an operation that passed the stateless checks
+// and is waiting for the endorser validation, the announcement
+// is only kept if the operation must be relayed afterwards
+type ingressJob struct {
+	op   *types.Operation
+	hash string
+	peer peer.ID
+	fees *collector.NativeFees
+
+	announcement *types.Announcement
+}
+
+// ingressQueue is a bounded queue of operations, workers take the
+// operation paying the most first, and when it is full the operation
+// paying the least is shed to make room for a better one.
+type ingressQueue struct {
+	lock   sync.Mutex
+	size   int
+	jobs   []*ingressJob
+	hashes map[string]struct{}
+	ready  chan struct{}
+}
+
+func newIngressQueue(size int) *ingressQueue {
+	return &ingressQueue{
+		size:   size,
+		hashes: make(map[string]struct{}, size),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// cmpFees compares the relay value of two jobs
+func cmpFees(a, b *ingressJob) int {
+	if c := a.fees.MaxFeePerGas.Cmp(b.fees.MaxFeePerGas); c != 0 {
+		return c
+	}
+
+	return a.fees.MaxPriorityFeePerGas.Cmp(b.fees.MaxPriorityFeePerGas)
+}
+
+// push adds the job to the queue, it returns false if the job was
+// already queued or if it pays too little to enter a full queue,
+// and the job that was shed to make room for it, if any.
+func (q *ingressQueue) push(job *ingressJob) (bool, *ingressJob) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.hashes[job.hash]; ok {
+		return false, nil
+	}
+
+	var shed *ingressJob
+	if len(q.jobs) >= q.size {
+		lowest := 0
+		for i, j := range q.jobs {
+			if cmpFees(j, q.jobs[lowest]) < 0 {
+				lowest = i
+			}
+		}
+
+		if cmpFees(job, q.jobs[lowest]) <= 0 {
+			return false, nil
+		}
+
+		shed = q.remove(lowest)
+	}
+
+	q.jobs = append(q.jobs, job)
+	q.hashes[job.hash] = struct{}{}
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+
+	return true, shed
+}
+
+// pop blocks until there is a job or the context is done,
+// jobs that pay the same are taken in arrival order
+func (q *ingressQueue) pop(ctx context.Context) *ingressJob {
+	for {
+		q.lock.Lock()
+		if len(q.jobs) != 0 {
+			highest := 0
+			for i, j := range q.jobs {
+				if cmpFees(j, q.jobs[highest]) > 0 {
+					highest = i
+				}
+			}
+
+			job := q.remove(highest)
+
+			// Wake up the next worker if there is more work
+			if len(q.jobs) != 0 {
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+
+			q.lock.Unlock()
+			return job
+		}
+		q.lock.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (q *ingressQueue) remove(i int) *ingressJob {
+	job := q.jobs[i]
+	q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+	delete(q.hashes, job.hash)
+	return job
+}
+
+func (q *ingressQueue) has(hash string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	_, ok := q.hashes[hash]
+	return ok
+}
+
+func (q *ingressQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.jobs)
+}
@@ -0,0 +1,278 @@
+package bundler_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xsequence/bundler"
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
+	"github.com/0xsequence/bundler/lib/collector"
+	"github.com/0xsequence/bundler/lib/mocks"
+	"github.com/0xsequence/bundler/lib/pricefeed"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/bundler/p2p"
+	"github.com/go-chi/httplog/v2"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func ingressOp(fee int64) *types.Operation {
+	return &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data:                   []byte{0x01},
+			FixedGas:               big.NewInt(0),
+			GasLimit:               big.NewInt(100000),
+			EndorserCallData:       []byte{0x02},
+			MaxFeePerGas:           big.NewInt(fee),
+			MaxPriorityFeePerGas:   big.NewInt(fee),
+			FeeScalingFactor:       big.NewInt(1),
+			FeeNormalizationFactor: big.NewInt(1),
+		},
+		EndorserGasLimit: big.NewInt(100000),
+		ChainId:          big.NewInt(1),
+	}
+}
+
+func hasFee(fee int64) interface{} {
+	return mock.MatchedBy(func(op *types.Operation) bool {
+		return op.MaxFeePerGas.Int64() == fee
+	})
+}
+
+func TestIngressShedsLowestFee(t *testing.T) {
+	host := &mocks.MockP2p{}
+	mempool := &mocks.MockMempool{}
+	collectr := &mocks.MockCollector{}
+	registry := &mocks.MockRegistry{}
+
+	cfg := &config.MempoolConfig{IngressSize: 2, IngressWorkers: 1}
+	ingress := bundler.NewIngress(cfg, httplog.NewLogger(""), nil, mempool, collectr, registry, host)
+
+	var handler p2p.MsgHandler
+	registered := make(chan struct{})
+	host.On("HandleTopic", mock.Anything, p2p.OperationTopic, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(2).(p2p.MsgHandler)
+		close(registered)
+	}).Return(nil).Once()
+
+	collectr.On("ValidatePayment", mock.Anything).Return(nil)
+	mempool.On("IsKnownOp", mock.Anything).Return(false)
+	registry.On("IsAcceptedEndorser", mock.Anything).Return(true)
+	host.On("TrackOperation", mock.Anything, mock.Anything, mock.Anything).Return()
+	var relayed atomic.Int32
+	host.On("Broadcast", mock.Anything, p2p.OperationTopic, mock.Anything).Run(func(args mock.Arguments) {
+		relayed.Add(1)
+	}).Return(nil)
+
+	for _, fee := range []int64{1, 2, 3, 5, 10} {
+		collectr.On("NativeFeesPerGas", hasFee(fee)).Return(&collector.NativeFees{
+			MaxFeePerGas:         big.NewInt(fee),
+			MaxPriorityFeePerGas: big.NewInt(fee),
+		}, (*pricefeed.Snapshot)(nil))
+	}
+
+	// The first operation keeps the only worker busy
+	var lock sync.Mutex
+	var processed []int64
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mempool.On("AddOperation", mock.Anything, mock.Anything, false).Run(func(args mock.Arguments) {
+		op := args.Get(1).(*types.Operation)
+
+		lock.Lock()
+		processed = append(processed, op.MaxFeePerGas.Int64())
+		first := len(processed) == 1
+		lock.Unlock()
+
+		if first {
+			close(started)
+			<-release
+		}
+	}).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ingress.Run(ctx)
+		close(done)
+	}()
+	<-registered
+
+	send := func(fee int64) pubsub.ValidationResult {
+		data, err := json.Marshal(ingressOp(fee).ToProtoPure())
+		require.NoError(t, err)
+		return handler(ctx, peer.ID("peer"), data)
+	}
+
+	// Queued operations are ignored until the endorser validates them
+	assert.Equal(t, pubsub.ValidationIgnore, send(10))
+	<-started
+
+	assert.Equal(t, pubsub.ValidationIgnore, send(2))
+	assert.Equal(t, pubsub.ValidationIgnore, send(5))
+
+	// The queue is full, the operation paying 2 is shed
+	assert.Equal(t, pubsub.ValidationIgnore, send(3))
+
+	// Pays less than everything in the queue
+	assert.Equal(t, pubsub.ValidationIgnore, send(1))
+
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(processed) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	assert.Equal(t, []int64{10, 5, 3}, processed)
+	lock.Unlock()
+
+	// Only the validated operations are relayed
+	assert.Eventually(t, func() bool {
+		return relayed.Load() == 3
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestIngressStatelessChecks(t *testing.T) {
+	host := &mocks.MockP2p{}
+	mempool := &mocks.MockMempool{}
+	collectr := &mocks.MockCollector{}
+	registry := &mocks.MockRegistry{}
+
+	ingress := bundler.NewIngress(&config.MempoolConfig{}, httplog.NewLogger(""), nil, mempool, collectr, registry, host)
+
+	var handler p2p.MsgHandler
+	registered := make(chan struct{})
+	host.On("HandleTopic", mock.Anything, p2p.OperationTopic, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(2).(p2p.MsgHandler)
+		close(registered)
+	}).Return(nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go ingress.Run(ctx)
+	<-registered
+
+	// Malformed messages are rejected and reported
+	host.On("ReportPeer", peer.ID("peer"), p2p.PeerInvalidMessage).Return().Once()
+	assert.Equal(t, pubsub.ValidationReject, handler(ctx, peer.ID("peer"), []byte("{")))
+
+	data, err := json.Marshal(ingressOp(1).ToProtoPure())
+	require.NoError(t, err)
+
+	collectr.On("ValidatePayment", mock.Anything).Return(collector.InsufficientFeeError).Once()
+	assert.Equal(t, pubsub.ValidationIgnore, handler(ctx, peer.ID("peer"), data))
+
+	collectr.On("ValidatePayment", mock.Anything).Return(nil)
+
+	mempool.On("IsKnownOp", mock.Anything).Return(true).Once()
+	assert.Equal(t, pubsub.ValidationIgnore, handler(ctx, peer.ID("peer"), data))
+
+	mempool.On("IsKnownOp", mock.Anything).Return(false)
+	registry.On("IsAcceptedEndorser", mock.Anything).Return(false).Once()
+	assert.Equal(t, pubsub.ValidationIgnore, handler(ctx, peer.ID("peer"), data))
+
+	// Nothing reached the endorser validation
+	mempool.AssertNotCalled(t, "AddOperation", mock.Anything, mock.Anything, mock.Anything)
+	host.AssertExpectations(t)
+}
+
+func TestIngressAnnouncements(t *testing.T) {
+	host := &mocks.MockP2p{}
+	mempool := &mocks.MockMempool{}
+	collectr := &mocks.MockCollector{}
+	registry := &mocks.MockRegistry{}
+
+	ingress := bundler.NewIngress(&config.MempoolConfig{}, httplog.NewLogger(""), nil, mempool, collectr, registry, host)
+
+	collectr.On("ValidatePayment", mock.Anything).Return(nil)
+	collectr.On("NativeFeesPerGas", mock.Anything).Return(&collector.NativeFees{
+		MaxFeePerGas:         big.NewInt(1),
+		MaxPriorityFeePerGas: big.NewInt(1),
+	}, (*pricefeed.Snapshot)(nil))
+	mempool.On("IsKnownOp", mock.Anything).Return(false)
+	registry.On("IsAcceptedEndorser", mock.Anything).Return(true)
+
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	announcer, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	relayer := peer.ID("relayer")
+
+	// Signed by the announcer
+	op := ingressOp(1)
+	announcement, err := types.NewAnnouncement(op, announcer.String(), priv.Sign)
+	require.NoError(t, err)
+	require.NoError(t, announcement.Verify())
+
+	data, err := json.Marshal(announcement)
+	require.NoError(t, err)
+	assert.Equal(t, pubsub.ValidationIgnore, ingress.HandleOperation(ctx, relayer, data))
+
+	provenance, ok := ingress.Provenance(op.Hash())
+	require.True(t, ok)
+	assert.Equal(t, announcer.String(), provenance.Announcer)
+	assert.Equal(t, relayer, provenance.Relayer)
+	assert.Equal(t, int64(announcement.Timestamp), provenance.AnnouncedAt.Unix())
+
+	view := provenance.ToProto()
+	assert.Equal(t, announcer.String(), view.Announcer)
+	assert.Equal(t, relayer.String(), view.Relayer)
+	require.NotNil(t, view.AnnouncedAt)
+
+	// Already queued, the first provenance is kept
+	assert.Equal(t, pubsub.ValidationIgnore, ingress.HandleOperation(ctx, peer.ID("other"), data))
+	provenance, _ = ingress.Provenance(op.Hash())
+	assert.Equal(t, relayer, provenance.Relayer)
+
+	// Tampered after being signed
+	tampered, err := types.NewAnnouncement(ingressOp(2), announcer.String(), priv.Sign)
+	require.NoError(t, err)
+	tampered.Operation = ingressOp(3).ToProtoPure()
+
+	data, err = json.Marshal(tampered)
+	require.NoError(t, err)
+	host.On("ReportPeer", relayer, p2p.PeerInvalidMessage).Return().Once()
+	assert.Equal(t, pubsub.ValidationReject, ingress.HandleOperation(ctx, relayer, data))
+
+	// Newer versions are not understood, but they may be fine
+	future := *announcement
+	future.Version = types.AnnouncementVersion + 1
+	data, err = json.Marshal(&future)
+	require.NoError(t, err)
+	assert.Equal(t, pubsub.ValidationIgnore, ingress.HandleOperation(ctx, relayer, data))
+
+	// Bare operations have no announcer
+	legacy := ingressOp(5)
+	data, err = json.Marshal(legacy.ToProtoPure())
+	require.NoError(t, err)
+	assert.Equal(t, pubsub.ValidationIgnore, ingress.HandleOperation(ctx, relayer, data))
+
+	provenance, ok = ingress.Provenance(legacy.Hash())
+	require.True(t, ok)
+	assert.Empty(t, provenance.Announcer)
+	assert.Equal(t, relayer, provenance.Relayer)
+	assert.Nil(t, provenance.ToProto().AnnouncedAt)
+
+	host.AssertExpectations(t)
+}
@@ -1,5 +1,8 @@
 package ipfs
 
+import "context"
+
 type Interface interface {
 	Report(data []byte) (string, error)
+	Fetch(ctx context.Context, cid string) ([]byte, error)
 }
@@ -2,11 +2,13 @@ package ipfs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"time"
 
 	chunker "github.com/ipfs/boxo/chunker"
@@ -15,6 +17,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// maxFetchSize bounds the content read from IPFS
+const maxFetchSize = 16 << 20 // 16MB
+
 type Client struct {
 	metrics *metrics
 
@@ -46,7 +51,8 @@ func (ipfs *Client) Report(data []byte) (string, error) {
 		ipfsurl += "/"
 	}
 
-	url := ipfsurl + "api/v0/add?cid-version=1"
+	// Same chunker as Cid, so the CIDs of the content match
+	url := ipfsurl + "api/v0/add?cid-version=1&raw-leaves=true&chunker=size-1048576"
 
 	// Prepare the file to upload
 	body := &bytes.Buffer{}
@@ -109,6 +115,61 @@ func (ipfs *Client) Report(data []byte) (string, error) {
 	return res.Hash, nil
 }
 
+// Fetch reads the content of the cid, up to maxFetchSize bytes
+func (ipfs *Client) Fetch(ctx context.Context, cid string) ([]byte, error) {
+	if ipfs == nil {
+		return nil, fmt.Errorf("ipfs url not set")
+	}
+
+	if !IsCid(cid) {
+		return nil, fmt.Errorf("invalid cid %q", cid)
+	}
+
+	start := time.Now()
+
+	ipfsurl := string(ipfs.Url)
+	if ipfsurl[len(ipfsurl)-1] != '/' {
+		ipfsurl += "/"
+	}
+
+	url := ipfsurl + "api/v0/cat?arg=" + neturl.QueryEscape(cid)
+
+	// The RPC API only accepts POST requests
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		ipfs.metrics.FetchFailed.Inc()
+		return nil, err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		ipfs.metrics.FetchFailed.Inc()
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		ipfs.metrics.FetchFailed.Inc()
+		return nil, fmt.Errorf("unable to fetch %s: status %d", cid, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchSize+1))
+	if err != nil {
+		ipfs.metrics.FetchFailed.Inc()
+		return nil, err
+	}
+
+	if len(data) > maxFetchSize {
+		ipfs.metrics.FetchFailed.Inc()
+		return nil, fmt.Errorf("unable to fetch %s: exceeds %d bytes", cid, maxFetchSize)
+	}
+
+	ipfs.metrics.FetchedTime.Observe(time.Since(start).Seconds())
+
+	return data, nil
+}
+
 func Cid(data []byte) (string, error) {
 	// Create an IPLD UnixFS chunker with size 1 MiB
 	chunks := chunker.NewSizeSplitter(bytes.NewReader(data), 1024*1024)
@@ -7,6 +7,9 @@ type metrics struct {
 	ReportedBytes prometheus.Histogram
 
 	ReportFailed prometheus.Counter
+
+	FetchedTime prometheus.Histogram
+	FetchFailed prometheus.Counter
 }
 
 func createMetrics(reg prometheus.Registerer) *metrics {
@@ -27,13 +30,26 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		Help: "Number of failed reports to IPFS",
 	})
 
+	fetchedTime := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ipfs_fetched_time",
+		Help:    "Time taken to fetch data from IPFS",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	fetchFailed := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_fetch_failed",
+		Help: "Number of failed fetches from IPFS",
+	})
+
 	if reg != nil {
-		reg.MustRegister(reportedTime, ReportedBytes, reportFailed)
+		reg.MustRegister(reportedTime, ReportedBytes, reportFailed, fetchedTime, fetchFailed)
 	}
 
 	return &metrics{
 		ReportedTime:  reportedTime,
 		ReportedBytes: ReportedBytes,
 		ReportFailed:  reportFailed,
+		FetchedTime:   fetchedTime,
+		FetchFailed:   fetchFailed,
 	}
 }
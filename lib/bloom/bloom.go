@@ -0,0 +1,75 @@
+package bloom
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Filter is a Bloom filter of strings, it can tell that a string
+// was never added, but it may report false positives.
+type Filter struct {
+	Bits   []byte `json:"bits"`
+	Hashes uint   `json:"hashes"`
+}
+
+const maxHashes = 32
+
+// New sizes a filter for n entries with the given false positive rate
+func New(n int, fpRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+
+	return &Filter{
+		Bits:   make([]byte, (int(m)+7)/8),
+		Hashes: uint(max(1, min(k, maxHashes))),
+	}
+}
+
+// Validate checks that a filter received from someone else can be used
+func (f *Filter) Validate() error {
+	if len(f.Bits) == 0 {
+		return fmt.Errorf("bloom: empty filter")
+	}
+
+	if f.Hashes == 0 || f.Hashes > maxHashes {
+		return fmt.Errorf("bloom: invalid number of hashes %d", f.Hashes)
+	}
+
+	return nil
+}
+
+func (f *Filter) Add(s string) {
+	m := uint64(len(f.Bits)) * 8
+	h1, h2 := hash(s)
+
+	for i := uint64(0); i < uint64(f.Hashes); i++ {
+		bit := (h1 + i*h2) % m
+		f.Bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (f *Filter) Has(s string) bool {
+	m := uint64(len(f.Bits)) * 8
+	h1, h2 := hash(s)
+
+	for i := uint64(0); i < uint64(f.Hashes); i++ {
+		bit := (h1 + i*h2) % m
+		if f.Bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hash derives the two hashes used for double hashing
+func hash(s string) (uint64, uint64) {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
@@ -0,0 +1,53 @@
+package bloom_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/0xsequence/bundler/lib/bloom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	f := bloom.New(1000, 0.01)
+	require.NoError(t, f.Validate())
+
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("0x%064x", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		assert.True(t, f.Has(fmt.Sprintf("0x%064x", i)))
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if f.Has(fmt.Sprintf("0x%064x", i)) {
+			falsePositives++
+		}
+	}
+
+	assert.Less(t, falsePositives, 300)
+}
+
+func TestFilterJSON(t *testing.T) {
+	f := bloom.New(10, 0.01)
+	f.Add("0x01")
+
+	data, err := json.Marshal(f)
+	require.NoError(t, err)
+
+	var decoded bloom.Filter
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.NoError(t, decoded.Validate())
+
+	assert.True(t, decoded.Has("0x01"))
+	assert.False(t, decoded.Has("0x02"))
+}
+
+func TestFilterValidate(t *testing.T) {
+	assert.Error(t, (&bloom.Filter{}).Validate())
+	assert.Error(t, (&bloom.Filter{Bits: []byte{0}, Hashes: 100}).Validate())
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"log/slog"
+	"math/big"
 	"os"
 	"os/exec"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
 	"github.com/0xsequence/ethkit/go-ethereum/rpc"
 	"github.com/go-chi/httplog/v2"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,6 +23,9 @@ type AnvilDebugger struct {
 	ID     string
 	RpcUrl string
 
+	// ForkBlock pins the fork to a given block, if nil anvil follows the latest block
+	ForkBlock func(ctx context.Context) (*big.Int, error)
+
 	lock    sync.Mutex
 	logger  *slog.Logger
 	metrics *anvilMetrics
@@ -28,6 +33,7 @@ type AnvilDebugger struct {
 
 	client     *rpc.Client
 	cancel     context.CancelFunc
+	exited     chan struct{}
 	ipcAddr    string
 	needsReset bool
 }
@@ -39,6 +45,11 @@ func NewAnvilDebugger(ctx context.Context, logger *httplog.Logger, metrics prome
 		return nil, err
 	}
 
+	return newAnvilDebugger(ctx, logger, createAnvilMetrics(metrics), rpcUrl)
+}
+
+func newAnvilDebugger(ctx context.Context, logger *httplog.Logger, metrics *anvilMetrics, rpcUrl string) (*AnvilDebugger, error) {
+
 	// Generate random hex id
 	id := make([]byte, 8)
 	if _, err := rand.Read(id); err != nil {
@@ -57,7 +68,7 @@ func NewAnvilDebugger(ctx context.Context, logger *httplog.Logger, metrics prome
 		ctx:     ctx,
 		ipcAddr: ipcAddr,
 		logger:  logger2,
-		metrics: createAnvilMetrics(metrics),
+		metrics: metrics,
 
 		RpcUrl: rpcUrl,
 	}, nil
@@ -122,21 +133,40 @@ func (a *AnvilDebugger) startLocked() error {
 		return fmt.Errorf("anvil already started")
 	}
 
-	cmd := exec.Command("anvil", "--fork-url", a.RpcUrl, "--ipc", a.ipcAddr, "--port", "0")
+	args := []string{"--fork-url", a.RpcUrl, "--ipc", a.ipcAddr, "--port", "0"}
+
+	forkBlock, err := a.forkBlock()
+	if err != nil {
+		a.metrics.startFailures.Inc()
+		return err
+	}
+	if forkBlock != nil {
+		args = append(args, "--fork-block-number", forkBlock.String())
+	}
+
+	cmd := exec.Command("anvil", args...)
 	if err := cmd.Start(); err != nil {
 		a.metrics.startFailures.Inc()
 		return err
 	}
 
+	// Only one goroutine can wait for the process,
+	// exited is closed once it is gone
+	exited := make(chan struct{})
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			a.logger.Debug("anvil process exited", "err", err)
+		}
+		close(exited)
+	}()
+
 	endProc := func() {
 		if err := cmd.Process.Kill(); err != nil {
 			a.logger.Warn("Error killing anvil process", "err", err)
 		}
 
 		// Waiting for the process to exit
-		if _, err := cmd.Process.Wait(); err != nil {
-			a.logger.Warn("Error waiting for anvil process to exit", "err", err)
-		}
+		<-exited
 	}
 
 	if !a.waitForIPC(5 * time.Second) {
@@ -156,18 +186,32 @@ func (a *AnvilDebugger) startLocked() error {
 	ctx2, cancel := context.WithCancel(a.ctx)
 	a.cancel = cancel
 
-	// Listen for ctx.Done() and kill the process
+	// Listen for ctx.Done() and kill the process, if the process
+	// exits on its own it is marked as stopped so it can be restarted
 	go func() {
-		<-ctx2.Done()
-		a.logger.Info("anvil stopping...", "ipc", a.ipcAddr)
+		select {
+		case <-ctx2.Done():
+			a.logger.Info("anvil stopping...", "ipc", a.ipcAddr)
+			endProc()
+		case <-exited:
+			a.logger.Warn("anvil exited unexpectedly", "ipc", a.ipcAddr)
+			a.metrics.crashes.Inc()
+		}
 
-		endProc()
-		a.Stop()
+		// The instance may have been restarted in the meantime
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if a.exited == exited {
+			a.stopLocked()
+		}
 	}()
 
 	a.client = rc
-	a.logger.Info("anvil started", "ipc", a.ipcAddr)
+	a.exited = exited
+	a.needsReset = false
+	a.logger.Info("anvil started", "ipc", a.ipcAddr, "fork_block", forkBlock)
 	a.metrics.startSuccesses.Inc()
+	a.metrics.anvilRunning.Inc()
 
 	return nil
 }
@@ -193,6 +237,8 @@ func (a *AnvilDebugger) stopLocked() error {
 
 	a.cancel()
 	a.cancel = nil
+	a.exited = nil
+	a.metrics.anvilRunning.Dec()
 
 	// Try to clean up the ipc file
 	exec.Command("rm", a.ipcAddr).Run()
@@ -218,8 +264,25 @@ func (a *AnvilDebugger) resetLocked() error {
 
 	if a.needsReset {
 		start := time.Now()
-		params := map[string]string{"jsonRpcUrl": a.RpcUrl}
-		err := a.client.Call(nil, "anvil_reset", params)
+
+		forkBlock, err := a.forkBlock()
+		if err != nil {
+			return err
+		}
+
+		var params interface{}
+		if forkBlock != nil {
+			params = map[string]interface{}{
+				"forking": map[string]interface{}{
+					"jsonRpcUrl":  a.RpcUrl,
+					"blockNumber": forkBlock.Uint64(),
+				},
+			}
+		} else {
+			params = map[string]string{"jsonRpcUrl": a.RpcUrl}
+		}
+
+		err = a.client.Call(nil, "anvil_reset", params)
 		if err != nil {
 			return err
 		}
@@ -231,6 +294,47 @@ func (a *AnvilDebugger) resetLocked() error {
 	return nil
 }
 
+func (a *AnvilDebugger) forkBlock() (*big.Int, error) {
+	if a.ForkBlock == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+	defer cancel()
+
+	block, err := a.ForkBlock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get fork block: %w", err)
+	}
+
+	return block, nil
+}
+
+// HealthCheck pings the anvil instance, if it is not running (e.g. it crashed)
+// or it does not respond it is (re)started
+func (a *AnvilDebugger) HealthCheck(ctx context.Context) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.cancel != nil {
+		ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		var res string
+		err := a.client.CallContext(ctx2, &res, "eth_blockNumber")
+		if err == nil {
+			return nil
+		}
+
+		a.metrics.healthCheckFailures.Inc()
+		a.logger.Warn("anvil health check failed, restarting", "ipc", a.ipcAddr, "err", err)
+		a.stopLocked()
+	}
+
+	a.metrics.restarts.Inc()
+	return a.startLocked()
+}
+
 func (a *AnvilDebugger) tryDebugTraceCall(ctx context.Context, args *DebugCallArgs, overrideArgs *DebugOverrideArgs) (*TransactionTrace, error) {
 	if err := a.resetLocked(); err != nil {
 		return nil, err
@@ -243,6 +347,10 @@ func (a *AnvilDebugger) tryDebugTraceCall(ctx context.Context, args *DebugCallAr
 		"data": "0x" + common.Bytes2Hex(args.Data),
 	}
 
+	if args.Gas != 0 {
+		params["gas"] = hexutil.EncodeUint64(args.Gas)
+	}
+
 	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
@@ -275,6 +383,7 @@ func (a *AnvilDebugger) tryDebugTraceCall(ctx context.Context, args *DebugCallAr
 	a.logger.Debug("anvil debug trace call", "duration", time.Since(start), "context duration", time.Since(start_context))
 
 	res.From = args.From
+	res.To = args.To
 
 	return res, nil
 }
@@ -0,0 +1,151 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-chi/httplog/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AnvilPool spreads the traces across multiple anvil instances,
+// each instance has its own process and ipc path.
+type AnvilPool struct {
+	logger  *httplog.Logger
+	metrics *anvilPoolMetrics
+
+	instances []*AnvilDebugger
+	free      chan *AnvilDebugger
+
+	HealthCheckInterval time.Duration
+}
+
+var _ Interface = &AnvilPool{}
+
+func NewAnvilPool(ctx context.Context, logger *httplog.Logger, metrics prometheus.Registerer, rpcUrl string, size uint, healthCheckInterval time.Duration, provider StateProvider) (*AnvilPool, error) {
+	if err := checkExists(); err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return nil, fmt.Errorf("anvil pool size must be greater than 0")
+	}
+
+	// All instances fork from the same recent block,
+	// so they trace against the same state
+	var forkBlock func(ctx context.Context) (*big.Int, error)
+	if provider != nil {
+		forkBlock = func(ctx context.Context) (*big.Int, error) {
+			head, err := provider.HeaderByNumber(ctx, nil)
+			if err != nil {
+				return nil, err
+			}
+			return head.Number, nil
+		}
+	}
+
+	instanceMetrics := createAnvilMetrics(metrics)
+
+	p := &AnvilPool{
+		logger:  logger,
+		metrics: createAnvilPoolMetrics(metrics),
+
+		instances: make([]*AnvilDebugger, 0, size),
+		free:      make(chan *AnvilDebugger, size),
+
+		HealthCheckInterval: healthCheckInterval,
+	}
+
+	for i := uint(0); i < size; i++ {
+		a, err := newAnvilDebugger(ctx, logger, instanceMetrics, rpcUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		a.ForkBlock = forkBlock
+		p.instances = append(p.instances, a)
+		p.free <- a
+	}
+
+	p.metrics.size.Set(float64(size))
+
+	if p.HealthCheckInterval > 0 {
+		go p.healthCheckLoop(ctx)
+	}
+
+	return p, nil
+}
+
+func (p *AnvilPool) acquire(ctx context.Context) (*AnvilDebugger, error) {
+	start := time.Now()
+
+	p.metrics.queueDepth.Inc()
+	defer p.metrics.queueDepth.Dec()
+
+	select {
+	case <-ctx.Done():
+		p.metrics.acquireFailures.Inc()
+		return nil, fmt.Errorf("anvil pool: %w", ctx.Err())
+	case a := <-p.free:
+		p.metrics.busy.Inc()
+		p.metrics.waitDuration.Observe(time.Since(start).Seconds())
+		return a, nil
+	}
+}
+
+func (p *AnvilPool) release(a *AnvilDebugger) {
+	p.metrics.busy.Dec()
+	p.free <- a
+}
+
+func (p *AnvilPool) DebugTraceCall(ctx context.Context, args *DebugCallArgs, overrideArgs *DebugOverrideArgs) (*TransactionTrace, error) {
+	a, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(a)
+
+	return a.DebugTraceCall(ctx, args, overrideArgs)
+}
+
+func (p *AnvilPool) healthCheckLoop(ctx context.Context) {
+	ticker := time.NewTicker(p.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.healthCheck(ctx)
+		}
+	}
+}
+
+func (p *AnvilPool) healthCheck(ctx context.Context) {
+	// Only the instances idle at the start of the round are checked, busy
+	// ones are going to be checked on the next round. The queue is FIFO,
+	// an instance that comes back again has already been checked, it is
+	// returned right away so the callers can use it
+	checked := make(map[string]struct{}, len(p.instances))
+	for idle := len(p.free); idle > 0; idle-- {
+		var a *AnvilDebugger
+		select {
+		case a = <-p.free:
+		default:
+			return
+		}
+
+		if _, ok := checked[a.ID]; !ok {
+			checked[a.ID] = struct{}{}
+
+			if err := a.HealthCheck(ctx); err != nil {
+				p.logger.Warn("anvil pool: health check failed", "anvil_id", a.ID, "err", err)
+			}
+		}
+
+		p.free <- a
+	}
+}
@@ -2,8 +2,11 @@ package debugger_test
 
 import (
 	"context"
+	"math/big"
 	"os/exec"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/0xsequence/bundler/lib/debugger"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
@@ -73,3 +76,65 @@ func TestDebugWithOverrides(t *testing.T) {
 	assert.False(t, result.Failed)
 	assert.Equal(t, slotValue.String(), "0x"+result.ReturnValue)
 }
+
+func TestAnvilPoolConcurrentDebug(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logger := httplog.NewLogger("")
+	rpcUrl := "http://localhost:8545"
+
+	pool, err := debugger.NewAnvilPool(ctx, logger, nil, rpcUrl, 2, time.Second, nil)
+	if err != nil {
+		// Anvil not available. Skip test
+		t.Skip(err)
+	}
+
+	// Run new anvil instance as the RPC to clone
+	cmd := exec.Command("anvil")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+	}()
+
+	codeAddr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	// MockERC20
+	code := "0x6080604052348015600f57600080fd5b506004361060285760003560e01c806370a0823114602d575b600080fd5b605360383660046065565b6001600160a01b031660009081526020819052604090205490565b60405190815260200160405180910390f35b600060208284031215607657600080fd5b81356001600160a01b0381168114608c57600080fd5b939250505056fea26469706673582212204a2495d07316942a5b44bf5c22ecae8e15845ab84942d1ba514dfd2afdf6d1ba64736f6c63430008180033"
+	slot := common.HexToHash("0xad3228b676f7d3cd4284a5443f17f1962b36e491b30a40b2405849e597ba5fb5")
+
+	wg := sync.WaitGroup{}
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Each call overrides a different value, the
+			// instances must not leak state between calls
+			slotValue := common.BigToHash(big.NewInt(int64(i)))
+			args := &debugger.DebugCallArgs{
+				From: common.Address{},
+				To:   codeAddr,
+				Data: common.FromHex("0x70a082310000000000000000000000000000000000000000000000000000000000000000"),
+			}
+			overrideArgs := &debugger.DebugOverrideArgs{
+				codeAddr: {
+					Code: &code,
+					StateDiff: map[common.Hash]common.Hash{
+						slot: slotValue,
+					},
+				},
+			}
+
+			result, err := pool.DebugTraceCall(ctx, args, overrideArgs)
+			assert.NoError(t, err)
+			if result != nil {
+				assert.False(t, result.Failed)
+				assert.Equal(t, slotValue.String(), "0x"+result.ReturnValue)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -4,18 +4,30 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/lib/provider"
 	"github.com/go-chi/httplog/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewDebugger(cfg config.DebuggerConfig, ctx context.Context, logger *httplog.Logger, metrics prometheus.Registerer, rpcUrl string) (Interface, error) {
+func NewDebugger(cfg config.DebuggerConfig, ctx context.Context, logger *httplog.Logger, metrics prometheus.Registerer, rpcUrl string, provider *provider.Batched) (Interface, error) {
 	mls := strings.ToLower(cfg.Mode)
 	switch mls {
 	case "anvil":
+		if cfg.PoolSize > 1 {
+			logger.Info("debugger: anvil debugger pool enabled", "size", cfg.PoolSize)
+			return NewAnvilPool(ctx, logger, metrics, rpcUrl, cfg.PoolSize, time.Duration(cfg.HealthCheckInterval)*time.Second, provider)
+		}
 		logger.Info("debugger: anvil debugger enabled")
 		return NewAnvilDebugger(ctx, logger, metrics, rpcUrl)
+	case "rpc":
+		logger.Info("debugger: rpc debugger enabled", "tracer", cfg.Tracer)
+		return NewRpcDebugger(logger, metrics, provider.Extended, cfg.Tracer)
+	case "native":
+		logger.Info("debugger: native debugger enabled")
+		return NewNativeDebugger(logger, metrics, provider)
 	case "default", "none", "":
 		logger.Info("debugger: no debugger enabled")
 		return nil, nil
@@ -2,14 +2,19 @@ package debugger
 
 import (
 	"context"
+	"math/big"
 
 	"github.com/0xsequence/ethkit/go-ethereum/common"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
 )
 
 type DebugCallArgs struct {
 	From common.Address
 	To   common.Address
 	Data []byte
+
+	// Gas available to the call, 0 uses the block gas limit
+	Gas uint64
 }
 
 type DebugOverride struct {
@@ -30,6 +35,7 @@ type LogEntry struct {
 
 type TransactionTrace struct {
 	From        common.Address `json:"from"`
+	To          common.Address `json:"to"`
 	Failed      bool           `json:"failed"`
 	Gas         float64        `json:"gas"`
 	ReturnValue string         `json:"returnValue"`
@@ -39,3 +45,11 @@ type TransactionTrace struct {
 type Interface interface {
 	DebugTraceCall(ctx context.Context, args *DebugCallArgs, overrideArgs *DebugOverrideArgs) (*TransactionTrace, error)
 }
+
+// StateProvider is used by the native debugger to fetch the chain state
+type StateProvider interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, blockNum *big.Int) (*ethtypes.Header, error)
+	AccountAt(ctx context.Context, account common.Address, blockNum *big.Int) (*big.Int, uint64, []byte, error)
+	StorageAtBatch(ctx context.Context, address common.Address, slots [][32]byte) ([][32]byte, error)
+}
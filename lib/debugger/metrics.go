@@ -15,7 +15,10 @@ type anvilMetrics struct {
 	debugTraceCallSuccesses  prometheus.Counter
 	debugTraceCallFailures   prometheus.Counter
 
-	anvilRunning prometheus.Gauge
+	anvilRunning        prometheus.Gauge
+	crashes             prometheus.Counter
+	restarts            prometheus.Counter
+	healthCheckFailures prometheus.Counter
 
 	ipcWaitFailures       *prometheus.CounterVec
 	ipcWaitFailureError   prometheus.Labels
@@ -76,6 +79,21 @@ func createAnvilMetrics(reg prometheus.Registerer) *anvilMetrics {
 		Help: "Anvil running state",
 	})
 
+	crashes := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anvil_crashes",
+		Help: "Number of times anvil exited unexpectedly",
+	})
+
+	restarts := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anvil_restarts",
+		Help: "Number of times anvil was restarted by the health check",
+	})
+
+	healthCheckFailures := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anvil_health_check_failures",
+		Help: "Number of failed anvil health checks",
+	})
+
 	debugCallDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name: "anvil_debug_call_duration",
 		Help: "Duration of anvil debug call operations",
@@ -112,6 +130,7 @@ func createAnvilMetrics(reg prometheus.Registerer) *anvilMetrics {
 			debugTraceCallRetry,
 			ipcWaitFailures, debugTraceCallFailures,
 			anvilRunning, debugCallDuration, ipcFileWaitDuration,
+			crashes, restarts, healthCheckFailures,
 		)
 	}
 
@@ -126,6 +145,9 @@ func createAnvilMetrics(reg prometheus.Registerer) *anvilMetrics {
 		debugTraceCallRetry:      debugTraceCallRetry,
 		debugTraceCallFailures:   debugTraceCallFailures,
 		anvilRunning:             anvilRunning,
+		crashes:                  crashes,
+		restarts:                 restarts,
+		healthCheckFailures:      healthCheckFailures,
 		debugCallDuration:        debugCallDuration,
 		ipcWaitFailures:          ipcWaitFailures,
 		ipcFileWaitDuration:      ipcFileWaitDuration,
@@ -134,3 +156,174 @@ func createAnvilMetrics(reg prometheus.Registerer) *anvilMetrics {
 		ipcWaitFailureTimeout: prometheus.Labels{"reason": "timeout"},
 	}
 }
+
+type nativeMetrics struct {
+	debugTraceCallOperations prometheus.Counter
+	debugTraceCallSuccesses  prometheus.Counter
+	debugTraceCallFailures   prometheus.Counter
+	debugTraceCallRunning    prometheus.Gauge
+
+	stateAccountFetches prometheus.Counter
+	stateSlotFetches    prometheus.Counter
+	stateFetchFailures  prometheus.Counter
+
+	debugCallDuration prometheus.Histogram
+}
+
+func createNativeMetrics(reg prometheus.Registerer) *nativeMetrics {
+	debugTraceCallOperations := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "native_debug_trace_call_operations",
+		Help: "Number of debug trace call operations on the native debugger",
+	})
+
+	debugTraceCallSuccesses := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "native_debug_trace_call_successes",
+		Help: "Number of successful debug trace call operations on the native debugger",
+	})
+
+	debugTraceCallFailures := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "native_debug_trace_call_failures",
+		Help: "Number of failed debug trace call operations on the native debugger",
+	})
+
+	debugTraceCallRunning := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "native_debug_trace_call_running",
+		Help: "Number of debug trace calls running on the native debugger",
+	})
+
+	stateAccountFetches := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "native_state_account_fetches",
+		Help: "Number of accounts fetched by the native debugger",
+	})
+
+	stateSlotFetches := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "native_state_slot_fetches",
+		Help: "Number of storage slots fetched by the native debugger",
+	})
+
+	stateFetchFailures := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "native_state_fetch_failures",
+		Help: "Number of failed state fetches on the native debugger",
+	})
+
+	debugCallDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "native_debug_call_duration",
+		Help:    "Duration of native debug call operations",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			debugTraceCallOperations, debugTraceCallSuccesses,
+			debugTraceCallFailures, debugTraceCallRunning,
+			stateAccountFetches, stateSlotFetches, stateFetchFailures,
+			debugCallDuration,
+		)
+	}
+
+	return &nativeMetrics{
+		debugTraceCallOperations: debugTraceCallOperations,
+		debugTraceCallSuccesses:  debugTraceCallSuccesses,
+		debugTraceCallFailures:   debugTraceCallFailures,
+		debugTraceCallRunning:    debugTraceCallRunning,
+		stateAccountFetches:      stateAccountFetches,
+		stateSlotFetches:         stateSlotFetches,
+		stateFetchFailures:       stateFetchFailures,
+		debugCallDuration:        debugCallDuration,
+	}
+}
+
+type anvilPoolMetrics struct {
+	size       prometheus.Gauge
+	busy       prometheus.Gauge
+	queueDepth prometheus.Gauge
+
+	acquireFailures prometheus.Counter
+
+	waitDuration prometheus.Histogram
+}
+
+func createAnvilPoolMetrics(reg prometheus.Registerer) *anvilPoolMetrics {
+	size := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "anvil_pool_size",
+		Help: "Number of anvil instances in the pool",
+	})
+
+	busy := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "anvil_pool_busy",
+		Help: "Number of anvil instances currently tracing",
+	})
+
+	queueDepth := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "anvil_pool_queue_depth",
+		Help: "Number of trace calls waiting for an anvil instance",
+	})
+
+	acquireFailures := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "anvil_pool_acquire_failures",
+		Help: "Number of trace calls that gave up waiting for an anvil instance",
+	})
+
+	waitDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "anvil_pool_wait_duration",
+		Help:    "Time spent waiting for an anvil instance",
+		Buckets: prometheus.ExponentialBuckets(1e-6, 2, 32),
+	})
+
+	if reg != nil {
+		reg.MustRegister(size, busy, queueDepth, acquireFailures, waitDuration)
+	}
+
+	return &anvilPoolMetrics{
+		size:            size,
+		busy:            busy,
+		queueDepth:      queueDepth,
+		acquireFailures: acquireFailures,
+		waitDuration:    waitDuration,
+	}
+}
+
+type rpcMetrics struct {
+	debugTraceCallOperations prometheus.Counter
+	debugTraceCallSuccesses  prometheus.Counter
+	debugTraceCallFailures   prometheus.Counter
+
+	debugCallDuration prometheus.Histogram
+}
+
+func createRpcMetrics(reg prometheus.Registerer) *rpcMetrics {
+	debugTraceCallOperations := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rpc_debug_trace_call_operations",
+		Help: "Number of debug trace call operations on the rpc debugger",
+	})
+
+	debugTraceCallSuccesses := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rpc_debug_trace_call_successes",
+		Help: "Number of successful debug trace call operations on the rpc debugger",
+	})
+
+	debugTraceCallFailures := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rpc_debug_trace_call_failures",
+		Help: "Number of failed debug trace call operations on the rpc debugger",
+	})
+
+	debugCallDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rpc_debug_call_duration",
+		Help:    "Duration of rpc debug call operations",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			debugTraceCallOperations, debugTraceCallSuccesses,
+			debugTraceCallFailures, debugCallDuration,
+		)
+	}
+
+	return &rpcMetrics{
+		debugTraceCallOperations: debugTraceCallOperations,
+		debugTraceCallSuccesses:  debugTraceCallSuccesses,
+		debugTraceCallFailures:   debugTraceCallFailures,
+		debugCallDuration:        debugCallDuration,
+	}
+}
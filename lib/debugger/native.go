@@ -0,0 +1,253 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
+	gcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/go-chi/httplog/v2"
+	"github.com/holiman/uint256"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NativeDebugger traces calls in-process using the go-ethereum EVM,
+// the state is fetched lazily from the provider and the overrides are
+// applied in memory, so multiple traces can run concurrently.
+type NativeDebugger struct {
+	logger  *httplog.Logger
+	metrics *nativeMetrics
+
+	chainLock   sync.Mutex
+	chainConfig *params.ChainConfig
+
+	Provider StateProvider
+}
+
+var _ Interface = &NativeDebugger{}
+
+func NewNativeDebugger(logger *httplog.Logger, metrics prometheus.Registerer, provider StateProvider) (*NativeDebugger, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("native debugger requires a provider")
+	}
+
+	return &NativeDebugger{
+		logger:  logger,
+		metrics: createNativeMetrics(metrics),
+
+		Provider: provider,
+	}, nil
+}
+
+func (n *NativeDebugger) getChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	n.chainLock.Lock()
+	defer n.chainLock.Unlock()
+
+	if n.chainConfig != nil {
+		return n.chainConfig, nil
+	}
+
+	chainID, err := n.Provider.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch chain id: %w", err)
+	}
+
+	// All forks are considered active, the trace
+	// always runs on top of the latest block
+	zero := uint64(0)
+	n.chainConfig = &params.ChainConfig{
+		ChainID:                       chainID,
+		HomesteadBlock:                big.NewInt(0),
+		EIP150Block:                   big.NewInt(0),
+		EIP155Block:                   big.NewInt(0),
+		EIP158Block:                   big.NewInt(0),
+		ByzantiumBlock:                big.NewInt(0),
+		ConstantinopleBlock:           big.NewInt(0),
+		PetersburgBlock:               big.NewInt(0),
+		IstanbulBlock:                 big.NewInt(0),
+		MuirGlacierBlock:              big.NewInt(0),
+		BerlinBlock:                   big.NewInt(0),
+		LondonBlock:                   big.NewInt(0),
+		ArrowGlacierBlock:             big.NewInt(0),
+		GrayGlacierBlock:              big.NewInt(0),
+		MergeNetsplitBlock:            big.NewInt(0),
+		ShanghaiTime:                  &zero,
+		CancunTime:                    &zero,
+		TerminalTotalDifficulty:       big.NewInt(0),
+		TerminalTotalDifficultyPassed: true,
+	}
+
+	return n.chainConfig, nil
+}
+
+func (n *NativeDebugger) blockContext(ctx context.Context, state *nativeState, head *ethtypes.Header) vm.BlockContext {
+	baseFee := head.BaseFee
+	if baseFee == nil {
+		baseFee = new(big.Int)
+	}
+
+	random := gcommon.Hash(head.MixDigest)
+
+	return vm.BlockContext{
+		CanTransfer: func(db vm.StateDB, addr gcommon.Address, amount *uint256.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer: func(db vm.StateDB, sender, recipient gcommon.Address, amount *uint256.Int) {
+			db.SubBalance(sender, amount)
+			db.AddBalance(recipient, amount)
+		},
+		GetHash: func(num uint64) gcommon.Hash {
+			// The hash of a block is the parent hash of the next one,
+			// the headers returned by the provider can't be re-hashed reliably
+			next, err := n.Provider.HeaderByNumber(ctx, new(big.Int).SetUint64(num+1))
+			if err != nil {
+				state.fail(fmt.Errorf("unable to fetch block %d: %w", num+1, err))
+				return gcommon.Hash{}
+			}
+			return gcommon.Hash(next.ParentHash)
+		},
+
+		Coinbase:    gcommon.Address(head.Coinbase),
+		GasLimit:    head.GasLimit,
+		BlockNumber: new(big.Int).Set(head.Number),
+		Time:        head.Time,
+		Difficulty:  new(big.Int),
+		BaseFee:     baseFee,
+		BlobBaseFee: big.NewInt(1),
+		Random:      &random,
+	}
+}
+
+func (n *NativeDebugger) DebugTraceCall(ctx context.Context, args *DebugCallArgs, overrideArgs *DebugOverrideArgs) (*TransactionTrace, error) {
+	n.metrics.debugTraceCallOperations.Inc()
+	n.metrics.debugTraceCallRunning.Inc()
+	defer n.metrics.debugTraceCallRunning.Dec()
+
+	start := time.Now()
+
+	res, err := n.debugTraceCall(ctx, args, overrideArgs)
+	if err != nil {
+		n.metrics.debugTraceCallFailures.Inc()
+		return nil, err
+	}
+
+	n.metrics.debugTraceCallSuccesses.Inc()
+	n.metrics.debugCallDuration.Observe(time.Since(start).Seconds())
+	n.logger.Debug("native debug trace call", "duration", time.Since(start), "steps", len(res.StructLogs))
+
+	return res, nil
+}
+
+func (n *NativeDebugger) debugTraceCall(ctx context.Context, args *DebugCallArgs, overrideArgs *DebugOverrideArgs) (*TransactionTrace, error) {
+	chainConfig, err := n.getChainConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := n.Provider.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch head block: %w", err)
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	state := newNativeState(ctx2, n.Provider, n.metrics)
+	state.applyOverrides(overrideArgs)
+	if err := state.Err(); err != nil {
+		return nil, err
+	}
+
+	tracer := &structLogger{}
+	evm := vm.NewEVM(
+		n.blockContext(ctx2, state, head),
+		vm.TxContext{
+			Origin:   gcommon.Address(args.From),
+			GasPrice: new(big.Int),
+		},
+		state,
+		chainConfig,
+		vm.Config{
+			Tracer:    tracer,
+			NoBaseFee: true,
+		},
+	)
+
+	from := gcommon.Address(args.From)
+	to := gcommon.Address(args.To)
+
+	rules := chainConfig.Rules(evm.Context.BlockNumber, evm.Context.Random != nil, evm.Context.Time)
+	state.Prepare(rules, from, evm.Context.Coinbase, &to, vm.ActivePrecompiles(rules), nil)
+
+	gas := head.GasLimit
+	if args.Gas != 0 && args.Gas < gas {
+		gas = args.Gas
+	}
+	ret, leftOver, vmerr := evm.Call(vm.AccountRef(from), to, args.Data, gas, new(uint256.Int))
+
+	// A failed fetch makes the whole trace unreliable
+	if err := state.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx2.Err(); err != nil {
+		return nil, err
+	}
+
+	return &TransactionTrace{
+		From:        args.From,
+		To:          args.To,
+		Failed:      vmerr != nil,
+		Gas:         float64(gas - leftOver),
+		ReturnValue: common.Bytes2Hex(ret),
+		StructLogs:  tracer.logs,
+	}, nil
+}
+
+// structLogger collects the same struct logs as the
+// default debug_traceCall tracer, without memory and storage
+type structLogger struct {
+	logs []LogEntry
+}
+
+var _ vm.EVMLogger = &structLogger{}
+
+func (l *structLogger) CaptureTxStart(gasLimit uint64) {}
+
+func (l *structLogger) CaptureTxEnd(restGas uint64) {}
+
+func (l *structLogger) CaptureStart(env *vm.EVM, from gcommon.Address, to gcommon.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (l *structLogger) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (l *structLogger) CaptureEnter(typ vm.OpCode, from gcommon.Address, to gcommon.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (l *structLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (l *structLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	data := scope.Stack.Data()
+	stack := make([]string, len(data))
+	for i, v := range data {
+		stack[i] = v.Hex()
+	}
+
+	l.logs = append(l.logs, LogEntry{
+		PC:      float64(pc),
+		Op:      op.String(),
+		Gas:     float64(gas),
+		GasCost: float64(cost),
+		Stack:   stack,
+		Depth:   float64(depth),
+	})
+}
+
+func (l *structLogger) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
@@ -0,0 +1,457 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ethcommon "github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+type nativeAccount struct {
+	balance *uint256.Int
+	nonce   uint64
+	code    []byte
+
+	// Storage as read from the chain (or overridden), and
+	// the storage written during the execution
+	committed map[common.Hash]common.Hash
+	dirty     map[common.Hash]common.Hash
+
+	// Accounts created during the execution have no remote storage
+	created    bool
+	destructed bool
+}
+
+func (a *nativeAccount) empty() bool {
+	return a.nonce == 0 && a.balance.IsZero() && len(a.code) == 0
+}
+
+// nativeState implements vm.StateDB on top of a remote provider,
+// accounts and slots are fetched lazily the first time they are accessed.
+// It is not thread safe, each trace must use its own state.
+type nativeState struct {
+	ctx      context.Context
+	provider StateProvider
+	metrics  *nativeMetrics
+
+	accounts  map[common.Address]*nativeAccount
+	transient map[common.Address]map[common.Hash]common.Hash
+	refund    uint64
+
+	accessAddrs map[common.Address]bool
+	accessSlots map[common.Address]map[common.Hash]bool
+
+	logs    []*types.Log
+	journal []func()
+	snaps   []int
+
+	// The vm.StateDB interface can't return errors, so the first
+	// fetch error is kept and reported once the execution is done
+	errLock sync.Mutex
+	err     error
+}
+
+var _ vm.StateDB = &nativeState{}
+
+func newNativeState(ctx context.Context, provider StateProvider, metrics *nativeMetrics) *nativeState {
+	return &nativeState{
+		ctx:      ctx,
+		provider: provider,
+		metrics:  metrics,
+
+		accounts:  make(map[common.Address]*nativeAccount),
+		transient: make(map[common.Address]map[common.Hash]common.Hash),
+
+		accessAddrs: make(map[common.Address]bool),
+		accessSlots: make(map[common.Address]map[common.Hash]bool),
+	}
+}
+
+func (s *nativeState) Err() error {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+	return s.err
+}
+
+func (s *nativeState) fail(err error) {
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *nativeState) account(addr common.Address) *nativeAccount {
+	if acc, ok := s.accounts[addr]; ok {
+		return acc
+	}
+
+	acc := &nativeAccount{
+		balance:   new(uint256.Int),
+		committed: make(map[common.Hash]common.Hash),
+		dirty:     make(map[common.Hash]common.Hash),
+	}
+	s.accounts[addr] = acc
+
+	if s.Err() != nil {
+		return acc
+	}
+
+	s.metrics.stateAccountFetches.Inc()
+
+	balance, nonce, code, err := s.provider.AccountAt(s.ctx, ethcommon.Address(addr), nil)
+	if err != nil {
+		s.metrics.stateFetchFailures.Inc()
+		s.fail(fmt.Errorf("unable to fetch account %s: %w", addr.Hex(), err))
+		return acc
+	}
+
+	if balance != nil {
+		acc.balance, _ = uint256.FromBig(balance)
+	}
+	acc.nonce = nonce
+	acc.code = code
+
+	return acc
+}
+
+func (s *nativeState) committedSlot(addr common.Address, acc *nativeAccount, key common.Hash) common.Hash {
+	if v, ok := acc.committed[key]; ok {
+		return v
+	}
+
+	if acc.created || s.Err() != nil {
+		return common.Hash{}
+	}
+
+	s.metrics.stateSlotFetches.Inc()
+
+	res, err := s.provider.StorageAtBatch(s.ctx, ethcommon.Address(addr), [][32]byte{key})
+	if err != nil {
+		s.metrics.stateFetchFailures.Inc()
+		s.fail(fmt.Errorf("unable to fetch slot %s of %s: %w", key.Hex(), addr.Hex(), err))
+		return common.Hash{}
+	}
+
+	if len(res) != 1 {
+		s.metrics.stateFetchFailures.Inc()
+		s.fail(fmt.Errorf("unexpected slot count for %s: %d", addr.Hex(), len(res)))
+		return common.Hash{}
+	}
+
+	v := common.Hash(res[0])
+	acc.committed[key] = v
+	return v
+}
+
+// applyOverrides sets the overridden code and slots as if they
+// were part of the chain state, they are not reverted by snapshots
+func (s *nativeState) applyOverrides(overrideArgs *DebugOverrideArgs) {
+	if overrideArgs == nil {
+		return
+	}
+
+	for addr, override := range *overrideArgs {
+		if override == nil {
+			continue
+		}
+
+		acc := s.account(common.Address(addr))
+		if override.Code != nil {
+			acc.code = ethcommon.FromHex(*override.Code)
+		}
+
+		for slot, value := range override.StateDiff {
+			acc.committed[common.Hash(slot)] = common.Hash(value)
+		}
+	}
+}
+
+func (s *nativeState) record(undo func()) {
+	s.journal = append(s.journal, undo)
+}
+
+func (s *nativeState) CreateAccount(addr common.Address) {
+	prev, hadPrev := s.accounts[addr]
+
+	acc := &nativeAccount{
+		balance:   new(uint256.Int),
+		committed: make(map[common.Hash]common.Hash),
+		dirty:     make(map[common.Hash]common.Hash),
+		created:   true,
+	}
+
+	// The balance is carried over, someone may have sent funds
+	// to the address before the contract was deployed
+	if hadPrev {
+		acc.balance.Set(prev.balance)
+	} else {
+		acc.balance.Set(s.account(addr).balance)
+		prev, hadPrev = s.accounts[addr]
+	}
+
+	s.accounts[addr] = acc
+	s.record(func() {
+		if hadPrev {
+			s.accounts[addr] = prev
+		} else {
+			delete(s.accounts, addr)
+		}
+	})
+}
+
+func (s *nativeState) SubBalance(addr common.Address, amount *uint256.Int) {
+	acc := s.account(addr)
+	prev := new(uint256.Int).Set(acc.balance)
+	acc.balance = new(uint256.Int).Sub(acc.balance, amount)
+	s.record(func() { acc.balance = prev })
+}
+
+func (s *nativeState) AddBalance(addr common.Address, amount *uint256.Int) {
+	acc := s.account(addr)
+	prev := new(uint256.Int).Set(acc.balance)
+	acc.balance = new(uint256.Int).Add(acc.balance, amount)
+	s.record(func() { acc.balance = prev })
+}
+
+func (s *nativeState) GetBalance(addr common.Address) *uint256.Int {
+	return new(uint256.Int).Set(s.account(addr).balance)
+}
+
+func (s *nativeState) GetNonce(addr common.Address) uint64 {
+	return s.account(addr).nonce
+}
+
+func (s *nativeState) SetNonce(addr common.Address, nonce uint64) {
+	acc := s.account(addr)
+	prev := acc.nonce
+	acc.nonce = nonce
+	s.record(func() { acc.nonce = prev })
+}
+
+func (s *nativeState) GetCodeHash(addr common.Address) common.Hash {
+	if !s.Exist(addr) {
+		return common.Hash{}
+	}
+
+	acc := s.account(addr)
+	if len(acc.code) == 0 {
+		return types.EmptyCodeHash
+	}
+
+	return crypto.Keccak256Hash(acc.code)
+}
+
+func (s *nativeState) GetCode(addr common.Address) []byte {
+	return s.account(addr).code
+}
+
+func (s *nativeState) SetCode(addr common.Address, code []byte) {
+	acc := s.account(addr)
+	prev := acc.code
+	acc.code = code
+	s.record(func() { acc.code = prev })
+}
+
+func (s *nativeState) GetCodeSize(addr common.Address) int {
+	return len(s.account(addr).code)
+}
+
+func (s *nativeState) AddRefund(gas uint64) {
+	prev := s.refund
+	s.refund += gas
+	s.record(func() { s.refund = prev })
+}
+
+func (s *nativeState) SubRefund(gas uint64) {
+	prev := s.refund
+	if gas > s.refund {
+		s.fail(fmt.Errorf("refund counter below zero (gas: %d > refund: %d)", gas, s.refund))
+		s.refund = 0
+	} else {
+		s.refund -= gas
+	}
+	s.record(func() { s.refund = prev })
+}
+
+func (s *nativeState) GetRefund() uint64 {
+	return s.refund
+}
+
+func (s *nativeState) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	acc := s.account(addr)
+	return s.committedSlot(addr, acc, key)
+}
+
+func (s *nativeState) GetState(addr common.Address, key common.Hash) common.Hash {
+	acc := s.account(addr)
+	if v, ok := acc.dirty[key]; ok {
+		return v
+	}
+
+	return s.committedSlot(addr, acc, key)
+}
+
+func (s *nativeState) SetState(addr common.Address, key common.Hash, value common.Hash) {
+	acc := s.account(addr)
+	prev, hadPrev := acc.dirty[key]
+	acc.dirty[key] = value
+	s.record(func() {
+		if hadPrev {
+			acc.dirty[key] = prev
+		} else {
+			delete(acc.dirty, key)
+		}
+	})
+}
+
+func (s *nativeState) GetTransientState(addr common.Address, key common.Hash) common.Hash {
+	return s.transient[addr][key]
+}
+
+func (s *nativeState) SetTransientState(addr common.Address, key, value common.Hash) {
+	slots, ok := s.transient[addr]
+	if !ok {
+		slots = make(map[common.Hash]common.Hash)
+		s.transient[addr] = slots
+	}
+
+	prev := slots[key]
+	slots[key] = value
+	s.record(func() { slots[key] = prev })
+}
+
+func (s *nativeState) SelfDestruct(addr common.Address) {
+	acc := s.account(addr)
+	prevDestructed := acc.destructed
+	prevBalance := acc.balance
+
+	acc.destructed = true
+	acc.balance = new(uint256.Int)
+
+	s.record(func() {
+		acc.destructed = prevDestructed
+		acc.balance = prevBalance
+	})
+}
+
+func (s *nativeState) HasSelfDestructed(addr common.Address) bool {
+	return s.account(addr).destructed
+}
+
+func (s *nativeState) Selfdestruct6780(addr common.Address) {
+	// After EIP-6780 only contracts created in the
+	// same transaction are actually destructed
+	if s.account(addr).created {
+		s.SelfDestruct(addr)
+	}
+}
+
+func (s *nativeState) Exist(addr common.Address) bool {
+	acc := s.account(addr)
+	return acc.created || acc.destructed || !acc.empty()
+}
+
+func (s *nativeState) Empty(addr common.Address) bool {
+	return s.account(addr).empty()
+}
+
+func (s *nativeState) AddressInAccessList(addr common.Address) bool {
+	return s.accessAddrs[addr]
+}
+
+func (s *nativeState) SlotInAccessList(addr common.Address, slot common.Hash) (bool, bool) {
+	return s.accessAddrs[addr], s.accessSlots[addr][slot]
+}
+
+func (s *nativeState) AddAddressToAccessList(addr common.Address) {
+	if s.accessAddrs[addr] {
+		return
+	}
+
+	s.accessAddrs[addr] = true
+	s.record(func() { delete(s.accessAddrs, addr) })
+}
+
+func (s *nativeState) AddSlotToAccessList(addr common.Address, slot common.Hash) {
+	s.AddAddressToAccessList(addr)
+
+	slots, ok := s.accessSlots[addr]
+	if !ok {
+		slots = make(map[common.Hash]bool)
+		s.accessSlots[addr] = slots
+	}
+
+	if slots[slot] {
+		return
+	}
+
+	slots[slot] = true
+	s.record(func() { delete(slots, slot) })
+}
+
+func (s *nativeState) Prepare(rules params.Rules, sender, coinbase common.Address, dest *common.Address, precompiles []common.Address, txAccesses types.AccessList) {
+	if !rules.IsBerlin {
+		return
+	}
+
+	s.accessAddrs = make(map[common.Address]bool)
+	s.accessSlots = make(map[common.Address]map[common.Hash]bool)
+
+	s.AddAddressToAccessList(sender)
+	if dest != nil {
+		s.AddAddressToAccessList(*dest)
+	}
+
+	for _, addr := range precompiles {
+		s.AddAddressToAccessList(addr)
+	}
+
+	for _, el := range txAccesses {
+		s.AddAddressToAccessList(el.Address)
+		for _, key := range el.StorageKeys {
+			s.AddSlotToAccessList(el.Address, key)
+		}
+	}
+
+	if rules.IsShanghai {
+		s.AddAddressToAccessList(coinbase)
+	}
+
+	s.transient = make(map[common.Address]map[common.Hash]common.Hash)
+}
+
+func (s *nativeState) RevertToSnapshot(id int) {
+	if id < 0 || id >= len(s.snaps) {
+		s.fail(fmt.Errorf("invalid snapshot id: %d", id))
+		return
+	}
+
+	target := s.snaps[id]
+	for i := len(s.journal) - 1; i >= target; i-- {
+		s.journal[i]()
+	}
+
+	s.journal = s.journal[:target]
+	s.snaps = s.snaps[:id]
+}
+
+func (s *nativeState) Snapshot() int {
+	s.snaps = append(s.snaps, len(s.journal))
+	return len(s.snaps) - 1
+}
+
+func (s *nativeState) AddLog(log *types.Log) {
+	s.logs = append(s.logs, log)
+	l := len(s.logs)
+	s.record(func() { s.logs = s.logs[:l-1] })
+}
+
+func (s *nativeState) AddPreimage(common.Hash, []byte) {}
@@ -0,0 +1,179 @@
+package debugger_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/0xsequence/bundler/lib/debugger"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
+	"github.com/go-chi/httplog/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeState struct {
+	lock  sync.Mutex
+	code  map[common.Address][]byte
+	slots map[common.Address]map[[32]byte][32]byte
+
+	slotFetches int
+}
+
+func (f *fakeState) ChainID(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
+func (f *fakeState) HeaderByNumber(ctx context.Context, blockNum *big.Int) (*ethtypes.Header, error) {
+	return &ethtypes.Header{
+		Number:   big.NewInt(100),
+		GasLimit: 30_000_000,
+		Time:     1700000000,
+		BaseFee:  big.NewInt(1),
+	}, nil
+}
+
+func (f *fakeState) AccountAt(ctx context.Context, account common.Address, blockNum *big.Int) (*big.Int, uint64, []byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return big.NewInt(0), 0, f.code[account], nil
+}
+
+func (f *fakeState) StorageAtBatch(ctx context.Context, address common.Address, slots [][32]byte) ([][32]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.slotFetches += len(slots)
+	res := make([][32]byte, len(slots))
+	for i, slot := range slots {
+		res[i] = f.slots[address][slot]
+	}
+	return res, nil
+}
+
+// MockERC20
+const mockERC20Code = "0x6080604052348015600f57600080fd5b506004361060285760003560e01c806370a0823114602d575b600080fd5b605360383660046065565b6001600160a01b031660009081526020819052604090205490565b60405190815260200160405180910390f35b600060208284031215607657600080fd5b81356001600160a01b0381168114608c57600080fd5b939250505056fea26469706673582212204a2495d07316942a5b44bf5c22ecae8e15845ab84942d1ba514dfd2afdf6d1ba64736f6c63430008180033"
+
+// keccak256(abi.encode(address(0), bytes32(0)))
+var mockERC20Slot = common.HexToHash("0xad3228b676f7d3cd4284a5443f17f1962b36e491b30a40b2405849e597ba5fb5")
+
+// MockERC20.balanceOf(address(0))
+const mockERC20BalanceOf = "0x70a082310000000000000000000000000000000000000000000000000000000000000000"
+
+func TestNativeDebugWithOverrides(t *testing.T) {
+	logger := httplog.NewLogger("")
+	state := &fakeState{}
+
+	native, err := debugger.NewNativeDebugger(logger, nil, state)
+	assert.NoError(t, err)
+
+	codeAddr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	code := mockERC20Code
+	slotValue := common.HexToHash("0x100")
+
+	args := &debugger.DebugCallArgs{
+		From: common.Address{},
+		To:   codeAddr,
+		Data: common.FromHex(mockERC20BalanceOf),
+	}
+
+	overrideArgs := &debugger.DebugOverrideArgs{
+		codeAddr: {
+			Code: &code,
+			StateDiff: map[common.Hash]common.Hash{
+				mockERC20Slot: slotValue,
+			},
+		},
+	}
+
+	result, err := native.DebugTraceCall(context.Background(), args, overrideArgs)
+	assert.NoError(t, err)
+	assert.False(t, result.Failed)
+	assert.Equal(t, slotValue.String(), "0x"+result.ReturnValue)
+	assert.NotEmpty(t, result.StructLogs)
+
+	// The overridden slot should not be fetched
+	assert.Equal(t, 0, state.slotFetches)
+}
+
+func TestNativeDebugFetchesState(t *testing.T) {
+	logger := httplog.NewLogger("")
+	codeAddr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	slotValue := common.HexToHash("0x200")
+
+	state := &fakeState{
+		code: map[common.Address][]byte{
+			codeAddr: common.FromHex(mockERC20Code),
+		},
+		slots: map[common.Address]map[[32]byte][32]byte{
+			codeAddr: {
+				mockERC20Slot: slotValue,
+			},
+		},
+	}
+
+	native, err := debugger.NewNativeDebugger(logger, nil, state)
+	assert.NoError(t, err)
+
+	args := &debugger.DebugCallArgs{
+		From: common.Address{},
+		To:   codeAddr,
+		Data: common.FromHex(mockERC20BalanceOf),
+	}
+
+	// Traces don't share state, so they can run concurrently
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := native.DebugTraceCall(context.Background(), args, nil)
+			assert.NoError(t, err)
+			assert.False(t, result.Failed)
+			assert.Equal(t, slotValue.String(), "0x"+result.ReturnValue)
+
+			// The SLOAD must be traced with the slot on the stack
+			found := false
+			for _, log := range result.StructLogs {
+				if log.Op == "SLOAD" {
+					found = true
+					assert.Equal(t, mockERC20Slot, common.HexToHash(log.Stack[len(log.Stack)-1]))
+					assert.Equal(t, float64(1), log.Depth)
+				}
+			}
+			assert.True(t, found, fmt.Sprintf("no SLOAD in %d logs", len(result.StructLogs)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 4, state.slotFetches)
+}
+
+func TestNativeDebugRevert(t *testing.T) {
+	logger := httplog.NewLogger("")
+	codeAddr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+
+	state := &fakeState{
+		code: map[common.Address][]byte{
+			codeAddr: common.FromHex(mockERC20Code),
+		},
+	}
+
+	native, err := debugger.NewNativeDebugger(logger, nil, state)
+	assert.NoError(t, err)
+
+	// Unknown selector, the contract reverts
+	args := &debugger.DebugCallArgs{
+		From: common.Address{},
+		To:   codeAddr,
+		Data: common.FromHex("0x12345678"),
+	}
+
+	result, err := native.DebugTraceCall(context.Background(), args, nil)
+	assert.NoError(t, err)
+	assert.True(t, result.Failed)
+	assert.Equal(t, "REVERT", result.StructLogs[len(result.StructLogs)-1].Op)
+}
@@ -0,0 +1,158 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/0xsequence/bundler/lib/provider"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/go-chi/httplog/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Emits the same struct logs as the default tracer, but only
+// with the top of the stack, that is all the endorser needs
+const jsStructTracer = `{
+	logs: [],
+	step: function(log) {
+		var n = log.stack.length();
+		var stack = [];
+		for (var i = Math.min(n, 4) - 1; i >= 0; i--) {
+			stack.push("0x" + log.stack.peek(i).toString(16));
+		}
+		this.logs.push({
+			pc: log.getPC(),
+			op: log.op.toString(),
+			gas: log.getGas(),
+			gasCost: log.getCost(),
+			depth: log.getDepth(),
+			stack: stack
+		});
+	},
+	fault: function() {},
+	result: function(ctx) {
+		return {
+			failed: ctx.error !== undefined,
+			gas: ctx.gasUsed,
+			returnValue: toHex(ctx.output),
+			structLogs: this.logs
+		};
+	}
+}`
+
+const (
+	RpcTracerStruct = "struct"
+	RpcTracerJS     = "js"
+)
+
+// RpcDebugger runs debug_traceCall on the upstream node
+type RpcDebugger struct {
+	logger  *httplog.Logger
+	metrics *rpcMetrics
+
+	tracer string
+
+	Provider *provider.Extended
+}
+
+var _ Interface = &RpcDebugger{}
+
+func NewRpcDebugger(logger *httplog.Logger, metrics prometheus.Registerer, provider *provider.Extended, tracer string) (*RpcDebugger, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("rpc debugger requires a provider")
+	}
+
+	if !provider.SupportsDebug() {
+		return nil, fmt.Errorf("rpc debugger: provider does not support debug_traceCall")
+	}
+
+	if !provider.SupportsOverride() {
+		return nil, fmt.Errorf("rpc debugger: provider does not support state overrides")
+	}
+
+	tracer = strings.ToLower(tracer)
+	switch tracer {
+	case "", RpcTracerStruct:
+		tracer = RpcTracerStruct
+	case RpcTracerJS:
+	default:
+		return nil, fmt.Errorf("rpc debugger: unknown tracer: %s", tracer)
+	}
+
+	return &RpcDebugger{
+		logger:  logger,
+		metrics: createRpcMetrics(metrics),
+
+		tracer: tracer,
+
+		Provider: provider,
+	}, nil
+}
+
+func (r *RpcDebugger) traceConfig(overrideArgs *DebugOverrideArgs) *provider.TraceConfig {
+	config := &provider.TraceConfig{}
+
+	if r.tracer == RpcTracerJS {
+		t := jsStructTracer
+		config.Tracer = &t
+	} else {
+		config.DisableStorage = true
+	}
+
+	if overrideArgs != nil {
+		config.StateOverrides = make(provider.OverrideArgs, len(*overrideArgs))
+		for addr, override := range *overrideArgs {
+			if override == nil {
+				continue
+			}
+
+			config.StateOverrides[addr] = &provider.Override{
+				Code:      override.Code,
+				StateDiff: override.StateDiff,
+			}
+		}
+	}
+
+	return config
+}
+
+func (r *RpcDebugger) DebugTraceCall(ctx context.Context, args *DebugCallArgs, overrideArgs *DebugOverrideArgs) (*TransactionTrace, error) {
+	r.metrics.debugTraceCallOperations.Inc()
+	start := time.Now()
+
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	from := args.From
+	call := &provider.Call{
+		From: &from,
+		To:   args.To,
+		Data: "0x" + common.Bytes2Hex(args.Data),
+	}
+
+	if args.Gas != 0 {
+		gas := hexutil.Uint64(args.Gas)
+		call.Gas = &gas
+	}
+
+	res := &TransactionTrace{}
+	err := r.Provider.DebugTraceCall(ctx2, call, r.traceConfig(overrideArgs), res)
+	if err != nil {
+		r.metrics.debugTraceCallFailures.Inc()
+		return nil, err
+	}
+
+	// Some nodes prefix the return value, anvil does not
+	res.ReturnValue = strings.TrimPrefix(res.ReturnValue, "0x")
+	res.From = args.From
+	res.To = args.To
+
+	r.metrics.debugTraceCallSuccesses.Inc()
+	r.metrics.debugCallDuration.Observe(time.Since(start).Seconds())
+	r.logger.Debug("rpc debug trace call", "duration", time.Since(start), "tracer", r.tracer, "steps", len(res.StructLogs))
+
+	return res, nil
+}
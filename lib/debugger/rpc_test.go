@@ -0,0 +1,156 @@
+package debugger_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xsequence/bundler/lib/debugger"
+	"github.com/0xsequence/bundler/lib/provider"
+	"github.com/0xsequence/ethkit/ethrpc"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/go-chi/httplog/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   interface{}     `json:"error,omitempty"`
+}
+
+const probeResult = "0x0000000000000000000000000000000000000000000000000000000000000001"
+
+// Fake node, handler returns the result for each call or nil if the method is unsupported
+func fakeNode(t *testing.T, handler func(req *rpcRequest) interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		batch := strings.HasPrefix(strings.TrimSpace(string(body)), "[")
+
+		var reqs []*rpcRequest
+		if batch {
+			assert.NoError(t, json.Unmarshal(body, &reqs))
+		} else {
+			req := &rpcRequest{}
+			assert.NoError(t, json.Unmarshal(body, req))
+			reqs = append(reqs, req)
+		}
+
+		resps := make([]*rpcResponse, 0, len(reqs))
+		for _, req := range reqs {
+			resp := &rpcResponse{JSONRPC: "2.0", ID: req.ID}
+			if res := handler(req); res != nil {
+				resp.Result = res
+			} else {
+				resp.Error = map[string]interface{}{"code": -32601, "message": "method not found"}
+			}
+			resps = append(resps, resp)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if batch {
+			json.NewEncoder(w).Encode(resps)
+		} else {
+			json.NewEncoder(w).Encode(resps[0])
+		}
+	}))
+}
+
+func TestRpcDebugTraceCall(t *testing.T) {
+	logger := httplog.NewLogger("")
+	codeAddr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	code := "0x00"
+
+	var traceConfig map[string]interface{}
+	node := fakeNode(t, func(req *rpcRequest) interface{} {
+		switch req.Method {
+		case "eth_call":
+			return probeResult
+		case "debug_traceCall":
+			assert.NoError(t, json.Unmarshal(req.Params[2], &traceConfig))
+			return map[string]interface{}{
+				"failed":      false,
+				"gas":         21000,
+				"returnValue": probeResult,
+				"structLogs": []map[string]interface{}{
+					{"pc": 0, "op": "PUSH1", "gas": 100, "gasCost": 3, "depth": 1, "stack": []string{}},
+					{"pc": 2, "op": "SLOAD", "gas": 97, "gasCost": 2100, "depth": 1, "stack": []string{"0x1"}},
+				},
+			}
+		}
+		return nil
+	})
+	defer node.Close()
+
+	base, err := ethrpc.NewProvider(node.URL)
+	assert.NoError(t, err)
+
+	extended := provider.NewExtendedAuto(context.Background(), base)
+	assert.True(t, extended.SupportsDebug())
+	assert.True(t, extended.SupportsOverride())
+
+	for _, tracer := range []string{debugger.RpcTracerStruct, debugger.RpcTracerJS} {
+		rpcDebugger, err := debugger.NewRpcDebugger(logger, nil, extended, tracer)
+		assert.NoError(t, err)
+
+		from := common.HexToAddress("0xFD095316B59e6224dC84f83E68F9603A684AD8df")
+		result, err := rpcDebugger.DebugTraceCall(context.Background(), &debugger.DebugCallArgs{
+			From: from,
+			To:   codeAddr,
+			Data: []byte{0x01},
+		}, &debugger.DebugOverrideArgs{
+			codeAddr: {Code: &code},
+		})
+
+		assert.NoError(t, err)
+		assert.False(t, result.Failed)
+		assert.Equal(t, from, result.From)
+		assert.Equal(t, probeResult, "0x"+result.ReturnValue)
+		assert.Len(t, result.StructLogs, 2)
+		assert.Equal(t, "SLOAD", result.StructLogs[1].Op)
+		assert.Equal(t, []string{"0x1"}, result.StructLogs[1].Stack)
+
+		// The overrides are sent with the trace config
+		assert.Contains(t, traceConfig["stateOverrides"], strings.ToLower(codeAddr.Hex()))
+		if tracer == debugger.RpcTracerJS {
+			assert.Contains(t, traceConfig["tracer"], "structLogs")
+		} else {
+			assert.Nil(t, traceConfig["tracer"])
+		}
+	}
+}
+
+func TestRpcDebuggerUnsupported(t *testing.T) {
+	logger := httplog.NewLogger("")
+
+	node := fakeNode(t, func(req *rpcRequest) interface{} {
+		if req.Method == "eth_call" {
+			return probeResult
+		}
+		return nil
+	})
+	defer node.Close()
+
+	base, err := ethrpc.NewProvider(node.URL)
+	assert.NoError(t, err)
+
+	extended := provider.NewExtendedAuto(context.Background(), base)
+	assert.False(t, extended.SupportsDebug())
+	assert.True(t, extended.SupportsOverride())
+
+	_, err = debugger.NewRpcDebugger(logger, nil, extended, "")
+	assert.Error(t, err)
+}
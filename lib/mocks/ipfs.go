@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"context"
+
 	"github.com/0xsequence/bundler/ipfs"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,4 +16,9 @@ func (m *MockIPFS) Report(data []byte) (string, error) {
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockIPFS) Fetch(ctx context.Context, cid string) ([]byte, error) {
+	args := m.Called(ctx, cid)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 var _ ipfs.Interface = &MockIPFS{}
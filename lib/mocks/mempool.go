@@ -6,6 +6,7 @@ import (
 
 	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/mempool/partitioner"
 	"github.com/0xsequence/bundler/proto"
 	"github.com/stretchr/testify/mock"
 )
@@ -35,6 +36,10 @@ func (m *MockMempool) ReleaseOps(ctx context.Context, ops []string, updateReadyA
 	m.Called(ctx, ops, updateReadyAt)
 }
 
+func (m *MockMempool) FailOps(ctx context.Context, ops []string, delay time.Duration, endorserFailure bool) {
+	m.Called(ctx, ops, delay, endorserFailure)
+}
+
 func (m *MockMempool) DiscardOps(ctx context.Context, ops []string) {
 	m.Called(ctx, ops)
 }
@@ -51,4 +56,20 @@ func (m *MockMempool) KnownOperations() []string {
 	return m.Called().Get(0).([]string)
 }
 
+func (m *MockMempool) OperationHashes() []string {
+	return m.Called().Get(0).([]string)
+}
+
+func (m *MockMempool) OperationsByHash(hashes []string) []*types.Operation {
+	return m.Called(hashes).Get(0).([]*types.Operation)
+}
+
+func (m *MockMempool) DependencyKeys() []*partitioner.DependencyKey {
+	return m.Called().Get(0).([]*partitioner.DependencyKey)
+}
+
+func (m *MockMempool) OpsByDependencies(keys []string) []string {
+	return m.Called(keys).Get(0).([]string)
+}
+
 var _ mempool.Interface = &MockMempool{}
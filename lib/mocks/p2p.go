@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/0xsequence/bundler/p2p"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -35,10 +37,57 @@ func (m *MockP2p) HandleTopic(ctx context.Context, topic p2p.PubsubTopic, handle
 	return args.Error(0)
 }
 
+// HandleStream implements p2p.Interface.
+func (m *MockP2p) HandleStream(ctx context.Context, proto p2p.StreamProtocol, handler p2p.StreamHandler) error {
+	args := m.Called(ctx, proto, handler)
+	return args.Error(0)
+}
+
+// Request implements p2p.Interface.
+func (m *MockP2p) Request(ctx context.Context, p peer.ID, proto p2p.StreamProtocol, req []byte) ([]byte, error) {
+	args := m.Called(ctx, p, proto, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+// Peers implements p2p.Interface.
+func (m *MockP2p) Peers() []peer.ID {
+	args := m.Called()
+	return args.Get(0).([]peer.ID)
+}
+
+// PriorityPeers implements p2p.Interface.
+func (m *MockP2p) PriorityPeers() []peer.ID {
+	args := m.Called()
+	return args.Get(0).([]peer.ID)
+}
+
 // Sign implements p2p.Interface.
 func (m *MockP2p) Sign(data []byte) ([]byte, error) {
 	args := m.Called(data)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+// ReportPeer implements p2p.Interface.
+func (m *MockP2p) ReportPeer(p peer.ID, outcome p2p.PeerOutcome) {
+	m.Called(p, outcome)
+}
+
+// TrackOperation implements p2p.Interface.
+func (m *MockP2p) TrackOperation(p peer.ID, oph string, endorser common.Address) {
+	m.Called(p, oph, endorser)
+}
+
+// ReportOperation implements p2p.Interface.
+func (m *MockP2p) ReportOperation(oph string, outcome p2p.PeerOutcome) {
+	m.Called(oph, outcome)
+}
+
+// ReportBannedEndorser implements p2p.Interface.
+func (m *MockP2p) ReportBannedEndorser(endorser common.Address) {
+	m.Called(endorser)
+}
+
 var _ p2p.Interface = &MockP2p{}
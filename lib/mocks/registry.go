@@ -40,6 +40,10 @@ func (m *MockRegistry) StatusForEndorser(endorser common.Address) registry.Endor
 	return registry.EndorserStatus(m.Called(endorser).Int(0))
 }
 
+func (m *MockRegistry) ReportGasUsage(endorser common.Address, used uint64, limit uint64) {
+	m.Called(endorser, used, limit)
+}
+
 func (m *MockRegistry) TrustEndorser(endorser common.Address) {
 	m.Called(endorser)
 }
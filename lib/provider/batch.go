@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"math/big"
 	"time"
 
+	"github.com/0xsequence/ethkit/ethrpc"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
 )
 
@@ -46,11 +48,46 @@ func (b *Batched) StorageAtBatch(ctx context.Context, address common.Address, sl
 	}
 }
 
+// AccountAt fetches the balance, nonce and code of the account
+// in a single JSON-RPC batch
+func (b *Batched) AccountAt(ctx context.Context, account common.Address, blockNum *big.Int) (*big.Int, uint64, []byte, error) {
+	var (
+		balance *big.Int
+		nonce   uint64
+		code    []byte
+	)
+
+	_, err := b.Do(
+		ctx,
+		ethrpc.BalanceAt(account, blockNum).Into(&balance),
+		ethrpc.NonceAt(account, blockNum).Into(&nonce),
+		ethrpc.CodeAt(account, blockNum).Into(&code),
+	)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	return balance, nonce, code, nil
+}
+
 // Source: contracts/src/tools/BatchCaller.huff
 const BatchCallerProgram = "0x60003560205b803614610041578035906020018035906020018181600037810191600091600060006000935af1503d8252906020013d6000823e3d0190610005565b60003580920382f3"
 const BatchCallerPlaceholder = "0xf67dB61Ea957e88f9702D169D50C2e579766e089"
 
 func BatchCall(ctx context.Context, provider *Extended, calls []*SimpleCall, overrides OverrideArgs) ([][]byte, error) {
+	call, overrides := EncodeBatchCall(calls, overrides)
+
+	res, err := provider.CallWithOverride(ctx, call, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("fetcher: call failed: %w", err)
+	}
+
+	return DecodeBatchCall(res, len(calls))
+}
+
+// EncodeBatchCall builds the call to the batch caller program, with
+// the overrides it needs on top of the given ones
+func EncodeBatchCall(calls []*SimpleCall, overrides OverrideArgs) (*Call, OverrideArgs) {
 	// Generate the call data
 	// encoding all slots one after the other
 	// the program takes max_size(32):(address(32):size(32):calldata)[]
@@ -93,20 +130,20 @@ func BatchCall(ctx context.Context, provider *Extended, calls []*SimpleCall, ove
 		Code: &bc,
 	}
 
-	res, err := provider.CallWithOverride(ctx, &Call{
+	return &Call{
 		To:   bcp,
 		Data: "0x" + common.Bytes2Hex(calldata),
-	}, overrides)
-	if err != nil {
-		return nil, fmt.Errorf("fetcher: call failed: %w", err)
-	}
+	}, overrides
+}
 
+// DecodeBatchCall splits the result of the batch caller program
+func DecodeBatchCall(res []byte, n int) ([][]byte, error) {
 	// Decode the response
 	// returns (size(32):returndata)[]
-	results := make([][]byte, len(calls))
+	results := make([][]byte, n)
 
 	rindex := 0
-	for i := 0; i < len(calls); i++ {
+	for i := 0; i < n; i++ {
 		if len(res) < rindex+32 {
 			return nil, fmt.Errorf("fetcher: unexpected response length (size)")
 		}
@@ -3,16 +3,21 @@ package provider
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/0xsequence/ethkit/ethrpc"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type extendedMetrics struct {
 	overrideCalls *prometheus.CounterVec
+	debugCalls    *prometheus.CounterVec
 
 	supportsDebug    prometheus.Gauge
 	supportsOverride prometheus.Gauge
@@ -41,6 +46,10 @@ func createMetrics() *extendedMetrics {
 			Name: "override_calls",
 			Help: "Number of override calls made",
 		}, []string{"result"}),
+		debugCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "debug_calls",
+			Help: "Number of debug trace calls made",
+		}, []string{"result"}),
 	}
 }
 
@@ -49,12 +58,19 @@ func (e *extendedMetrics) register(reg prometheus.Registerer) {
 		e.supportsDebug,
 		e.supportsOverride,
 		e.overrideCalls,
+		e.debugCalls,
 	)
 }
 
-func NewExtendedAuto(provider *ethrpc.Provider) *Extended {
-	// TODO Do a call to the provider to check if it supports debug and override
-	return &Extended{
+// Returns 0x...01 as a 32 bytes word, used to probe the provider
+const probeProgram = "0x600160005260206000f3"
+const probePlaceholder = "0x000000000000000000000000000000000000dEaD"
+
+// NewExtendedAuto probes the provider to find out if it supports
+// debug_traceCall and state overrides, if the probe can't reach the
+// provider the support is left as unknown.
+func NewExtendedAuto(ctx context.Context, provider *ethrpc.Provider) *Extended {
+	e := &Extended{
 		Provider: provider,
 
 		metrics: createMetrics(),
@@ -62,6 +78,70 @@ func NewExtendedAuto(provider *ethrpc.Provider) *Extended {
 		supportsDebug:    &atomic.Int32{},
 		supportsOverride: &atomic.Int32{},
 	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	e.supportsOverride.Store(e.probeOverride(ctx2))
+	e.supportsDebug.Store(e.probeDebug(ctx2))
+
+	e.metrics.supportsDebug.Set(float64(e.supportsDebug.Load()))
+	e.metrics.supportsOverride.Set(float64(e.supportsOverride.Load()))
+
+	return e
+}
+
+func probeOverrides() (*Call, OverrideArgs) {
+	pp := probeProgram
+	addr := common.HexToAddress(probePlaceholder)
+	return &Call{To: addr}, OverrideArgs{addr: &Override{Code: &pp}}
+}
+
+func isProbeResult(res []byte) bool {
+	return len(res) == 32 && res[31] == 1 && bytes.Equal(res[:31], make([]byte, 31))
+}
+
+// Transport errors don't tell us anything about the supported methods
+func unreachable(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, ethrpc.ErrRequestFail)
+}
+
+func (p *Extended) probeOverride(ctx context.Context) int32 {
+	call, overrides := probeOverrides()
+
+	rpcCall := ethrpc.NewCallBuilder[string]("eth_call", nil, call, "latest", overrides)
+	var res string
+	_, err := p.Do(ctx, rpcCall.Into(&res))
+	if unreachable(ctx, err) {
+		return 0
+	}
+	if err != nil || !isProbeResult(common.FromHex(res)) {
+		return 2
+	}
+
+	return 1
+}
+
+func (p *Extended) probeDebug(ctx context.Context) int32 {
+	call, overrides := probeOverrides()
+
+	var res struct {
+		Failed      bool   `json:"failed"`
+		ReturnValue string `json:"returnValue"`
+	}
+	err := p.debugTraceCall(ctx, call, &TraceConfig{
+		DisableStack:   true,
+		DisableStorage: true,
+		StateOverrides: overrides,
+	}, &res)
+	if unreachable(ctx, err) {
+		return 0
+	}
+	if err != nil || res.Failed || !isProbeResult(common.FromHex(res.ReturnValue)) {
+		return 2
+	}
+
+	return 1
 }
 
 func (p *Extended) SetRegisterer(reg prometheus.Registerer) {
@@ -104,8 +184,10 @@ func (p *Extended) SupportsOverride() bool {
 }
 
 type Call struct {
-	To   common.Address `json:"to"`
-	Data string         `json:"data"`
+	From *common.Address `json:"from,omitempty"`
+	To   common.Address  `json:"to"`
+	Data string          `json:"data"`
+	Gas  *hexutil.Uint64 `json:"gas,omitempty"`
 }
 
 type Override struct {
@@ -135,6 +217,48 @@ func (p *Extended) CallWithOverride(ctx context.Context, call *Call, overrides O
 	return common.FromHex(res), nil
 }
 
+type TraceConfig struct {
+	DisableStorage   bool         `json:"disableStorage,omitempty"`
+	DisableStack     bool         `json:"disableStack,omitempty"`
+	EnableMemory     bool         `json:"enableMemory,omitempty"`
+	EnableReturnData bool         `json:"enableReturnData,omitempty"`
+	Tracer           *string      `json:"tracer,omitempty"`
+	Timeout          *string      `json:"timeout,omitempty"`
+	StateOverrides   OverrideArgs `json:"stateOverrides,omitempty"`
+}
+
+// DebugTraceCall runs debug_traceCall on top of the latest block,
+// the result depends on the tracer so it is decoded into res
+func (p *Extended) DebugTraceCall(ctx context.Context, call *Call, config *TraceConfig, res interface{}) error {
+	if p.supportsDebug.Load() == 2 {
+		p.metrics.debugCalls.WithLabelValues("unsupported").Inc()
+		return fmt.Errorf("provider does not support debug_traceCall")
+	}
+
+	if err := p.debugTraceCall(ctx, call, config, res); err != nil {
+		p.metrics.debugCalls.WithLabelValues("error").Inc()
+		return err
+	}
+
+	p.metrics.debugCalls.WithLabelValues("success").Inc()
+	return nil
+}
+
+func (p *Extended) debugTraceCall(ctx context.Context, call *Call, config *TraceConfig, res interface{}) error {
+	rpcCall := ethrpc.NewCallBuilder[json.RawMessage]("debug_traceCall", nil, call, "latest", config)
+	var raw json.RawMessage
+	_, err := p.Do(ctx, rpcCall.Into(&raw))
+	if err != nil {
+		return fmt.Errorf("debug_traceCall failed: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, res); err != nil {
+		return fmt.Errorf("unable to decode trace: %w", err)
+	}
+
+	return nil
+}
+
 func (a OverrideArgs) Merge(b OverrideArgs) error {
 	for k, v := range b {
 		if _, ok := a[k]; ok {
@@ -0,0 +1,746 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/ethkit/ethrpc"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/go-chi/httplog/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultHealthCheckInterval = 15 * time.Second
+	DefaultBreakerFailures     = 3
+	DefaultBreakerCooldown     = 30 * time.Second
+)
+
+// Batch sizes probed on every upstream, from the largest
+var probeBatchSizes = []int{100, 50, 20, 10}
+
+// Capabilities of an upstream, found by probing it at startup
+type Capabilities struct {
+	Override   bool
+	Debug      bool
+	FeeHistory bool
+	// Largest batch accepted, 0 if there is no known limit
+	MaxBatch int
+}
+
+// covers tells if the capabilities are enough for a request,
+// the batch size is not checked as batches can be split
+func (c *Capabilities) covers(need *Capabilities) bool {
+	return (!need.Override || c.Override) &&
+		(!need.Debug || c.Debug) &&
+		(!need.FeeHistory || c.FeeHistory)
+}
+
+type upstream struct {
+	index  int
+	url    string
+	weight uint
+
+	lock      sync.Mutex
+	probed    bool
+	caps      Capabilities
+	failures  uint
+	openUntil time.Time
+}
+
+func (u *upstream) label() string {
+	return strconv.Itoa(u.index)
+}
+
+func (u *upstream) capabilities() (Capabilities, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.caps, u.probed
+}
+
+// available is false while the breaker is open, once the cooldown
+// passes requests go through again, a single failure opens it back
+func (u *upstream) available(now time.Time) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return !now.Before(u.openUntil)
+}
+
+type routerMetrics struct {
+	requests    *prometheus.CounterVec
+	failovers   prometheus.Counter
+	splits      prometheus.Counter
+	breakerOpen *prometheus.GaugeVec
+	blockNumber *prometheus.GaugeVec
+	capability  *prometheus.GaugeVec
+}
+
+func createRouterMetrics() *routerMetrics {
+	// Upstreams are labeled by their position in the
+	// config, their urls may contain api keys
+	return &routerMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_upstream_requests",
+			Help: "Number of requests sent to every upstream",
+		}, []string{"upstream", "result"}),
+		failovers: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "rpc_upstream_failovers",
+			Help: "Number of requests retried on another upstream",
+		}),
+		splits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "rpc_upstream_batch_splits",
+			Help: "Number of batches split to fit the batch limit of an upstream",
+		}),
+		breakerOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rpc_upstream_breaker_open",
+			Help: "Whether the circuit breaker of the upstream is open",
+		}, []string{"upstream"}),
+		blockNumber: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rpc_upstream_block_number",
+			Help: "Last block number reported by the upstream health check",
+		}, []string{"upstream"}),
+		capability: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rpc_upstream_capability",
+			Help: "Capabilities of the upstream, the batch capability is its max batch size",
+		}, []string{"upstream", "capability"}),
+	}
+}
+
+func (m *routerMetrics) register(reg prometheus.Registerer) {
+	reg.MustRegister(
+		m.requests,
+		m.failovers,
+		m.splits,
+		m.breakerOpen,
+		m.blockNumber,
+		m.capability,
+	)
+}
+
+// Router is an http.RoundTripper that spreads JSON-RPC requests over
+// multiple upstreams, requests only go to upstreams that support the
+// methods they use, and are retried on the next upstream if one fails.
+// Upstreams that keep failing are skipped until their breaker cools down.
+type Router struct {
+	logger  *httplog.Logger
+	metrics *routerMetrics
+
+	transport http.RoundTripper
+	upstreams []*upstream
+
+	healthCheckInterval time.Duration
+	breakerFailures     uint
+	breakerCooldown     time.Duration
+	maxBlockLag         uint64
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+var _ http.RoundTripper = (*Router)(nil)
+
+func NewRouter(ctx context.Context, cfg *config.NetworkConfig, logger *httplog.Logger, transport http.RoundTripper) (*Router, error) {
+	endpoints := cfg.Endpoints()
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("router: no rpc endpoints configured")
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r := &Router{
+		logger:  logger,
+		metrics: createRouterMetrics(),
+
+		transport: transport,
+
+		healthCheckInterval: time.Duration(cfg.HealthCheckSeconds) * time.Second,
+		breakerFailures:     cfg.BreakerFailures,
+		breakerCooldown:     time.Duration(cfg.BreakerCooldownSeconds) * time.Second,
+		maxBlockLag:         uint64(cfg.MaxBlockLag),
+
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if r.healthCheckInterval == 0 {
+		r.healthCheckInterval = DefaultHealthCheckInterval
+	}
+	if r.breakerFailures == 0 {
+		r.breakerFailures = DefaultBreakerFailures
+	}
+	if r.breakerCooldown == 0 {
+		r.breakerCooldown = DefaultBreakerCooldown
+	}
+
+	for i, e := range endpoints {
+		if e.Url == "" {
+			return nil, fmt.Errorf("router: rpc endpoint %d has no url", i)
+		}
+
+		r.upstreams = append(r.upstreams, &upstream{index: i, url: e.Url, weight: e.Weight})
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range r.upstreams {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+			r.probe(ctx, u)
+		}(u)
+	}
+	wg.Wait()
+
+	return r, nil
+}
+
+func (r *Router) SetRegisterer(reg prometheus.Registerer) {
+	r.metrics.register(reg)
+}
+
+// URL of the first endpoint, requests sent through the router
+// go to any upstream regardless of their url
+func (r *Router) URL() string {
+	return r.upstreams[0].url
+}
+
+// Listen serves the router on a local address for the components that
+// need the url of a node (e.g. to fork it), it returns the url
+func (r *Router) Listen(ctx context.Context) (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("router: unable to listen: %w", err)
+	}
+
+	server := &http.Server{Handler: r, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			r.logger.Warn("router: local endpoint stopped", "error", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	url := "http://" + l.Addr().String()
+	r.logger.Info("router: serving local endpoint", "url", url)
+	return url, nil
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+
+	res, err := r.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	_, _ = io.Copy(w, res.Body)
+}
+
+// Capabilities returns what at least one upstream supports,
+// requests that need a capability are routed to the upstreams that have it
+func (r *Router) Capabilities() Capabilities {
+	var caps Capabilities
+	unlimited := false
+	for _, u := range r.upstreams {
+		c, probed := u.capabilities()
+		if !probed {
+			continue
+		}
+
+		caps.Override = caps.Override || c.Override
+		caps.Debug = caps.Debug || c.Debug
+		caps.FeeHistory = caps.FeeHistory || c.FeeHistory
+		unlimited = unlimited || c.MaxBatch == 0
+		caps.MaxBatch = max(caps.MaxBatch, c.MaxBatch)
+	}
+
+	if unlimited {
+		caps.MaxBatch = 0
+	}
+	return caps
+}
+
+func (r *Router) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-time.After(r.healthCheckInterval):
+			r.healthCheck(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Router) provider(u *upstream) *ethrpc.Provider {
+	// The url is always valid, NewProvider never fails
+	p, _ := ethrpc.NewProvider(u.url)
+	p.SetHTTPClient(&http.Client{Transport: r.transport})
+	return p
+}
+
+// probe finds out the capabilities of an upstream, if it can't be
+// reached it is left unprobed and only gets requests when no other
+// upstream is available, the health check probes it again later
+func (r *Router) probe(ctx context.Context, u *upstream) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	p := r.provider(u)
+	e := &Extended{Provider: p}
+
+	override := e.probeOverride(ctx)
+	debug := e.probeDebug(ctx)
+	if override == 0 || debug == 0 {
+		r.logger.Warn("router: unable to probe upstream", "upstream", u.index)
+		return
+	}
+
+	caps := Capabilities{
+		Override:   override == 1,
+		Debug:      debug == 1,
+		FeeHistory: probeFeeHistory(ctx, p),
+		MaxBatch:   1,
+	}
+
+	for _, size := range probeBatchSizes {
+		if probeBatch(ctx, p, size) {
+			caps.MaxBatch = size
+			break
+		}
+	}
+
+	// Accepting the largest probe doesn't mean there is no limit, but it
+	// is large enough to not be worth splitting batches for it
+	if caps.MaxBatch == probeBatchSizes[0] {
+		caps.MaxBatch = 0
+	}
+
+	u.lock.Lock()
+	u.caps = caps
+	u.probed = true
+	u.lock.Unlock()
+
+	r.logger.Info(
+		"router: probed upstream",
+		"upstream", u.index,
+		"weight", u.weight,
+		"override", caps.Override,
+		"debug", caps.Debug,
+		"feeHistory", caps.FeeHistory,
+		"maxBatch", caps.MaxBatch,
+	)
+
+	label := u.label()
+	r.metrics.capability.WithLabelValues(label, "override").Set(boolValue(caps.Override))
+	r.metrics.capability.WithLabelValues(label, "debug").Set(boolValue(caps.Debug))
+	r.metrics.capability.WithLabelValues(label, "fee_history").Set(boolValue(caps.FeeHistory))
+	r.metrics.capability.WithLabelValues(label, "batch").Set(float64(caps.MaxBatch))
+}
+
+func probeFeeHistory(ctx context.Context, p *ethrpc.Provider) bool {
+	call := ethrpc.NewCallBuilder[json.RawMessage]("eth_feeHistory", nil, "0x1", "latest", []float64{})
+	var res json.RawMessage
+	_, err := p.Do(ctx, call.Into(&res))
+	return err == nil
+}
+
+func probeBatch(ctx context.Context, p *ethrpc.Provider, size int) bool {
+	calls := make([]ethrpc.Call, size)
+	for i := range calls {
+		calls[i] = ethrpc.NewCallBuilder[string]("eth_chainId", nil).Into(new(string))
+	}
+
+	_, err := p.Do(ctx, calls...)
+	return err == nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// healthCheck reads the head of every upstream, the ones that fail or
+// that lag behind the others count as failed requests, upstreams that
+// could not be probed at startup are probed again
+func (r *Router) healthCheck(ctx context.Context) {
+	heads := make([]uint64, len(r.upstreams))
+
+	var wg sync.WaitGroup
+	for i, u := range r.upstreams {
+		wg.Add(1)
+		go func(i int, u *upstream) {
+			defer wg.Done()
+
+			if _, probed := u.capabilities(); !probed {
+				r.probe(ctx, u)
+				if _, probed := u.capabilities(); !probed {
+					return
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+
+			var head hexutil.Uint64
+			_, err := r.provider(u).Do(ctx, ethrpc.NewCallBuilder[hexutil.Uint64]("eth_blockNumber", nil).Into(&head))
+			if err != nil {
+				r.logger.Warn("router: health check failed", "upstream", u.index, "error", err)
+				r.fail(u)
+				return
+			}
+
+			heads[i] = uint64(head)
+			r.metrics.blockNumber.WithLabelValues(u.label()).Set(float64(head))
+		}(i, u)
+	}
+	wg.Wait()
+
+	if r.maxBlockLag == 0 {
+		return
+	}
+
+	var best uint64
+	for _, h := range heads {
+		best = max(best, h)
+	}
+
+	for i, u := range r.upstreams {
+		if heads[i] == 0 {
+			continue
+		}
+
+		if best-heads[i] > r.maxBlockLag {
+			r.logger.Warn("router: upstream is lagging", "upstream", u.index, "head", heads[i], "best", best)
+			r.fail(u)
+		} else {
+			r.succeed(u)
+		}
+	}
+}
+
+func (r *Router) fail(u *upstream) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.failures++
+	if u.failures >= r.breakerFailures {
+		if time.Now().After(u.openUntil) {
+			r.logger.Warn("router: opening breaker", "upstream", u.index, "failures", u.failures)
+		}
+
+		u.openUntil = time.Now().Add(r.breakerCooldown)
+		r.metrics.breakerOpen.WithLabelValues(u.label()).Set(1)
+	}
+}
+
+func (r *Router) succeed(u *upstream) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.failures >= r.breakerFailures {
+		r.logger.Info("router: closing breaker", "upstream", u.index)
+	}
+
+	u.failures = 0
+	u.openUntil = time.Time{}
+	r.metrics.breakerOpen.WithLabelValues(u.label()).Set(0)
+}
+
+type rpcMessage struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcResult struct {
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// upstreamFault finds errors of a successful response that are caused by
+// the upstream and not by the request (e.g. rate limits), another upstream
+// may serve the request. The body of the response is kept readable.
+func upstreamFault(res *http.Response) (string, error) {
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	var results []rpcResult
+	body = bytes.TrimSpace(body)
+	if len(body) != 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &results)
+	} else {
+		results = make([]rpcResult, 1)
+		err = json.Unmarshal(body, &results[0])
+	}
+	if err != nil {
+		// Not a JSON-RPC response, let the caller handle it
+		return "", nil
+	}
+
+	for _, res := range results {
+		if res.Error == nil {
+			continue
+		}
+
+		msg := strings.ToLower(res.Error.Message)
+		switch {
+		case res.Error.Code == -32601:
+			return "method not found", nil
+		case res.Error.Code == -32005, strings.Contains(msg, "rate limit"), strings.Contains(msg, "too many requests"):
+			return "rate limited", nil
+		}
+	}
+
+	return "", nil
+}
+
+// requirements returns the capabilities needed to serve the request
+func requirements(msgs []rpcMessage) *Capabilities {
+	need := &Capabilities{MaxBatch: len(msgs)}
+
+	for _, m := range msgs {
+		switch {
+		case strings.HasPrefix(m.Method, "debug_"):
+			need.Debug = true
+		case m.Method == "eth_feeHistory":
+			need.FeeHistory = true
+		case (m.Method == "eth_call" || m.Method == "eth_estimateGas") && len(m.Params) > 2 && string(m.Params[2]) != "null":
+			need.Override = true
+		}
+	}
+
+	return need
+}
+
+func parseBody(body []byte) ([]rpcMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) != 0 && body[0] == '[' {
+		var msgs []rpcMessage
+		err := json.Unmarshal(body, &msgs)
+		return msgs, true, err
+	}
+
+	var msg rpcMessage
+	err := json.Unmarshal(body, &msg)
+	return []rpcMessage{msg}, false, err
+}
+
+// candidates returns the upstreams that can serve the request in the order
+// they should be tried, the first one is picked at random by weight and the
+// rest go by weight, upstreams with weight 0 are only used as backups.
+// If none is available the request goes to any upstream that may serve it.
+func (r *Router) candidates(need *Capabilities) []*upstream {
+	now := time.Now()
+
+	var capable, available []*upstream
+	for _, u := range r.upstreams {
+		caps, probed := u.capabilities()
+		if probed && !caps.covers(need) {
+			continue
+		}
+
+		capable = append(capable, u)
+		if probed && u.available(now) {
+			available = append(available, u)
+		}
+	}
+
+	if len(available) == 0 {
+		if len(capable) != 0 {
+			return capable
+		}
+		return r.upstreams
+	}
+
+	sort.SliceStable(available, func(i, j int) bool {
+		return available[i].weight > available[j].weight
+	})
+
+	var total uint
+	for _, u := range available {
+		total += u.weight
+	}
+
+	if total != 0 {
+		r.randLock.Lock()
+		pick := uint(r.rand.Int63n(int64(total)))
+		r.randLock.Unlock()
+
+		for i, u := range available {
+			if pick < u.weight {
+				copy(available[1:i+1], available[:i])
+				available[0] = u
+				break
+			}
+			pick -= u.weight
+		}
+	}
+
+	return available
+}
+
+func (r *Router) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msgs, isBatch, err := parseBody(body)
+	if err != nil {
+		// Not something we can route, any upstream can reject it
+		msgs, isBatch = nil, false
+	}
+
+	need := requirements(msgs)
+
+	var res *http.Response
+	candidates := r.candidates(need)
+	for i, u := range candidates {
+		if i != 0 {
+			r.metrics.failovers.Inc()
+		}
+
+		caps, _ := u.capabilities()
+		if isBatch && caps.MaxBatch != 0 && len(msgs) > caps.MaxBatch {
+			res, err = r.sendSplit(req, u, body, caps.MaxBatch)
+		} else {
+			res, err = r.send(req, u, body)
+		}
+
+		if req.Context().Err() != nil {
+			return res, err
+		}
+
+		var fault string
+		if err == nil && res.StatusCode >= 200 && res.StatusCode <= 299 {
+			fault, err = upstreamFault(res)
+		}
+
+		if err == nil && fault == "" && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			r.metrics.requests.WithLabelValues(u.label(), "success").Inc()
+			r.succeed(u)
+			return res, nil
+		}
+
+		r.metrics.requests.WithLabelValues(u.label(), "failure").Inc()
+		r.fail(u)
+
+		switch {
+		case err != nil:
+			r.logger.Debug("router: upstream request failed", "upstream", u.index, "error", err)
+		case fault != "":
+			r.logger.Debug("router: upstream request failed", "upstream", u.index, "fault", fault)
+		default:
+			r.logger.Debug("router: upstream request failed", "upstream", u.index, "status", res.StatusCode)
+		}
+
+		// Keep the last failed response to return it if all upstreams fail
+		if err == nil && i != len(candidates)-1 {
+			res.Body.Close()
+		}
+	}
+
+	return res, err
+}
+
+func (r *Router) send(req *http.Request, u *upstream, body []byte) (*http.Response, error) {
+	out, err := http.NewRequestWithContext(req.Context(), req.Method, u.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range req.Header {
+		out.Header[k] = v
+	}
+
+	return r.transport.RoundTrip(out)
+}
+
+// sendSplit sends a batch as multiple smaller batches
+// to the same upstream and joins their responses
+func (r *Router) sendSplit(req *http.Request, u *upstream, body []byte, size int) (*http.Response, error) {
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(body, &msgs); err != nil {
+		return nil, err
+	}
+
+	r.metrics.splits.Inc()
+
+	joined := make([]json.RawMessage, 0, len(msgs))
+	for start := 0; start < len(msgs); start += size {
+		chunk, err := json.Marshal(msgs[start:min(start+size, len(msgs))])
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := r.send(req, u, chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return res, nil
+		}
+
+		var results []json.RawMessage
+		err = json.NewDecoder(res.Body).Decode(&results)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("router: unable to decode batch response: %w", err)
+		}
+
+		joined = append(joined, results...)
+	}
+
+	data, err := json.Marshal(joined)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
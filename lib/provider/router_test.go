@@ -0,0 +1,303 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/lib/provider"
+	"github.com/0xsequence/ethkit/ethrpc"
+	"github.com/go-chi/httplog/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const probeWord = "0x0000000000000000000000000000000000000000000000000000000000000001"
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// fakeNode is a JSON-RPC endpoint with configurable capabilities
+type fakeNode struct {
+	override   bool
+	debug      bool
+	feeHistory bool
+	maxBatch   int
+
+	down    atomic.Bool
+	limited atomic.Bool
+
+	lock    sync.Mutex
+	methods map[string]int
+	batches []int
+}
+
+func (n *fakeNode) calls(method string) int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.methods[method]
+}
+
+func (n *fakeNode) result(req *rpcRequest) map[string]interface{} {
+	res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	unsupported := map[string]interface{}{"code": -32601, "message": "method not found"}
+
+	if n.limited.Load() {
+		res["error"] = map[string]interface{}{"code": -32005, "message": "rate limit exceeded"}
+		return res
+	}
+
+	switch req.Method {
+	case "eth_call":
+		if len(req.Params) > 2 && !n.override {
+			res["error"] = unsupported
+		} else {
+			res["result"] = probeWord
+		}
+	case "eth_estimateGas":
+		// Some nodes ignore the overrides instead of failing
+		res["result"] = "0x5208"
+	case "debug_traceCall":
+		if n.debug {
+			res["result"] = map[string]interface{}{"failed": false, "returnValue": probeWord[2:]}
+		} else {
+			res["error"] = unsupported
+		}
+	case "eth_feeHistory":
+		if n.feeHistory {
+			res["result"] = map[string]interface{}{"oldestBlock": "0x1"}
+		} else {
+			res["error"] = unsupported
+		}
+	case "eth_chainId":
+		res["result"] = "0x1"
+	case "eth_blockNumber":
+		res["result"] = "0x10"
+	default:
+		res["error"] = unsupported
+	}
+
+	return res
+}
+
+func (n *fakeNode) reset() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.methods = nil
+	n.batches = nil
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	var reqs []*rpcRequest
+	batch := len(body) != 0 && body[0] == '['
+	if batch {
+		_ = json.Unmarshal(body, &reqs)
+	} else {
+		req := &rpcRequest{}
+		_ = json.Unmarshal(body, req)
+		reqs = append(reqs, req)
+	}
+
+	n.lock.Lock()
+	if n.methods == nil {
+		n.methods = map[string]int{}
+	}
+	for _, req := range reqs {
+		n.methods[req.Method]++
+	}
+	if batch {
+		n.batches = append(n.batches, len(reqs))
+	}
+	n.lock.Unlock()
+
+	if n.down.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if n.maxBatch != 0 && len(reqs) > n.maxBatch {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !batch {
+		_ = json.NewEncoder(w).Encode(n.result(reqs[0]))
+		return
+	}
+
+	results := make([]interface{}, len(reqs))
+	for i, req := range reqs {
+		results[i] = n.result(req)
+	}
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+func newRouter(t *testing.T, cfg *config.NetworkConfig, nodes ...*fakeNode) (*provider.Router, *ethrpc.Provider) {
+	for _, n := range nodes {
+		server := httptest.NewServer(n)
+		t.Cleanup(server.Close)
+
+		cfg.RpcUrls = append(cfg.RpcUrls, config.RpcEndpoint{Url: server.URL, Weight: 1})
+	}
+
+	router, err := provider.NewRouter(context.Background(), cfg, httplog.NewLogger(""), nil)
+	require.NoError(t, err)
+
+	p, err := ethrpc.NewProvider(router.URL())
+	require.NoError(t, err)
+	p.SetHTTPClient(&http.Client{Transport: router})
+
+	return router, p
+}
+
+func TestRouterCapabilities(t *testing.T) {
+	full := &fakeNode{override: true, debug: true, feeHistory: true}
+	basic := &fakeNode{maxBatch: 20}
+
+	router, p := newRouter(t, &config.NetworkConfig{}, basic, full)
+
+	caps := router.Capabilities()
+	assert.True(t, caps.Override)
+	assert.True(t, caps.Debug)
+	assert.True(t, caps.FeeHistory)
+	assert.Equal(t, 0, caps.MaxBatch)
+
+	// The probes go through the router, so they reach the capable node
+	extended := provider.NewExtendedAuto(context.Background(), p)
+	assert.True(t, extended.SupportsDebug())
+	assert.True(t, extended.SupportsOverride())
+
+	for i := 0; i < 10; i++ {
+		var res struct {
+			Failed bool `json:"failed"`
+		}
+		err := extended.DebugTraceCall(context.Background(), &provider.Call{}, &provider.TraceConfig{}, &res)
+		assert.NoError(t, err)
+	}
+
+	// Only the probe reached the basic node
+	assert.Equal(t, 1, basic.calls("debug_traceCall"))
+	assert.Equal(t, 12, full.calls("debug_traceCall"))
+
+	// Estimations with overrides need the support too
+	overrides := map[string]interface{}{"0x0000000000000000000000000000000000000001": map[string]string{"code": "0x00"}}
+	for i := 0; i < 10; i++ {
+		var gas string
+		_, err := p.Do(context.Background(), ethrpc.NewCallBuilder[string]("eth_estimateGas", nil, &provider.Call{}, "latest", overrides).Into(&gas))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0, basic.calls("eth_estimateGas"))
+	assert.Equal(t, 10, full.calls("eth_estimateGas"))
+}
+
+func TestRouterFailover(t *testing.T) {
+	a := &fakeNode{}
+	b := &fakeNode{}
+
+	cfg := &config.NetworkConfig{BreakerFailures: 2}
+	_, p := newRouter(t, cfg, a, b)
+
+	a.down.Store(true)
+	a.reset()
+	b.reset()
+
+	for i := 0; i < 20; i++ {
+		var chainID string
+		_, err := p.Do(context.Background(), ethrpc.NewCallBuilder[string]("eth_chainId", nil).Into(&chainID))
+		assert.NoError(t, err)
+		assert.Equal(t, "0x1", chainID)
+	}
+
+	// The breaker opens after two failed requests
+	assert.Equal(t, 20, b.calls("eth_chainId"))
+	assert.LessOrEqual(t, a.calls("eth_chainId"), 2)
+}
+
+func TestRouterFailoverOnRateLimit(t *testing.T) {
+	a := &fakeNode{}
+	b := &fakeNode{}
+
+	cfg := &config.NetworkConfig{BreakerFailures: 2}
+	_, p := newRouter(t, cfg, a, b)
+
+	// The errors come inside successful responses
+	a.limited.Store(true)
+	a.reset()
+	b.reset()
+
+	for i := 0; i < 20; i++ {
+		var chainID string
+		_, err := p.Do(context.Background(), ethrpc.NewCallBuilder[string]("eth_chainId", nil).Into(&chainID))
+		assert.NoError(t, err)
+		assert.Equal(t, "0x1", chainID)
+	}
+
+	assert.Equal(t, 20, b.calls("eth_chainId"))
+	assert.LessOrEqual(t, a.calls("eth_chainId"), 2)
+}
+
+func TestRouterListen(t *testing.T) {
+	n := &fakeNode{}
+
+	router, _ := newRouter(t, &config.NetworkConfig{}, n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	url, err := router.Listen(ctx)
+	require.NoError(t, err)
+
+	p, err := ethrpc.NewProvider(url)
+	require.NoError(t, err)
+
+	var head string
+	_, err = p.Do(ctx, ethrpc.NewCallBuilder[string]("eth_blockNumber", nil).Into(&head))
+	require.NoError(t, err)
+	assert.Equal(t, "0x10", head)
+}
+
+func TestRouterAllDown(t *testing.T) {
+	a := &fakeNode{}
+
+	_, p := newRouter(t, &config.NetworkConfig{}, a)
+	a.down.Store(true)
+
+	_, err := p.Do(context.Background(), ethrpc.NewCallBuilder[string]("eth_chainId", nil).Into(new(string)))
+	assert.ErrorIs(t, err, ethrpc.ErrRequestFail)
+}
+
+func TestRouterSplitBatch(t *testing.T) {
+	n := &fakeNode{maxBatch: 10}
+
+	router, p := newRouter(t, &config.NetworkConfig{}, n)
+	assert.Equal(t, 10, router.Capabilities().MaxBatch)
+
+	results := make([]string, 25)
+	calls := make([]ethrpc.Call, len(results))
+	for i := range calls {
+		calls[i] = ethrpc.NewCallBuilder[string]("eth_chainId", nil).Into(&results[i])
+	}
+
+	n.reset()
+
+	_, err := p.Do(context.Background(), calls...)
+	require.NoError(t, err)
+
+	for _, r := range results {
+		assert.Equal(t, "0x1", r)
+	}
+
+	assert.Equal(t, []int{10, 10, 5}, n.batches)
+}
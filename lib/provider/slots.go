@@ -1,11 +1,14 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"sort"
 	"sync/atomic"
 	"time"
 
+	"github.com/0xsequence/ethkit/ethrpc"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
 )
 
@@ -34,6 +37,9 @@ func failJobs(js []*FetchSlotJob, err error) {
 	}
 }
 
+// Maximum number of slots read by a single batch call
+const MaxBatchSlots = 2048
+
 type SlotsFetcher struct {
 	running *atomic.Int32
 
@@ -61,7 +67,7 @@ func (sf *SlotsFetcher) Run(ctx context.Context) error {
 	defer sf.running.Store(0)
 
 	slotCount := 0
-	buffer := make([]*FetchSlotJob, 0, 2048)
+	buffer := make([]*FetchSlotJob, 0, MaxBatchSlots)
 	timer := time.NewTimer(sf.MaxLatency)
 
 	for {
@@ -69,9 +75,9 @@ func (sf *SlotsFetcher) Run(ctx context.Context) error {
 		case job := <-sf.jobs:
 			buffer = append(buffer, &job)
 			slotCount += len(job.Slots)
-			if slotCount >= 2048 {
+			if slotCount >= MaxBatchSlots {
 				go sf.processBatch(ctx, buffer)
-				buffer = make([]*FetchSlotJob, 0, 2048)
+				buffer = make([]*FetchSlotJob, 0, MaxBatchSlots)
 				slotCount = 0
 				timer.Reset(sf.MaxLatency)
 			}
@@ -80,7 +86,7 @@ func (sf *SlotsFetcher) Run(ctx context.Context) error {
 			if slotCount > 0 {
 				go sf.processBatch(ctx, buffer)
 
-				buffer = make([]*FetchSlotJob, 0, 2048)
+				buffer = make([]*FetchSlotJob, 0, MaxBatchSlots)
 				slotCount = 0
 			}
 
@@ -140,6 +146,131 @@ func (sf *SlotsFetcher) StorageAt(address common.Address, slots [][32]byte) (cha
 	return res, resErr
 }
 
+type slotsRequest struct {
+	address common.Address
+	slots   [][32]byte
+}
+
+// packSlots splits the slots of every address into batches of at most
+// max slots, the slots of one address are split only if they don't fit
+func packSlots(slots map[common.Address][][32]byte, max int) [][]*slotsRequest {
+	addrs := make([]common.Address, 0, len(slots))
+	for addr, s := range slots {
+		if len(s) != 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+
+	var batches [][]*slotsRequest
+	var batch []*slotsRequest
+	size := 0
+
+	for _, addr := range addrs {
+		s := slots[addr]
+		for len(s) != 0 {
+			if size == max {
+				batches = append(batches, batch)
+				batch = nil
+				size = 0
+			}
+
+			n := min(len(s), max-size)
+			batch = append(batch, &slotsRequest{address: addr, slots: s[:n]})
+			size += n
+			s = s[n:]
+		}
+	}
+
+	if len(batch) != 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// FetchSlots reads the slots of multiple addresses using the storage fetcher,
+// all the slots are read by a single call unless there are more than MaxBatchSlots
+func (b *Batched) FetchSlots(ctx context.Context, slots map[common.Address][][32]byte) (map[common.Address][][32]byte, error) {
+	calls, decode, err := b.SlotsCalls(slots)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := b.Do(ctx, calls...); err != nil {
+		b.metrics.overrideCalls.WithLabelValues("error").Add(float64(len(calls)))
+		return nil, fmt.Errorf("batch call failed: %w", err)
+	}
+
+	b.metrics.overrideCalls.WithLabelValues("success").Add(float64(len(calls)))
+
+	return decode()
+}
+
+// SlotsCalls builds the calls of FetchSlots, so they can be sent in the same
+// JSON-RPC batch as other calls, decode returns the slots once it is done
+func (b *Batched) SlotsCalls(slots map[common.Address][][32]byte) ([]ethrpc.Call, func() (map[common.Address][][32]byte, error), error) {
+	if b.supportsOverride.Load() == 2 {
+		b.metrics.overrideCalls.WithLabelValues("unsupported").Inc()
+		return nil, nil, fmt.Errorf("provider does not support overrides")
+	}
+
+	batches := packSlots(slots, MaxBatchSlots)
+	results := make([]string, len(batches))
+	calls := make([]ethrpc.Call, 0, len(batches))
+
+	for i, batch := range batches {
+		simpleCalls := make([]*SimpleCall, 0, len(batch))
+		override := make(OverrideArgs)
+
+		for _, req := range batch {
+			calldata, overrideArgs := FetchSlotsEncode(req.address, req.slots)
+			simpleCalls = append(simpleCalls, &SimpleCall{
+				Address: req.address,
+				Data:    calldata,
+			})
+
+			if err := override.Merge(overrideArgs); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		call, overrides := EncodeBatchCall(simpleCalls, override)
+		calls = append(calls, ethrpc.NewCallBuilder[string]("eth_call", nil, call, nil, overrides).Into(&results[i]))
+	}
+
+	decode := func() (map[common.Address][][32]byte, error) {
+		res := make(map[common.Address][][32]byte, len(slots))
+
+		for i, batch := range batches {
+			decoded, err := DecodeBatchCall(common.FromHex(results[i]), len(batch))
+			if err != nil {
+				return nil, err
+			}
+
+			for j, req := range batch {
+				values, err := FetchSlotsDecode(decoded[j])
+				if err != nil {
+					return nil, err
+				}
+
+				if len(values) != len(req.slots) {
+					return nil, fmt.Errorf("fetcher: expected %d slots for %v, got %d", len(req.slots), req.address, len(values))
+				}
+
+				res[req.address] = append(res[req.address], values...)
+			}
+		}
+
+		return res, nil
+	}
+
+	return calls, decode, nil
+}
+
 // Source: contracts/src/tools/StorageFetcher.huff
 const FetcherProgram = "0x60005b803554815260200136811061000257366000f3"
 
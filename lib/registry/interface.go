@@ -48,4 +48,5 @@ type Interface interface {
 	IsAcceptedEndorser(endorser common.Address) bool
 	StatusForEndorser(endorser common.Address) EndorserStatus
 	BanEndorser(endorser common.Address, banType BanType)
+	ReportGasUsage(endorser common.Address, used uint64, limit uint64)
 }
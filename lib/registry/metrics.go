@@ -23,6 +23,10 @@ type metrics struct {
 	discoverFailErrorReputation prometheus.Labels
 
 	discoverTime prometheus.Histogram
+
+	endorserGasUsed  *prometheus.HistogramVec
+	endorserGasRatio *prometheus.HistogramVec
+	gasBans          prometheus.Counter
 }
 
 func createMetrics(reg prometheus.Registerer) *metrics {
@@ -99,6 +103,23 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		Buckets: prometheus.DefBuckets,
 	})
 
+	endorserGasUsed := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "registry_endorser_gas_used",
+		Help:    "Gas used by calls to endorsers, by status of the endorser",
+		Buckets: prometheus.ExponentialBuckets(10_000, 2, 12),
+	}, []string{"status"})
+
+	endorserGasRatio := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "registry_endorser_gas_ratio",
+		Help:    "Gas used by calls to endorsers over the gas limit of the operation, by status of the endorser",
+		Buckets: prometheus.LinearBuckets(0.1, 0.1, 10),
+	}, []string{"status"})
+
+	gasBans := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "registry_gas_bans",
+		Help: "Number of temporary bans caused by gas usage",
+	})
+
 	if reg != nil {
 		reg.MustRegister(
 			knownEndorsers,
@@ -113,6 +134,9 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 			discoverCollided,
 			discoverTime,
 			askedForEndorser,
+			endorserGasUsed,
+			endorserGasRatio,
+			gasBans,
 		)
 	}
 
@@ -137,5 +161,9 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		discoverFailErrorReputation: discoverFailErrorReputation,
 
 		discoverTime: discoverTime,
+
+		endorserGasUsed:  endorserGasUsed,
+		endorserGasRatio: endorserGasRatio,
+		gasBans:          gasBans,
 	}
 }
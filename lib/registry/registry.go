@@ -10,6 +10,7 @@ import (
 	"github.com/0xsequence/ethkit/go-ethereum/accounts/abi/bind"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
 	"github.com/go-chi/httplog/v2"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -18,6 +19,17 @@ type WeightedSource struct {
 	Weight float64
 }
 
+// Endorsers whose gas usage is tracked, the least
+// recently used ones are forgotten first
+const maxGasUsageTracked = 1 << 12
+
+// gasUsage is the running average of the gas used by an endorser,
+// it becomes a moving average once it has enough samples
+type gasUsage struct {
+	samples uint
+	average float64
+}
+
 type Registry struct {
 	lock    sync.RWMutex
 	logger  *httplog.Logger
@@ -29,6 +41,12 @@ type Registry struct {
 	knownEndorsers   map[common.Address]EndorserStatus
 	temporalBanStart map[common.Address]time.Time
 
+	maxAverageGas uint64
+	gasSamples    uint
+	gasUsage      *lru.Cache[common.Address, *gasUsage]
+
+	onBan []func(endorser common.Address)
+
 	Sources []*WeightedSource
 }
 
@@ -48,10 +66,22 @@ func NewRegistry(cfg *config.RegistryConfig, logger *httplog.Logger, metrics pro
 		logger.Info("Temporary ban duration set", "duration", tempBanDuration)
 	}
 
+	gasSamples := cfg.GasSamples
+	if gasSamples == 0 {
+		gasSamples = 20
+	}
+
+	if cfg.MaxAverageGas != 0 {
+		logger.Info("Maximum average endorser gas set", "maxAverageGas", cfg.MaxAverageGas, "samples", gasSamples)
+	}
+
 	if len(cfg.Sources) == 0 && cfg.MinReputation != 0 && len(cfg.Trusted) == 0 && !cfg.AllowUnusable {
 		return nil, fmt.Errorf("unusable node, no endorser can be trusted, set at least one source or trusted endorser; or set min_reputation to 0")
 	}
 
+	// The size is constant and positive
+	usage, _ := lru.New[common.Address, *gasUsage](maxGasUsageTracked)
+
 	r := &Registry{
 		logger:           logger,
 		metrics:          createMetrics(metrics),
@@ -59,6 +89,9 @@ func NewRegistry(cfg *config.RegistryConfig, logger *httplog.Logger, metrics pro
 		tempBanDuration:  tempBanDuration,
 		knownEndorsers:   make(map[common.Address]EndorserStatus),
 		temporalBanStart: make(map[common.Address]time.Time),
+		maxAverageGas:    cfg.MaxAverageGas,
+		gasSamples:       gasSamples,
+		gasUsage:         usage,
 	}
 
 	for _, s := range cfg.Sources {
@@ -99,6 +132,15 @@ func (r *Registry) AddSource(s source.Interface, weight float64) {
 	})
 }
 
+// OnBan registers a function called every time an endorser is banned
+// permanently, temporary bans don't mean that the endorser lied
+func (r *Registry) OnBan(fn func(endorser common.Address)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.onBan = append(r.onBan, fn)
+}
+
 func (r *Registry) doBan(endorser common.Address, banType BanType) {
 	if banType == PermanentBan {
 		r.metrics.permanentBanned.Inc()
@@ -215,27 +257,86 @@ func (r *Registry) TrustEndorser(endorser common.Address) {
 }
 
 func (r *Registry) BanEndorser(endorser common.Address, banType BanType) {
+	if !r.banEndorser(endorser, banType) || banType != PermanentBan {
+		return
+	}
+
+	// The callbacks may be slow, they run without the lock
+	r.lock.RLock()
+	onBan := r.onBan
+	r.lock.RUnlock()
+
+	for _, fn := range onBan {
+		fn(endorser)
+	}
+}
+
+func (r *Registry) banEndorser(endorser common.Address, banType BanType) bool {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
 	if r.knownEndorsers[endorser] == TemporaryBanned {
 		delete(r.temporalBanStart, endorser)
 		r.doBan(endorser, banType)
-		return
+		return true
 	}
 
 	if r.knownEndorsers[endorser] == PermanentBanned {
 		r.logger.Warn("attempt to ban an already permanently banned endorser", "endorser", endorser.String())
-		return
+		return false
 	}
 
 	if r.knownEndorsers[endorser] == TrustedEndorser {
 		r.logger.Warn("attempt to ban a trusted endorser", "endorser", endorser.String())
-		return
+		return false
 	}
 
 	r.logger.Info("banning endorser", "endorser", endorser.String(), "prev", r.knownEndorsers[endorser], "banType", banType)
 	r.doBan(endorser, banType)
+	return true
+}
+
+// ReportGasUsage records the gas used by a call to the endorser, endorsers
+// that use too much gas on average are temporarily banned
+func (r *Registry) ReportGasUsage(endorser common.Address, used uint64, limit uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Anyone can make up endorsers, so they are not used as labels
+	status := r.knownEndorsers[endorser]
+	r.metrics.endorserGasUsed.WithLabelValues(status.String()).Observe(float64(used))
+	if limit != 0 {
+		r.metrics.endorserGasRatio.WithLabelValues(status.String()).Observe(float64(used) / float64(limit))
+	}
+
+	if r.maxAverageGas == 0 {
+		return
+	}
+
+	if status == TrustedEndorser || status == TemporaryBanned || status == PermanentBanned {
+		r.gasUsage.Remove(endorser)
+		return
+	}
+
+	usage, ok := r.gasUsage.Get(endorser)
+	if !ok {
+		usage = &gasUsage{}
+		r.gasUsage.Add(endorser, usage)
+	}
+
+	if usage.samples < r.gasSamples {
+		usage.samples++
+	}
+	usage.average += (float64(used) - usage.average) / float64(usage.samples)
+
+	if usage.samples < r.gasSamples || usage.average <= float64(r.maxAverageGas) {
+		return
+	}
+
+	r.metrics.gasBans.Inc()
+	r.logger.Info("banning endorser for gas usage", "endorser", endorser.String(), "average", usage.average, "max", r.maxAverageGas)
+	r.gasUsage.Remove(endorser)
+	r.doBan(endorser, TemporaryBan)
 }
 
 func (r *Registry) StatusForEndorser(endorser common.Address) EndorserStatus {
@@ -138,3 +138,65 @@ func TestCacheAcceptEndorser(t *testing.T) {
 	assert.True(t, r.IsAcceptedEndorser(endorser))
 	mockSource.AssertNumberOfCalls(t, "ReputationForEndorser", 1)
 }
+
+func TestGasUsageBan(t *testing.T) {
+	logger := httplog.NewLogger("")
+	r, err := registry.NewRegistry(&config.RegistryConfig{
+		MaxAverageGas: 100_000,
+		GasSamples:    3,
+	}, logger, nil, nil)
+	assert.NoError(t, err)
+
+	endorser1 := common.HexToAddress("0x08FFc248A190E700421C0aFB4135768406dCebfF")
+	endorser2 := common.HexToAddress("0x5887Ea54AE1308Bb7A697FdE87bA3D2E2d3952Ad")
+	trusted := common.HexToAddress("0x14B27AA8692073b66f1370bf53eF58Fea9637D91")
+	r.TrustEndorser(trusted)
+
+	// Not judged until there are enough samples
+	r.ReportGasUsage(endorser1, 500_000, 1_000_000)
+	r.ReportGasUsage(endorser1, 500_000, 1_000_000)
+	assert.True(t, r.IsAcceptedEndorser(endorser1))
+
+	// Average of 10_000
+	for i := 0; i < 3; i++ {
+		r.ReportGasUsage(endorser2, 10_000, 1_000_000)
+	}
+	assert.True(t, r.IsAcceptedEndorser(endorser2))
+
+	// Moving average of 140_000
+	r.ReportGasUsage(endorser2, 400_000, 1_000_000)
+	assert.Equal(t, registry.TemporaryBanned, r.StatusForEndorser(endorser2))
+
+	// Trusted endorsers are never banned
+	for i := 0; i < 5; i++ {
+		r.ReportGasUsage(trusted, 1_000_000, 1_000_000)
+	}
+	assert.Equal(t, registry.TrustedEndorser, r.StatusForEndorser(trusted))
+}
+
+func TestOnBan(t *testing.T) {
+	logger := httplog.NewLogger("")
+	r, err := registry.NewRegistry(&config.RegistryConfig{}, logger, nil, nil)
+	assert.NoError(t, err)
+
+	trusted := common.HexToAddress("0x08FFc248A190E700421C0aFB4135768406dCebfF")
+	endorser := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	r.TrustEndorser(trusted)
+
+	var banned []common.Address
+	r.OnBan(func(e common.Address) {
+		banned = append(banned, e)
+	})
+
+	// Temporary bans don't mean the endorser lied
+	r.BanEndorser(endorser, registry.TemporaryBan)
+	assert.Empty(t, banned)
+
+	r.BanEndorser(endorser, registry.PermanentBan)
+	r.BanEndorser(endorser, registry.PermanentBan)
+
+	// Trusted endorsers are never banned
+	r.BanEndorser(trusted, registry.PermanentBan)
+
+	assert.Equal(t, []common.Address{endorser}, banned)
+}
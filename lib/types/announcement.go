@@ -0,0 +1,147 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/0xsequence/bundler/proto"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/cyberphone/json-canonicalization/go/src/webpki.org/jsoncanonicalizer"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// AnnouncementVersion is the latest announcement format,
+// version 0 is a bare operation without an envelope.
+const AnnouncementVersion = 1
+
+var (
+	ErrUnsupportedAnnouncement = errors.New("unsupported announcement version")
+	ErrInvalidAnnouncement     = errors.New("invalid announcement signature")
+)
+
+// Announcement is how nodes gossip operations, it carries the node that
+// announced the operation and its signature, so the node that first
+// accepted an operation can be held accountable for it.
+type Announcement struct {
+	Version   uint             `json:"version"`
+	Operation *proto.Operation `json:"operation"`
+	Announcer string           `json:"announcer,omitempty"`
+	Timestamp uint64           `json:"time,omitempty"`
+	Signature string           `json:"signature,omitempty"`
+}
+
+// NewAnnouncement signs an announcement of the operation made by the announcer
+func NewAnnouncement(op *Operation, announcer string, sign func([]byte) ([]byte, error)) (*Announcement, error) {
+	a := &Announcement{
+		Version:   AnnouncementVersion,
+		Operation: op.ToProtoPure(),
+		Announcer: announcer,
+		Timestamp: uint64(time.Now().Unix()),
+	}
+
+	payload, err := a.signingPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := sign(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Signature = "0x" + common.Bytes2Hex(sig)
+	return a, nil
+}
+
+// ParseAnnouncement reads an announcement of any known version, bare
+// operations are returned as unsigned announcements of version 0
+func ParseAnnouncement(data []byte) (*Announcement, error) {
+	var envelope struct {
+		Version   *uint            `json:"version"`
+		Operation *proto.Operation `json:"operation"`
+	}
+
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Version == nil {
+		var op proto.Operation
+		if err := json.Unmarshal(data, &op); err != nil {
+			return nil, err
+		}
+
+		return &Announcement{Operation: &op}, nil
+	}
+
+	if *envelope.Version > AnnouncementVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedAnnouncement, *envelope.Version)
+	}
+
+	var a Announcement
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+
+	if a.Operation == nil {
+		return nil, fmt.Errorf("announcement without operation")
+	}
+
+	return &a, nil
+}
+
+// Signed is false for announcements without an envelope
+func (a *Announcement) Signed() bool {
+	return a.Version != 0
+}
+
+// Verify checks that the announcer signed the announcement
+func (a *Announcement) Verify() error {
+	id, err := peer.Decode(a.Announcer)
+	if err != nil {
+		return fmt.Errorf("%w: invalid announcer: %w", ErrInvalidAnnouncement, err)
+	}
+
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("%w: unable to extract public key: %w", ErrInvalidAnnouncement, err)
+	}
+
+	sig, err := hexutil.Decode(a.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAnnouncement, err)
+	}
+
+	payload, err := a.signingPayload()
+	if err != nil {
+		return err
+	}
+
+	ok, err := pub.Verify(payload, sig)
+	if err != nil || !ok {
+		return ErrInvalidAnnouncement
+	}
+
+	return nil
+}
+
+// signingPayload is the normalized announcement without its signature
+func (a *Announcement) signingPayload() ([]byte, error) {
+	unsigned := *a
+	unsigned.Signature = ""
+
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = jsoncanonicalizer.Transform(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to normalize announcement json: %w", err)
+	}
+
+	return data, nil
+}
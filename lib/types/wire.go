@@ -0,0 +1,149 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
+	"github.com/0xsequence/bundler/proto"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/0xsequence/ethkit/go-ethereum/rlp"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// wireOperation is the RLP form of an operation
+type wireOperation struct {
+	Entrypoint             common.Address
+	Data                   []byte
+	FixedGas               *big.Int
+	GasLimit               *big.Int
+	FeeToken               common.Address
+	Endorser               common.Address
+	EndorserCallData       []byte
+	EndorserGasLimit       *big.Int
+	MaxFeePerGas           *big.Int
+	MaxPriorityFeePerGas   *big.Int
+	FeeScalingFactor       *big.Int
+	FeeNormalizationFactor *big.Int
+	HasUntrustedContext    bool
+	ChainId                *big.Int
+}
+
+// wireAnnouncement is the RLP form of an announcement,
+// bare operations are sent as unsigned announcements of version 0
+type wireAnnouncement struct {
+	Version   uint64
+	Operation wireOperation
+	Announcer []byte
+	Timestamp uint64
+	Signature []byte
+}
+
+// AnnouncementCodec encodes the announcements gossiped on the
+// operation topic as RLP, the announcement signature is still
+// made over the JSON form, so it survives the conversion.
+type AnnouncementCodec struct{}
+
+func (AnnouncementCodec) Encode(payload interface{}) ([]byte, error) {
+	var a *Announcement
+	switch p := payload.(type) {
+	case *Announcement:
+		a = p
+	case *proto.Operation:
+		a = &Announcement{Operation: p}
+	default:
+		return nil, fmt.Errorf("unsupported payload %T", payload)
+	}
+
+	op, err := NewOperationFromProto(a.Operation)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wireAnnouncement{
+		Version:   uint64(a.Version),
+		Operation: toWireOperation(op),
+		Timestamp: a.Timestamp,
+	}
+
+	if a.Signed() {
+		id, err := peer.Decode(a.Announcer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid announcer: %w", err)
+		}
+		w.Announcer = []byte(id)
+
+		w.Signature, err = hexutil.Decode(a.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature: %w", err)
+		}
+	}
+
+	return rlp.EncodeToBytes(w)
+}
+
+func (AnnouncementCodec) Decode(data []byte) (interface{}, error) {
+	var w wireAnnouncement
+	if err := rlp.DecodeBytes(data, &w); err != nil {
+		return nil, err
+	}
+
+	op := fromWireOperation(&w.Operation).ToProtoPure()
+	if w.Version == 0 {
+		return op, nil
+	}
+
+	id, err := peer.IDFromBytes(w.Announcer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid announcer: %w", err)
+	}
+
+	return &Announcement{
+		Version:   uint(w.Version),
+		Operation: op,
+		Announcer: id.String(),
+		Timestamp: w.Timestamp,
+		Signature: "0x" + common.Bytes2Hex(w.Signature),
+	}, nil
+}
+
+func toWireOperation(op *Operation) wireOperation {
+	return wireOperation{
+		Entrypoint:             op.Entrypoint,
+		Data:                   op.Data,
+		FixedGas:               op.FixedGas,
+		GasLimit:               op.GasLimit,
+		FeeToken:               op.FeeToken,
+		Endorser:               op.Endorser,
+		EndorserCallData:       op.EndorserCallData,
+		EndorserGasLimit:       op.EndorserGasLimit,
+		MaxFeePerGas:           op.MaxFeePerGas,
+		MaxPriorityFeePerGas:   op.MaxPriorityFeePerGas,
+		FeeScalingFactor:       op.FeeScalingFactor,
+		FeeNormalizationFactor: op.FeeNormalizationFactor,
+		HasUntrustedContext:    op.HasUntrustedContext,
+		ChainId:                op.ChainId,
+	}
+}
+
+func fromWireOperation(w *wireOperation) *Operation {
+	return &Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Entrypoint:             w.Entrypoint,
+			Data:                   w.Data,
+			FixedGas:               w.FixedGas,
+			GasLimit:               w.GasLimit,
+			FeeToken:               w.FeeToken,
+			EndorserCallData:       w.EndorserCallData,
+			MaxFeePerGas:           w.MaxFeePerGas,
+			MaxPriorityFeePerGas:   w.MaxPriorityFeePerGas,
+			FeeScalingFactor:       w.FeeScalingFactor,
+			FeeNormalizationFactor: w.FeeNormalizationFactor,
+			HasUntrustedContext:    w.HasUntrustedContext,
+		},
+		Endorser:         w.Endorser,
+		EndorserGasLimit: w.EndorserGasLimit,
+		ChainId:          w.ChainId,
+	}
+}
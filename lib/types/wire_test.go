@@ -0,0 +1,111 @@
+package types_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/bundler/proto"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func wireOp() *types.Operation {
+	return &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Entrypoint:             common.HexToAddress("0x1234"),
+			Data:                   bytes.Repeat([]byte{0xab, 0x00}, 2048),
+			FixedGas:               big.NewInt(21000),
+			GasLimit:               big.NewInt(100000),
+			FeeToken:               common.HexToAddress("0x5678"),
+			EndorserCallData:       []byte{0x02},
+			MaxFeePerGas:           big.NewInt(100),
+			MaxPriorityFeePerGas:   big.NewInt(10),
+			FeeScalingFactor:       big.NewInt(1),
+			FeeNormalizationFactor: big.NewInt(1),
+			HasUntrustedContext:    true,
+		},
+		Endorser:         common.HexToAddress("0x9abc"),
+		EndorserGasLimit: big.NewInt(50000),
+		ChainId:          big.NewInt(42161),
+	}
+}
+
+func TestAnnouncementCodec(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	announcer, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	op := wireOp()
+	announcement, err := types.NewAnnouncement(op, announcer.String(), priv.Sign)
+	require.NoError(t, err)
+
+	codec := types.AnnouncementCodec{}
+	data, err := codec.Encode(announcement)
+	require.NoError(t, err)
+
+	jsonData, err := json.Marshal(announcement)
+	require.NoError(t, err)
+	assert.Less(t, len(data)*2, len(jsonData))
+
+	decoded, err := codec.Decode(data)
+	require.NoError(t, err)
+
+	// The handlers receive the JSON form, and the signature still holds
+	decodedData, err := json.Marshal(decoded)
+	require.NoError(t, err)
+
+	// Identical to the JSON encoding, so the message is the same on both
+	assert.Equal(t, jsonData, decodedData)
+	jsonData = decodedData
+
+	parsed, err := types.ParseAnnouncement(jsonData)
+	require.NoError(t, err)
+	require.NoError(t, parsed.Verify())
+	assert.Equal(t, announcer.String(), parsed.Announcer)
+	assert.Equal(t, announcement.Timestamp, parsed.Timestamp)
+
+	parsedOp, err := types.NewOperationFromProto(parsed.Operation)
+	require.NoError(t, err)
+	assert.Equal(t, op.Hash(), parsedOp.Hash())
+}
+
+func TestAnnouncementCodecBareOperation(t *testing.T) {
+	op := wireOp()
+
+	codec := types.AnnouncementCodec{}
+	data, err := codec.Encode(op.ToProtoPure())
+	require.NoError(t, err)
+
+	decoded, err := codec.Decode(data)
+	require.NoError(t, err)
+	require.IsType(t, &proto.Operation{}, decoded)
+	assert.Equal(t, mustJSON(t, op.ToProtoPure()), mustJSON(t, decoded))
+
+	parsed, err := types.ParseAnnouncement(mustJSON(t, decoded))
+	require.NoError(t, err)
+	assert.False(t, parsed.Signed())
+
+	parsedOp, err := types.NewOperationFromProto(parsed.Operation)
+	require.NoError(t, err)
+	assert.Equal(t, op.Hash(), parsedOp.Hash())
+
+	_, err = codec.Encode("not an operation")
+	assert.Error(t, err)
+
+	_, err = codec.Decode([]byte{0x01, 0x02})
+	assert.Error(t, err)
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
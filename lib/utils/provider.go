@@ -16,9 +16,13 @@ type HttpRpcMetricsClient struct {
 	callErrors *prometheus.CounterVec
 }
 
-func NewHttpRpcMetricsClient() *HttpRpcMetricsClient {
+func NewHttpRpcMetricsClient(transport http.RoundTripper) *HttpRpcMetricsClient {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
 	return &HttpRpcMetricsClient{
-		transport: http.DefaultTransport,
+		transport: transport,
 		callTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Name: "rpc_call_time",
 			Help: "Time it takes to make an RPC call",
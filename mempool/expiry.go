@@ -0,0 +1,88 @@
+package mempool
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/0xsequence/bundler/lib/types"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
+)
+
+type ExpiryReason string
+
+const (
+	ExpiryNone              ExpiryReason = ""
+	ExpiryMaxAge            ExpiryReason = "max_age"
+	ExpiryEndorserMaxAge    ExpiryReason = "endorser_max_age"
+	ExpiryMaxBlockTimestamp ExpiryReason = "max_block_timestamp"
+	ExpiryMaxBlockNumber    ExpiryReason = "max_block_number"
+)
+
+func isSet(v *big.Int) bool {
+	return v != nil && v.Sign() > 0
+}
+
+// HasBlockNumberWindow returns true if the endorser bounded the validity
+// of the operation by block number, this can only be checked against the head block.
+func (t *TrackedOperation) HasBlockNumberWindow() bool {
+	if t.EndorserResult == nil {
+		return false
+	}
+
+	gd := t.EndorserResult.GlobalDependency
+	return gd.Number && isSet(gd.MaxBlockNumber)
+}
+
+// Expired returns the reason why the operation is no longer valid, or
+// ExpiryNone if it is still within its validity window. The head is optional,
+// if it is nil the block number window is not checked.
+func (t *TrackedOperation) Expired(now time.Time, head *ethtypes.Header) ExpiryReason {
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return t.ExpiryReason
+	}
+
+	if t.EndorserResult == nil {
+		return ExpiryNone
+	}
+
+	gd := t.EndorserResult.GlobalDependency
+
+	// The next block can't have a timestamp lower than the current time
+	// so we don't need the head to check the timestamp window
+	if gd.Timestamp && isSet(gd.MaxBlockTimestamp) {
+		if big.NewInt(now.Unix()).Cmp(gd.MaxBlockTimestamp) > 0 {
+			return ExpiryMaxBlockTimestamp
+		}
+	}
+
+	// If the head is already at the max block number
+	// the operation can't be included in the next block
+	if gd.Number && isSet(gd.MaxBlockNumber) && head != nil && head.Number != nil {
+		if head.Number.Cmp(gd.MaxBlockNumber) >= 0 {
+			return ExpiryMaxBlockNumber
+		}
+	}
+
+	return ExpiryNone
+}
+
+func (mp *Mempool) expiryFor(op *types.Operation, createdAt time.Time) (*time.Time, ExpiryReason) {
+	var expiresAt *time.Time
+	reason := ExpiryNone
+
+	if mp.MaxAge != 0 {
+		t := createdAt.Add(mp.MaxAge)
+		expiresAt = &t
+		reason = ExpiryMaxAge
+	}
+
+	if age, ok := mp.EndorserMaxAge[op.Endorser]; ok {
+		t := createdAt.Add(age)
+		if expiresAt == nil || t.Before(*expiresAt) {
+			expiresAt = &t
+			reason = ExpiryEndorserMaxAge
+		}
+	}
+
+	return expiresAt, reason
+}
@@ -0,0 +1,27 @@
+package mempool
+
+import (
+	"context"
+)
+
+// Endorsers whose failures are tracked, the least
+// recently failing ones are forgotten first
+const maxTrackedEndorsers = 1 << 12
+
+type endorserFailures struct {
+	failures uint
+	sources  map[string]uint
+}
+
+type sourceKey struct{}
+
+// WithSource tags the context of AddOperation with whoever relayed the
+// operation, operations without a source share the same empty source
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+func sourceFrom(ctx context.Context) string {
+	source, _ := ctx.Value(sourceKey{}).(string)
+	return source
+}
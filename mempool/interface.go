@@ -7,6 +7,7 @@ import (
 
 	"github.com/0xsequence/bundler/endorser"
 	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/bundler/mempool/partitioner"
 	"github.com/0xsequence/bundler/proto"
 )
 
@@ -17,6 +18,17 @@ type TrackedOperation struct {
 	CreatedAt     time.Time  `json:"created_at"`
 	ReadyAt       time.Time  `json:"ready_at"`
 
+	// Failed operations can't be reserved until then
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
+	ExpiryReason ExpiryReason `json:"expiry_reason,omitempty"`
+
+	// Consecutive failed checks, only the endorser
+	// failures count towards discarding the operation
+	Failures         int `json:"failures,omitempty"`
+	EndorserFailures int `json:"endorser_failures,omitempty"`
+
 	EndorserResult      *endorser.EndorserResult      `json:"endorser_result,omitempty"`
 	EndorserResultState *endorser.EndorserResultState `json:"endorser_result_state,omitempty"`
 }
@@ -32,8 +44,13 @@ type Interface interface {
 	AddOperation(ctx context.Context, op *types.Operation, forceInclude bool) error
 	ReserveOps(ctx context.Context, selectFn func([]*TrackedOperation) []*TrackedOperation) []*TrackedOperation
 	ReleaseOps(ctx context.Context, ops []string, updateReadyAt proto.ReadyAtChange)
+	FailOps(ctx context.Context, ops []string, delay time.Duration, endorserFailure bool)
 	DiscardOps(ctx context.Context, ops []string)
 	ForgetOps(age time.Duration) []string
 	KnownOperations() []string
+	OperationHashes() []string
+	OperationsByHash(hashes []string) []*types.Operation
+	DependencyKeys() []*partitioner.DependencyKey
+	OpsByDependencies(keys []string) []string
 	Inspect() *proto.MempoolView
 }
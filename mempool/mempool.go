@@ -2,7 +2,10 @@ package mempool
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"sort"
 	"sync"
 	"time"
@@ -17,7 +20,9 @@ import (
 	"github.com/0xsequence/bundler/lib/utils"
 	"github.com/0xsequence/bundler/mempool/partitioner"
 	"github.com/0xsequence/bundler/proto"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
 	"github.com/go-chi/httplog/v2"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -33,6 +38,16 @@ type Mempool struct {
 
 	MaxSize int
 
+	MaxAge         time.Duration
+	EndorserMaxAge map[common.Address]time.Duration
+
+	// Operations can't give the endorser more gas than this, 0 means no limit
+	MaxEndorserGasLimit *big.Int
+
+	MaxEndorserFailures uint
+	failuresLock        sync.Mutex
+	endorserFailures    *lru.Cache[common.Address, *endorserFailures]
+
 	lock       sync.Mutex
 	Operations map[string]*TrackedOperation
 
@@ -68,6 +83,27 @@ func NewMempool(
 		wildcardLimit = 1
 	}
 
+	endorserMaxAge := make(map[common.Address]time.Duration, len(cfg.EndorserMaxAges))
+	for _, e := range cfg.EndorserMaxAges {
+		if !common.IsHexAddress(e.Address) {
+			return nil, fmt.Errorf("mempool: invalid endorser address for max age: %s", e.Address)
+		}
+
+		if e.MaxAgeSeconds == 0 {
+			return nil, fmt.Errorf("mempool: max age for endorser %s must be greater than 0", e.Address)
+		}
+
+		endorserMaxAge[common.HexToAddress(e.Address)] = time.Duration(e.MaxAgeSeconds) * time.Second
+	}
+
+	maxAge := time.Duration(cfg.MaxOperationAgeSeconds) * time.Second
+	if maxAge != 0 {
+		logger.Info("mempool: operations expire after", "max_age", maxAge)
+	}
+
+	// The size is constant and positive
+	failures, _ := lru.New[common.Address, *endorserFailures](maxTrackedEndorsers)
+
 	mp := &Mempool{
 		logger:  logger,
 		metrics: createMetrics(metrics),
@@ -80,6 +116,14 @@ func NewMempool(
 
 		MaxSize: int(cfg.Size),
 
+		MaxAge:         maxAge,
+		EndorserMaxAge: endorserMaxAge,
+
+		MaxEndorserGasLimit: new(big.Int).SetUint64(uint64(cfg.MaxEndorserGasLimit)),
+
+		MaxEndorserFailures: cfg.MaxEndorserFailures,
+		endorserFailures:    failures,
+
 		Operations: make(map[string]*TrackedOperation, cfg.Size),
 
 		partitioner: partitioner.NewPartitioner(metrics, overLapLimit, wildcardLimit),
@@ -158,12 +202,16 @@ func (mp *Mempool) ReserveOps(ctx context.Context, selectFn func([]*TrackedOpera
 	defer utils.RecordFunctionDuration(time.Now(), mp.metrics.doReserveOpsTime)
 
 	// Filter out the operations that are already reserved
-	// and the ones that are not ready
+	// and the ones waiting to be retried
+	now := time.Now()
 	availOps := []*TrackedOperation{}
 	for _, op := range mp.Operations {
 		if op.ReservedSince != nil {
 			continue
 		}
+		if op.RetryAt != nil && op.RetryAt.After(now) {
+			continue
+		}
 		availOps = append(availOps, op)
 	}
 
@@ -200,7 +248,11 @@ func (mp *Mempool) ReleaseOps(ctx context.Context, ops []string, updateReadyAt p
 
 			switch updateReadyAt {
 			case proto.ReadyAtChange_Now:
+				// The operation is ready again, so it is no longer failing
 				top.ReadyAt = time.Now()
+				top.RetryAt = nil
+				top.Failures = 0
+				top.EndorserFailures = 0
 			case proto.ReadyAtChange_Zero:
 				top.ReadyAt = time.Time{}
 			}
@@ -212,6 +264,37 @@ func (mp *Mempool) ReleaseOps(ctx context.Context, ops []string, updateReadyAt p
 	mp.metrics.opsReleased.WithLabelValues(updateReadyAt.String()).Add(float64(released))
 }
 
+// FailOps releases the operations after a failed check,
+// they can't be reserved again until the delay has passed
+func (mp *Mempool) FailOps(ctx context.Context, ops []string, delay time.Duration, endorserFailure bool) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	released := 0
+	for _, op := range ops {
+		if top, ok := mp.Operations[op]; ok {
+			if top.ReservedSince != nil {
+				mp.metrics.reservedTime.Observe(time.Since(*top.ReservedSince).Seconds())
+			} else {
+				mp.logger.Warn("operation failed but not reserved", "op", top.Hash())
+			}
+
+			top.ReservedSince = nil
+			retryAt := time.Now().Add(delay)
+			top.RetryAt = &retryAt
+
+			top.Failures++
+			if endorserFailure {
+				top.EndorserFailures++
+			}
+
+			released++
+		}
+	}
+
+	mp.metrics.opsReleased.WithLabelValues("Backoff").Add(float64(released))
+}
+
 func (mp *Mempool) DiscardOps(ctx context.Context, ops []string) {
 	mp.lock.Lock()
 	defer mp.lock.Unlock()
@@ -309,19 +392,64 @@ func (mp *Mempool) evictLesser(ctx context.Context, candidate *types.Operation,
 func (mp *Mempool) tryPromoteOperation(ctx context.Context, op *types.Operation) error {
 	start := time.Now()
 
+	if mp.MaxEndorserGasLimit.Sign() != 0 && op.EndorserGasLimit != nil && op.EndorserGasLimit.Cmp(mp.MaxEndorserGasLimit) > 0 {
+		mp.metrics.opsRejected.With(mp.metrics.opRejectedGasLimit).Inc()
+		return fmt.Errorf("endorser gas limit %v exceeds max %v", op.EndorserGasLimit, mp.MaxEndorserGasLimit)
+	}
+
 	res, err := mp.Endorser.IsOperationReady(ctx, op)
 	if err != nil {
-		mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyErr).Inc()
+		switch {
+		case errors.Is(err, endorser.ErrProvider):
+			// Not the fault of the endorser
+			mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyProviderErr).Inc()
+		case errors.Is(err, endorser.ErrOutOfGas):
+			mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyOutOfGas).Inc()
+			mp.Registry.ReportGasUsage(op.Endorser, mp.endorserGasLimit(op), mp.endorserGasLimit(op))
+			mp.endorserFailed(ctx, op.Endorser)
+		case errors.Is(err, endorser.ErrReverted):
+			mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyRevert).Inc()
+			mp.endorserFailed(ctx, op.Endorser)
+		case errors.Is(err, endorser.ErrMalformedResult):
+			mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyMalformed).Inc()
+			mp.endorserFailed(ctx, op.Endorser)
+		default:
+			mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyErr).Inc()
+		}
+
 		return fmt.Errorf("IsOperationReady failed: %w", err)
 	}
 
+	mp.endorserSucceeded(op.Endorser)
+
+	if res.GasUsed != 0 {
+		mp.Registry.ReportGasUsage(op.Endorser, res.GasUsed, mp.endorserGasLimit(op))
+	}
+
 	if !res.Readiness {
 		mp.metrics.opsRejected.With(mp.metrics.opRejectedReadyNotReady).Inc()
-		return fmt.Errorf("operation not ready")
+		return endorser.ErrNotReady
 	}
 
-	// Check the constraints
-	okc, err := mp.Endorser.ConstraintsMet(ctx, res)
+	// The endorser may have bounded the validity of the operation,
+	// reject it right away if the window is already closed
+	now := time.Now()
+	expiresAt, expiryReason := mp.expiryFor(op, now)
+	candidate := &TrackedOperation{EndorserResult: res}
+	if reason := candidate.Expired(now, nil); reason != ExpiryNone {
+		mp.metrics.opsRejected.With(mp.metrics.opRejectedExpired).Inc()
+		return fmt.Errorf("operation expired: %s", reason)
+	}
+
+	state, err := mp.Endorser.DependencyState(ctx, res)
+	if err != nil {
+		mp.metrics.opsRejected.With(mp.metrics.opRejectedDependencyStateErr).Inc()
+		return fmt.Errorf("EndorserResultState failed: %w", err)
+	}
+
+	// Check the constraints, the constrained slots
+	// are read along with the dependency state
+	okc, err := res.ConstraintsMet(state)
 	if err != nil {
 		mp.metrics.opsRejected.With(mp.metrics.opRejectedConstraintsErr).Inc()
 		return fmt.Errorf("CheckDependencyConstraints failed: %w", err)
@@ -332,12 +460,6 @@ func (mp *Mempool) tryPromoteOperation(ctx context.Context, op *types.Operation)
 		return fmt.Errorf("operation constraints not met")
 	}
 
-	state, err := mp.Endorser.DependencyState(ctx, res)
-	if err != nil {
-		mp.metrics.opsRejected.With(mp.metrics.opRejectedDependencyStateErr).Inc()
-		return fmt.Errorf("EndorserResultState failed: %w", err)
-	}
-
 	// Check the collector (fees)
 	if err := mp.Collector.ValidatePayment(op); err != nil {
 		mp.metrics.opsRejected.With(mp.metrics.opRejectedCollectorErr).Inc()
@@ -394,8 +516,11 @@ func (mp *Mempool) tryPromoteOperation(ctx context.Context, op *types.Operation)
 	mp.Operations[op.Hash()] = &TrackedOperation{
 		Operation: *op,
 
-		CreatedAt: time.Now(),
-		ReadyAt:   time.Now(),
+		CreatedAt: now,
+		ReadyAt:   now,
+
+		ExpiresAt:    expiresAt,
+		ExpiryReason: expiryReason,
 
 		EndorserResult:      res,
 		EndorserResultState: state,
@@ -404,6 +529,74 @@ func (mp *Mempool) tryPromoteOperation(ctx context.Context, op *types.Operation)
 	return nil
 }
 
+// endorserGasLimit is the gas the endorser is given for the operation,
+// operations without a limit get the max endorser gas limit
+func (mp *Mempool) endorserGasLimit(op *types.Operation) uint64 {
+	if op.EndorserGasLimit == nil || op.EndorserGasLimit.Sign() == 0 {
+		return mp.MaxEndorserGasLimit.Uint64()
+	}
+
+	if !op.EndorserGasLimit.IsUint64() {
+		return math.MaxUint64
+	}
+
+	return op.EndorserGasLimit.Uint64()
+}
+
+// endorserFailed temporarily bans the endorser once its failures
+// outnumber its successes by MaxEndorserFailures, a single source
+// can only account for half of them
+func (mp *Mempool) endorserFailed(ctx context.Context, addr common.Address) {
+	if mp.MaxEndorserFailures == 0 {
+		return
+	}
+
+	source := sourceFrom(ctx)
+	perSource := (mp.MaxEndorserFailures + 1) / 2
+
+	mp.failuresLock.Lock()
+	f, ok := mp.endorserFailures.Get(addr)
+	if !ok {
+		f = &endorserFailures{sources: make(map[string]uint)}
+		mp.endorserFailures.Add(addr, f)
+	}
+
+	// The source already failed the endorser too many times,
+	// it may be sending bad operations on purpose
+	if f.sources[source] >= perSource {
+		mp.failuresLock.Unlock()
+		return
+	}
+
+	f.sources[source]++
+	f.failures++
+	failures := f.failures
+	if failures >= mp.MaxEndorserFailures {
+		mp.endorserFailures.Remove(addr)
+	}
+	mp.failuresLock.Unlock()
+
+	if failures >= mp.MaxEndorserFailures {
+		mp.logger.Warn("mempool: banning failing endorser", "endorser", addr, "failures", failures)
+		mp.metrics.endorsersBanned.Inc()
+		mp.Registry.BanEndorser(addr, registry.TemporaryBan)
+	}
+}
+
+// endorserSucceeded forgives a single failure of the endorser
+func (mp *Mempool) endorserSucceeded(addr common.Address) {
+	if mp.MaxEndorserFailures == 0 {
+		return
+	}
+
+	mp.failuresLock.Lock()
+	defer mp.failuresLock.Unlock()
+
+	if f, ok := mp.endorserFailures.Peek(addr); ok && f.failures > 0 {
+		f.failures--
+	}
+}
+
 func (mp *Mempool) ReportToIPFS(op *types.Operation) {
 	// Fire a go-routine to report the operation to IPFS
 	if mp.IPFS == nil {
@@ -450,6 +643,44 @@ func (mp *Mempool) KnownOperations() []string {
 	return ops
 }
 
+// OperationHashes returns the hash of every operation in the mempool
+func (mp *Mempool) OperationHashes() []string {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	hashes := make([]string, 0, len(mp.Operations))
+	for k := range mp.Operations {
+		hashes = append(hashes, k)
+	}
+
+	return hashes
+}
+
+// OperationsByHash returns a copy of the operations in the
+// mempool with the given hashes, unknown hashes are skipped
+func (mp *Mempool) OperationsByHash(hashes []string) []*types.Operation {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	ops := make([]*types.Operation, 0, len(hashes))
+	for _, h := range hashes {
+		if op, ok := mp.Operations[h]; ok {
+			cp := op.Operation
+			ops = append(ops, &cp)
+		}
+	}
+
+	return ops
+}
+
+func (mp *Mempool) DependencyKeys() []*partitioner.DependencyKey {
+	return mp.partitioner.DependencyKeys()
+}
+
+func (mp *Mempool) OpsByDependencies(keys []string) []string {
+	return mp.partitioner.OpsByKeys(keys)
+}
+
 func (mp *Mempool) Inspect() *proto.MempoolView {
 	mp.lock.Lock()
 	defer mp.lock.Unlock()
@@ -1,6 +1,7 @@
 package mempool_test
 
 import (
+	"fmt"
 	"math/big"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/0xsequence/bundler/endorser"
 	"github.com/0xsequence/bundler/lib/calldata"
 	"github.com/0xsequence/bundler/lib/mocks"
+	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/mempool"
 	"github.com/0xsequence/bundler/proto"
@@ -39,7 +41,6 @@ func TestAddOperation(t *testing.T) {
 	es := &endorser.EndorserResultState{}
 
 	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(er, nil).Once()
-	mockEndorser.On("ConstraintsMet", mock.Anything, er).Return(true, nil).Once()
 	mockEndorser.On("DependencyState", mock.Anything, er).Return(es, nil).Once()
 	mockCollector.On("ValidatePayment", op).Return(nil).Once()
 	mockRegistry.On("IsAcceptedEndorser", common.Address{}).Return(true).Once()
@@ -58,6 +59,12 @@ func TestAddOperation(t *testing.T) {
 	assert.Equal(t, len(mempool.Operations), 1)
 	assert.Equal(t, mempool.Operations[op.Hash()].ToProto(), op.ToProto())
 
+	// It can be served to other peers
+	assert.Equal(t, []string{op.Hash()}, mempool.OperationHashes())
+	ops := mempool.OperationsByHash([]string{op.Hash(), "0x00"})
+	assert.Len(t, ops, 1)
+	assert.Equal(t, op.ToProto(), ops[0].ToProto())
+
 	mockEndorser.AssertExpectations(t)
 	mockCollector.AssertExpectations(t)
 	mockRegistry.AssertExpectations(t)
@@ -82,7 +89,6 @@ func TestForceIncludeKnownOp(t *testing.T) {
 	es := &endorser.EndorserResultState{}
 
 	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(er, nil).Twice()
-	mockEndorser.On("ConstraintsMet", mock.Anything, er).Return(true, nil).Twice()
 	mockEndorser.On("DependencyState", mock.Anything, er).Return(es, nil).Twice()
 	mockCollector.On("ValidatePayment", op).Return(nil).Twice()
 	mockRegistry.On("IsAcceptedEndorser", common.Address{}).Return(true).Twice()
@@ -124,7 +130,6 @@ func TestSkipAddingKnownOperation(t *testing.T) {
 	es := &endorser.EndorserResultState{}
 
 	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(er, nil).Once()
-	mockEndorser.On("ConstraintsMet", mock.Anything, er).Return(true, nil).Once()
 	mockEndorser.On("DependencyState", mock.Anything, er).Return(es, nil).Once()
 	mockCollector.On("ValidatePayment", op).Return(nil).Once()
 	mockRegistry.On("IsAcceptedEndorser", common.Address{}).Return(true).Once()
@@ -177,27 +182,51 @@ func TestNotReadyOperation(t *testing.T) {
 	f = mempool.ForgetOps(0)
 	assert.Equal(t, f, []string{op.Hash()})
 
-	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(&endorser.EndorserResult{
+	// Maybe the constraints are not met
+	da := common.HexToAddress("0x1234")
+	constrained := &endorser.EndorserResult{
 		Readiness: true,
-	}, nil).Maybe()
+		Dependencies: []abiendorser.IEndorserDependency{
+			{
+				Addr: da,
+				Constraints: []abiendorser.IEndorserConstraint{
+					{
+						Slot:     [32]byte{1},
+						MinValue: [32]byte{31: 1},
+						MaxValue: [32]byte{31: 2},
+					},
+				},
+			},
+		},
+	}
 
-	// Maybe the constraints are not met
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(false, nil).Once()
+	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(constrained, nil).Twice()
+	mockEndorser.On("DependencyState", mock.Anything, constrained).Return(&endorser.EndorserResultState{
+		AddrDependencies: map[common.Address]*endorser.AddrDependencyState{
+			da: {Constraints: map[[32]byte][32]byte{{1}: {31: 3}}},
+		},
+	}, nil).Once()
 
 	err = mempool.AddOperation(ctx, op, false)
 	assert.Error(t, err)
 	f = mempool.ForgetOps(0)
 	assert.Equal(t, f, []string{op.Hash()})
 
-	// Maybe the constraints failed
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(false, assert.AnError).Once()
+	// Maybe the constrained slots are missing
+	mockEndorser.On("DependencyState", mock.Anything, constrained).Return(&endorser.EndorserResultState{
+		AddrDependencies: map[common.Address]*endorser.AddrDependencyState{
+			da: {},
+		},
+	}, nil).Once()
 
 	err = mempool.AddOperation(ctx, op, false)
 	assert.Error(t, err)
 	f = mempool.ForgetOps(0)
 	assert.Equal(t, f, []string{op.Hash()})
 
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(true, nil).Maybe()
+	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(&endorser.EndorserResult{
+		Readiness: true,
+	}, nil).Maybe()
 
 	// Maybe the dependency state fails
 	mockEndorser.On("DependencyState", mock.Anything, mock.Anything).Return(nil, assert.AnError).Once()
@@ -256,7 +285,6 @@ func TestReserveOps(t *testing.T) {
 	mockEndorser.On("IsOperationReady", mock.Anything, op2).Return(er, nil).Once()
 	mockEndorser.On("IsOperationReady", mock.Anything, op3).Return(er, nil).Once()
 
-	mockEndorser.On("ConstraintsMet", mock.Anything, er).Return(true, nil).Maybe()
 	mockEndorser.On("DependencyState", mock.Anything, er).Return(es, nil).Maybe()
 	mockCollector.On("ValidatePayment", mock.Anything).Return(nil).Maybe()
 	mockRegistry.On("IsAcceptedEndorser", mock.Anything).Return(true).Maybe()
@@ -351,7 +379,6 @@ func TestReportToIPFS(t *testing.T) {
 	}
 
 	// Should report to IPFS if the operation is valid
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(true, nil).Maybe()
 	mockEndorser.On("DependencyState", mock.Anything, mock.Anything).Return(&endorser.EndorserResultState{}, nil).Maybe()
 	mockCollector.On("ValidatePayment", op1).Return(nil).Maybe()
 	mockRegistry.On("IsAcceptedEndorser", mock.Anything).Return(true).Maybe()
@@ -427,7 +454,6 @@ func TestRejectOverlappingDependency(t *testing.T) {
 		},
 	}
 
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(true, nil).Maybe()
 	mockEndorser.On("DependencyState", mock.Anything, mock.Anything).Return(&endorser.EndorserResultState{}, nil).Maybe()
 	mockCollector.On("ValidatePayment", mock.Anything).Return(nil).Maybe()
 	mockCollector.On("Cmp", mock.Anything, mock.Anything).Return(0).Maybe()
@@ -483,7 +509,6 @@ func TestReplaceOverlappingDependency(t *testing.T) {
 		},
 	}
 
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(true, nil).Maybe()
 	mockEndorser.On("DependencyState", mock.Anything, mock.Anything).Return(&endorser.EndorserResultState{}, nil).Maybe()
 	mockCollector.On("ValidatePayment", mock.Anything).Return(nil).Maybe()
 	mockCollector.On("Cmp", op1, op2).Return(-1).Maybe()
@@ -529,7 +554,6 @@ func TestRejectBadEndorser(t *testing.T) {
 	mockEndorser.On("IsOperationReady", mock.Anything, op1).Return(&endorser.EndorserResult{
 		Readiness: true,
 	}, nil).Once()
-	mockEndorser.On("ConstraintsMet", mock.Anything, mock.Anything).Return(true, nil).Maybe()
 	mockEndorser.On("DependencyState", mock.Anything, mock.Anything).Return(&endorser.EndorserResultState{}, nil).Maybe()
 	mockCollector.On("ValidatePayment", mock.Anything).Return(nil).Maybe()
 	mockRegistry.On("IsAcceptedEndorser", common.HexToAddress("0x5887Ea54AE1308Bb7A697FdE87bA3D2E2d3952Ad")).Return(false).Once()
@@ -544,3 +568,241 @@ func TestRejectBadEndorser(t *testing.T) {
 	mockCollector.AssertExpectations(t)
 	mockRegistry.AssertExpectations(t)
 }
+
+func TestRejectExpiredOperation(t *testing.T) {
+	logger := httplog.NewLogger("")
+	mockCollector := &mocks.MockCollector{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	mp, err := mempool.NewMempool(&config.MempoolConfig{
+		Size: 10,
+	}, logger, nil, mockEndorser, mockCollector, nil, calldata.DefaultModel(), mockRegistry)
+
+	assert.NoError(t, err)
+
+	op := &types.Operation{}
+
+	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(&endorser.EndorserResult{
+		Readiness: true,
+		GlobalDependency: abiendorser.IEndorserGlobalDependency{
+			Timestamp:         true,
+			MaxBlockTimestamp: big.NewInt(time.Now().Add(-time.Minute).Unix()),
+		},
+	}, nil).Once()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = mp.AddOperation(ctx, op, false)
+	assert.Error(t, err)
+	cancel()
+
+	// The op should be rejected before checking the constraints
+	assert.Equal(t, len(mp.Operations), 0)
+	mockEndorser.AssertNotCalled(t, "ConstraintsMet", mock.Anything, mock.Anything)
+
+	// Expired ops must remain known until forgotten
+	assert.True(t, mp.IsKnownOp(op))
+	f := mp.ForgetOps(0)
+	assert.Equal(t, f, []string{op.Hash()})
+
+	mockEndorser.AssertExpectations(t)
+}
+
+func TestOperationMaxAge(t *testing.T) {
+	logger := httplog.NewLogger("")
+	mockCollector := &mocks.MockCollector{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	endorserAddr := common.HexToAddress("0x999999cf1046e68e36E1aA2E0E07105eDDD1f08E")
+
+	mp, err := mempool.NewMempool(&config.MempoolConfig{
+		Size:                   10,
+		MaxOperationAgeSeconds: 60,
+		EndorserMaxAges: []config.EndorserMaxAge{
+			{Address: endorserAddr.String(), MaxAgeSeconds: 10},
+		},
+	}, logger, nil, mockEndorser, mockCollector, nil, calldata.DefaultModel(), mockRegistry)
+
+	assert.NoError(t, err)
+
+	op1 := &types.Operation{}
+	op2 := &types.Operation{Endorser: endorserAddr}
+	er := &endorser.EndorserResult{
+		Readiness: true,
+	}
+	es := &endorser.EndorserResultState{}
+
+	mockEndorser.On("IsOperationReady", mock.Anything, mock.Anything).Return(er, nil).Twice()
+	mockEndorser.On("DependencyState", mock.Anything, er).Return(es, nil).Twice()
+	mockCollector.On("ValidatePayment", mock.Anything).Return(nil).Twice()
+	mockRegistry.On("IsAcceptedEndorser", mock.Anything).Return(true).Twice()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, mp.AddOperation(ctx, op1, false))
+	assert.NoError(t, mp.AddOperation(ctx, op2, false))
+	cancel()
+
+	// The global max age applies to all operations
+	to1 := mp.Operations[op1.Hash()]
+	assert.Equal(t, to1.ExpiryReason, mempool.ExpiryMaxAge)
+	assert.Equal(t, *to1.ExpiresAt, to1.CreatedAt.Add(60*time.Second))
+
+	// The endorser max age is shorter, so it takes priority
+	to2 := mp.Operations[op2.Hash()]
+	assert.Equal(t, to2.ExpiryReason, mempool.ExpiryEndorserMaxAge)
+	assert.Equal(t, *to2.ExpiresAt, to2.CreatedAt.Add(10*time.Second))
+
+	assert.Equal(t, to2.Expired(to2.CreatedAt.Add(5*time.Second), nil), mempool.ExpiryNone)
+	assert.Equal(t, to2.Expired(to2.CreatedAt.Add(10*time.Second), nil), mempool.ExpiryEndorserMaxAge)
+}
+
+func TestFailOps(t *testing.T) {
+	logger := httplog.NewLogger("")
+	mockCollector := &mocks.MockCollector{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	mp, err := mempool.NewMempool(&config.MempoolConfig{
+		Size: 10,
+	}, logger, nil, mockEndorser, mockCollector, nil, calldata.DefaultModel(), mockRegistry)
+	assert.NoError(t, err)
+
+	op := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{0x01},
+		},
+	}
+	er := &endorser.EndorserResult{
+		Readiness: true,
+	}
+
+	mockEndorser.On("IsOperationReady", mock.Anything, op).Return(er, nil).Once()
+	mockEndorser.On("DependencyState", mock.Anything, er).Return(&endorser.EndorserResultState{}, nil).Maybe()
+	mockCollector.On("ValidatePayment", mock.Anything).Return(nil).Maybe()
+	mockRegistry.On("IsAcceptedEndorser", mock.Anything).Return(true).Maybe()
+
+	ctx := context.Background()
+	assert.NoError(t, mp.AddOperation(ctx, op, false))
+
+	reserveAll := func() []*mempool.TrackedOperation {
+		return mp.ReserveOps(ctx, func(to []*mempool.TrackedOperation) []*mempool.TrackedOperation {
+			return to
+		})
+	}
+
+	readyAt := reserveAll()[0].ReadyAt
+	mp.FailOps(ctx, []string{op.Hash()}, 0, false)
+
+	reserveAll()
+	mp.FailOps(ctx, []string{op.Hash()}, time.Minute, true)
+
+	// The operation keeps its ready time but
+	// can't be reserved until the retry
+	assert.Empty(t, reserveAll())
+
+	top := mp.Operations[op.Hash()]
+	assert.Equal(t, 2, top.Failures)
+	assert.Equal(t, 1, top.EndorserFailures)
+	assert.Equal(t, readyAt, top.ReadyAt)
+	assert.True(t, top.RetryAt.After(time.Now()))
+
+	// A successful check resets the failures
+	mp.ReleaseOps(ctx, []string{op.Hash()}, proto.ReadyAtChange_Now)
+	reserved := reserveAll()
+	assert.Len(t, reserved, 1)
+	assert.Nil(t, reserved[0].RetryAt)
+	assert.Equal(t, 0, reserved[0].Failures)
+	assert.Equal(t, 0, reserved[0].EndorserFailures)
+}
+
+func TestBanFailingEndorser(t *testing.T) {
+	logger := httplog.NewLogger("")
+	mockCollector := &mocks.MockCollector{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	mp, err := mempool.NewMempool(&config.MempoolConfig{
+		Size:                10,
+		MaxEndorserFailures: 2,
+	}, logger, nil, mockEndorser, mockCollector, nil, calldata.DefaultModel(), mockRegistry)
+	assert.NoError(t, err)
+
+	addr := common.HexToAddress("0x5887Ea54AE1308Bb7A697FdE87bA3D2E2d3952Ad")
+	newOp := func(b byte) *types.Operation {
+		return &types.Operation{
+			IEndorserOperation: abiendorser.IEndorserOperation{Data: []byte{b}},
+			Endorser:           addr,
+		}
+	}
+
+	op1, op2, op3, op4 := newOp(1), newOp(2), newOp(3), newOp(4)
+
+	revert := &endorser.RevertError{Err: fmt.Errorf("execution reverted"), Reason: "nope"}
+	mockEndorser.On("IsOperationReady", mock.Anything, op1).Return(nil, revert).Once()
+	mockEndorser.On("IsOperationReady", mock.Anything, op2).Return(nil, &endorser.ProviderError{Err: fmt.Errorf("timeout")}).Once()
+	mockEndorser.On("IsOperationReady", mock.Anything, op3).Return(nil, revert).Once()
+	mockEndorser.On("IsOperationReady", mock.Anything, op4).Return(nil, revert).Once()
+	mockRegistry.On("BanEndorser", addr, registry.TemporaryBan).Return().Once()
+
+	peer1 := mempool.WithSource(context.Background(), "peer1")
+	peer2 := mempool.WithSource(context.Background(), "peer2")
+
+	err = mp.AddOperation(peer1, op1, false)
+	assert.ErrorIs(t, err, endorser.ErrReverted)
+
+	// Provider errors are not the fault of the endorser
+	err = mp.AddOperation(peer2, op2, false)
+	assert.ErrorIs(t, err, endorser.ErrProvider)
+
+	// A single source can't get the endorser banned
+	err = mp.AddOperation(peer1, op3, false)
+	assert.ErrorIs(t, err, endorser.ErrReverted)
+	mockRegistry.AssertNotCalled(t, "BanEndorser", mock.Anything, mock.Anything)
+
+	err = mp.AddOperation(peer2, op4, false)
+	assert.ErrorIs(t, err, endorser.ErrReverted)
+
+	mockEndorser.AssertExpectations(t)
+	mockRegistry.AssertExpectations(t)
+}
+
+func TestRejectEndorserGasLimit(t *testing.T) {
+	logger := httplog.NewLogger("")
+	mockCollector := &mocks.MockCollector{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	mp, err := mempool.NewMempool(&config.MempoolConfig{
+		Size:                10,
+		MaxEndorserGasLimit: 100_000,
+	}, logger, nil, mockEndorser, mockCollector, nil, calldata.DefaultModel(), mockRegistry)
+	assert.NoError(t, err)
+
+	addr := common.HexToAddress("0x5887Ea54AE1308Bb7A697FdE87bA3D2E2d3952Ad")
+	newOp := func(b byte, gas int64) *types.Operation {
+		return &types.Operation{
+			IEndorserOperation: abiendorser.IEndorserOperation{Data: []byte{b}},
+			Endorser:           addr,
+			EndorserGasLimit:   big.NewInt(gas),
+		}
+	}
+
+	op1, op2 := newOp(1, 100_001), newOp(2, 100_000)
+
+	// The endorser is not called for operations over the limit
+	ctx := context.Background()
+	err = mp.AddOperation(ctx, op1, false)
+	assert.ErrorContains(t, err, "exceeds max")
+	mockEndorser.AssertNotCalled(t, "IsOperationReady", mock.Anything, op1)
+
+	// The gas used by the endorser is reported to the registry
+	mockEndorser.On("IsOperationReady", mock.Anything, op2).Return(&endorser.EndorserResult{GasUsed: 60_000}, nil).Once()
+	mockRegistry.On("ReportGasUsage", addr, uint64(60_000), uint64(100_000)).Return().Once()
+
+	err = mp.AddOperation(ctx, op2, false)
+	assert.ErrorIs(t, err, endorser.ErrNotReady)
+
+	mockEndorser.AssertExpectations(t)
+	mockRegistry.AssertExpectations(t)
+}
@@ -10,8 +10,14 @@ type metrics struct {
 	opsBroadcastFailed prometheus.Counter
 
 	opRejectedKnown              prometheus.Labels
+	opRejectedGasLimit           prometheus.Labels
 	opRejectedReadyErr           prometheus.Labels
+	opRejectedReadyProviderErr   prometheus.Labels
+	opRejectedReadyRevert        prometheus.Labels
+	opRejectedReadyMalformed     prometheus.Labels
+	opRejectedReadyOutOfGas      prometheus.Labels
 	opRejectedReadyNotReady      prometheus.Labels
+	opRejectedExpired            prometheus.Labels
 	opRejectedConstraintsErr     prometheus.Labels
 	opRejectedConstraintsNotMet  prometheus.Labels
 	opRejectedDependencyStateErr prometheus.Labels
@@ -24,6 +30,8 @@ type metrics struct {
 	opsEvicted   prometheus.Counter
 	opsDiscarded prometheus.Counter
 
+	endorsersBanned prometheus.Counter
+
 	opsMarkedForForget prometheus.Counter
 	opsForgotten       prometheus.Counter
 
@@ -68,6 +76,11 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		Help: "Number of operations evicted",
 	})
 
+	endorsersBanned := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mempool_endorsers_banned_sum",
+		Help: "Number of endorsers temporarily banned for failing too often",
+	})
+
 	opsDiscarded := prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "mempool_ops_discarded_sum",
 		Help: "Number of operations discarded",
@@ -132,6 +145,7 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 			opsBroadcastFailed,
 			opsEvicted,
 			opsDiscarded,
+			endorsersBanned,
 			opsMarkedForForget,
 			opsForgotten,
 			opsReserved,
@@ -152,8 +166,14 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		opsBroadcastFailed: opsBroadcastFailed,
 
 		opRejectedKnown:              prometheus.Labels{"reason": "known"},
+		opRejectedGasLimit:           prometheus.Labels{"reason": "endorser_gas_limit"},
 		opRejectedReadyErr:           prometheus.Labels{"reason": "ready_err"},
+		opRejectedReadyProviderErr:   prometheus.Labels{"reason": "ready_provider_err"},
+		opRejectedReadyRevert:        prometheus.Labels{"reason": "ready_revert"},
+		opRejectedReadyMalformed:     prometheus.Labels{"reason": "ready_malformed"},
+		opRejectedReadyOutOfGas:      prometheus.Labels{"reason": "ready_out_of_gas"},
 		opRejectedReadyNotReady:      prometheus.Labels{"reason": "ready_not_ready"},
+		opRejectedExpired:            prometheus.Labels{"reason": "expired"},
 		opRejectedConstraintsErr:     prometheus.Labels{"reason": "constraints_err"},
 		opRejectedConstraintsNotMet:  prometheus.Labels{"reason": "constraints_not_met"},
 		opRejectedDependencyStateErr: prometheus.Labels{"reason": "dependency_state_err"},
@@ -166,6 +186,8 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		opsEvicted:   opsEvicted,
 		opsDiscarded: opsDiscarded,
 
+		endorsersBanned: endorsersBanned,
+
 		opsMarkedForForget: opsMarkedForForget,
 		opsForgotten:       opsForgotten,
 
@@ -0,0 +1,213 @@
+package partitioner
+
+import (
+	"math/big"
+
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+)
+
+type KeyKind int
+
+const (
+	KeyWildcard KeyKind = iota
+	KeySlot
+	KeyBalance
+	KeyCode
+	KeyNonce
+	KeyGlobal
+	// All the slots of an address
+	KeyAddrWildcard
+	// A slot that must stay within a range
+	KeyConstraint
+)
+
+type GlobalField byte
+
+const (
+	GlobalBaseFee GlobalField = iota + 1
+	GlobalBlobBaseFee
+	GlobalChainId
+	GlobalCoinBase
+	GlobalDifficulty
+	GlobalGasLimit
+	GlobalNumber
+	GlobalTimestamp
+	GlobalTxOrigin
+	GlobalTxGasPrice
+)
+
+// DependencyKey is a single piece of state that operations depend on,
+// ID is the key used to index the operations in the partitioner.
+type DependencyKey struct {
+	ID   string
+	Kind KeyKind
+
+	Addr   common.Address
+	Slot   [32]byte
+	Global GlobalField
+}
+
+var wildcardKey = &DependencyKey{ID: wildcard, Kind: KeyWildcard}
+
+func slotKey(addr common.Address, slot [32]byte) *DependencyKey {
+	return &DependencyKey{ID: hash3([]byte{0}, addr[:], slot[:]), Kind: KeySlot, Addr: addr, Slot: slot}
+}
+
+func accountKey(kind KeyKind, addr common.Address) *DependencyKey {
+	var id byte
+	switch kind {
+	case KeyBalance:
+		id = 1
+	case KeyCode:
+		id = 2
+	case KeyNonce:
+		id = 3
+	}
+
+	return &DependencyKey{ID: hash3([]byte{1}, addr[:], []byte{id}), Kind: kind, Addr: addr}
+}
+
+func addrWildcardKey(addr common.Address) *DependencyKey {
+	return &DependencyKey{ID: hash3([]byte{3}, addr[:], nil), Kind: KeyAddrWildcard, Addr: addr}
+}
+
+func constraintKey(addr common.Address, slot [32]byte) *DependencyKey {
+	return &DependencyKey{ID: hash3([]byte{4}, addr[:], slot[:]), Kind: KeyConstraint, Addr: addr, Slot: slot}
+}
+
+func globalKey(field GlobalField) *DependencyKey {
+	return &DependencyKey{ID: hash3([]byte{2}, []byte{byte(field)}, nil), Kind: KeyGlobal, Global: field}
+}
+
+func depKeys(dep *endorser.Dependency) []*DependencyKey {
+	ks := make([]*DependencyKey, 0, len(dep.Slots)+3)
+
+	// AllSlots is a wildcard only for the storage of the address
+	if dep.AllSlots {
+		ks = append(ks, addrWildcardKey(dep.Addr))
+	} else {
+		for _, d := range dep.Slots {
+			ks = append(ks, slotKey(dep.Addr, d))
+		}
+	}
+
+	if dep.Balance {
+		ks = append(ks, accountKey(KeyBalance, dep.Addr))
+	}
+
+	if dep.Code {
+		ks = append(ks, accountKey(KeyCode, dep.Addr))
+	}
+
+	if dep.Nonce {
+		ks = append(ks, accountKey(KeyNonce, dep.Addr))
+	}
+
+	for _, c := range dep.Constraints {
+		ks = append(ks, constraintKey(dep.Addr, c.Slot))
+	}
+
+	return ks
+}
+
+func globalKeys(gd *endorser.GlobalDependency) []*DependencyKey {
+	ks := make([]*DependencyKey, 0, 10)
+
+	add := func(enabled bool, field GlobalField) {
+		if enabled {
+			ks = append(ks, globalKey(field))
+		}
+	}
+
+	add(gd.BaseFee, GlobalBaseFee)
+	add(gd.BlobBaseFee, GlobalBlobBaseFee)
+	add(gd.ChainId, GlobalChainId)
+	add(gd.CoinBase, GlobalCoinBase)
+	add(gd.Difficulty, GlobalDifficulty)
+	add(gd.GasLimit, GlobalGasLimit)
+	add(gd.Number, GlobalNumber)
+	add(gd.Timestamp, GlobalTimestamp)
+	add(gd.TxOrigin, GlobalTxOrigin)
+	add(gd.TxGasPrice, GlobalTxGasPrice)
+
+	return ks
+}
+
+func depsOfResult(res *endorser.EndorserResult) []*DependencyKey {
+	if res.WildcardOnly {
+		return []*DependencyKey{wildcardKey}
+	}
+
+	// Each global dependency is shared by all the
+	// operations that depend on it, like any other slot
+	ks := globalKeys(&res.GlobalDependency)
+
+	// The same key may be declared more than once
+	seen := make(map[string]struct{}, len(ks))
+	for _, dep := range res.Dependencies {
+		for _, k := range depKeys(&dep) {
+			if _, ok := seen[k.ID]; !ok {
+				seen[k.ID] = struct{}{}
+				ks = append(ks, k)
+			}
+		}
+	}
+
+	return ks
+}
+
+// valueRange is the range of values allowed for a constrained slot
+type valueRange struct {
+	min *big.Int
+	max *big.Int
+}
+
+func (r valueRange) overlaps(o valueRange) bool {
+	return r.min.Cmp(o.max) <= 0 && o.min.Cmp(r.max) <= 0
+}
+
+// constraintRanges returns the range allowed for each constraint key,
+// multiple constraints on the same slot must all hold
+func constraintRanges(res *endorser.EndorserResult) map[string]valueRange {
+	ranges := make(map[string]valueRange)
+
+	for _, dep := range res.Dependencies {
+		for _, c := range dep.Constraints {
+			id := constraintKey(dep.Addr, c.Slot).ID
+			r := valueRange{
+				min: new(big.Int).SetBytes(c.MinValue[:]),
+				max: new(big.Int).SetBytes(c.MaxValue[:]),
+			}
+
+			if prev, ok := ranges[id]; ok {
+				if prev.min.Cmp(r.min) > 0 {
+					r.min = prev.min
+				}
+				if prev.max.Cmp(r.max) < 0 {
+					r.max = prev.max
+				}
+			}
+
+			ranges[id] = r
+		}
+	}
+
+	return ranges
+}
+
+// IsWildcard returns true if the result can't be fully indexed by its
+// dependencies, so a change on the chain that is not read may affect it
+func IsWildcard(res *endorser.EndorserResult) bool {
+	if res == nil {
+		return true
+	}
+
+	for _, k := range depsOfResult(res) {
+		if k.Kind == KeyWildcard || k.Kind == KeyAddrWildcard {
+			return true
+		}
+	}
+
+	return false
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/0xsequence/bundler/endorser"
 	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/sha3"
 )
@@ -19,6 +20,14 @@ type Partitioner struct {
 
 	DependencyToOps  map[string][]*types.Operation
 	OpToDependencies map[string][]string
+	Keys             map[string]*DependencyKey
+
+	// Slot and constraint keys of every address, used to find
+	// the operations that overlap with an address wildcard
+	AddrSlots map[common.Address]map[string]struct{}
+
+	// Range allowed by every operation on each constraint key
+	ranges map[string]map[string]valueRange
 }
 
 func NewPartitioner(metrics prometheus.Registerer, overlapLimit, wildcardLimit uint) *Partitioner {
@@ -28,6 +37,9 @@ func NewPartitioner(metrics prometheus.Registerer, overlapLimit, wildcardLimit u
 		WildcardLimit:    wildcardLimit,
 		DependencyToOps:  make(map[string][]*types.Operation),
 		OpToDependencies: make(map[string][]string),
+		Keys:             make(map[string]*DependencyKey),
+		AddrSlots:        make(map[common.Address]map[string]struct{}),
+		ranges:           make(map[string]map[string]valueRange),
 	}
 }
 
@@ -41,68 +53,6 @@ func hash3(s0 []byte, s1 []byte, s2 []byte) string {
 	return string(h.Sum(nil))
 }
 
-func depHashes(dep *endorser.Dependency) []string {
-	// AllSlots is a wildcard
-	if dep.AllSlots {
-		return []string{wildcard}
-	}
-
-	hs := make([]string, 0, len(dep.Slots)+3)
-
-	for _, d := range dep.Slots {
-		h := hash3([]byte{0}, dep.Addr[:], d[:])
-		hs = append(hs, string(h))
-	}
-
-	if dep.Balance {
-		h := hash3([]byte{1}, dep.Addr[:], []byte{1})
-		hs = append(hs, string(h))
-	}
-
-	if dep.Code {
-		h := hash3([]byte{1}, dep.Addr[:], []byte{2})
-		hs = append(hs, string(h))
-	}
-
-	if dep.Nonce {
-		h := hash3([]byte{1}, dep.Addr[:], []byte{3})
-		hs = append(hs, string(h))
-	}
-
-	return hs
-}
-
-func depsOfResult(res *endorser.EndorserResult) []string {
-	// Global dependencies are always a wildcard
-	// TODO: Some of these may not be wildcards
-	if res.WildcardOnly ||
-		res.GlobalDependency.BaseFee ||
-		res.GlobalDependency.BlobBaseFee ||
-		res.GlobalDependency.ChainId ||
-		res.GlobalDependency.CoinBase ||
-		res.GlobalDependency.Difficulty ||
-		res.GlobalDependency.GasLimit ||
-		res.GlobalDependency.Number ||
-		res.GlobalDependency.Timestamp ||
-		res.GlobalDependency.TxOrigin ||
-		res.GlobalDependency.TxGasPrice {
-		return []string{wildcard}
-	}
-
-	hs := make([]string, 0, len(res.Dependencies)*2)
-
-	for _, dep := range res.Dependencies {
-		dhs := depHashes(&dep)
-		if len(dhs) == 1 && dhs[0] == wildcard {
-			return []string{wildcard}
-		}
-
-		hs = append(hs, dhs...)
-	}
-
-	return hs
-}
-
 func (p *Partitioner) Add(op *types.Operation, deps *endorser.EndorserResult) (bool, [][]*types.Operation) {
 	start := time.Now()
 	defer func() {
@@ -114,7 +64,12 @@ func (p *Partitioner) Add(op *types.Operation, deps *endorser.EndorserResult) (b
 	// Find all the dependencies that make the operation overlap
 	// return a group for each overlap group, so that the caller
 	// knows which operations may need to be removed to make room
-	dhashes := depsOfResult(deps)
+	dkeys := depsOfResult(deps)
+	ranges := constraintRanges(deps)
+	dhashes := make([]string, len(dkeys))
+	for i, k := range dkeys {
+		dhashes[i] = k.ID
+	}
 
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -137,12 +92,47 @@ func (p *Partitioner) Add(op *types.Operation, deps *endorser.EndorserResult) (b
 		}
 	} else {
 		overlaps := make([][]*types.Operation, 0, len(dhashes))
-		for _, dh := range dhashes {
-			if len(p.DependencyToOps[dh]) >= int(p.OverlapLimit) {
-				// Copy for safety
-				ops := make([]*types.Operation, len(p.DependencyToOps[dh]))
-				copy(ops, p.DependencyToOps[dh])
-				overlaps = append(overlaps, ops)
+		for _, dk := range dkeys {
+			switch dk.Kind {
+			case KeyAddrWildcard:
+				// At most WildcardLimit operations may read all the slots of
+				// an address, and they also share every slot of it
+				wops := p.DependencyToOps[dk.ID]
+				if len(wops) >= int(p.WildcardLimit) {
+					overlaps = append(overlaps, joinOps(wops, nil))
+				}
+
+				for sh := range p.AddrSlots[dk.Addr] {
+					if ops := joinOps(p.DependencyToOps[sh], wops); len(ops) >= int(p.OverlapLimit) {
+						overlaps = append(overlaps, ops)
+					}
+				}
+			case KeySlot:
+				// Constrained operations also read the slot
+				wops := p.DependencyToOps[addrWildcardKey(dk.Addr).ID]
+				cops := p.DependencyToOps[constraintKey(dk.Addr, dk.Slot).ID]
+				if ops := joinOps(p.DependencyToOps[dk.ID], joinOps(cops, wops)); len(ops) >= int(p.OverlapLimit) {
+					overlaps = append(overlaps, ops)
+				}
+			case KeyConstraint:
+				// Operations whose ranges can't hold at the same time don't
+				// overlap, at most one of them can be valid on any state
+				var cops []*types.Operation
+				for _, o := range p.DependencyToOps[dk.ID] {
+					if p.ranges[dk.ID][o.Hash()].overlaps(ranges[dk.ID]) {
+						cops = append(cops, o)
+					}
+				}
+
+				wops := p.DependencyToOps[addrWildcardKey(dk.Addr).ID]
+				sops := p.DependencyToOps[slotKey(dk.Addr, dk.Slot).ID]
+				if ops := joinOps(cops, joinOps(sops, wops)); len(ops) >= int(p.OverlapLimit) {
+					overlaps = append(overlaps, ops)
+				}
+			default:
+				if len(p.DependencyToOps[dk.ID]) >= int(p.OverlapLimit) {
+					overlaps = append(overlaps, joinOps(p.DependencyToOps[dk.ID], nil))
+				}
 			}
 		}
 
@@ -153,7 +143,7 @@ func (p *Partitioner) Add(op *types.Operation, deps *endorser.EndorserResult) (b
 	}
 
 	// Add the operation to the partitioner
-	p.addDependencies(op, dhashes)
+	p.addDependencies(op, dkeys, ranges)
 
 	return true, nil
 }
@@ -178,7 +168,7 @@ func (p *Partitioner) AddWildcard(op *types.Operation) (bool, [][]*types.Operati
 	}
 
 	// Add the operation to the partitioner
-	p.addDependencies(op, []string{wildcard})
+	p.addDependencies(op, []*DependencyKey{wildcardKey}, nil)
 
 	return true, nil
 }
@@ -198,12 +188,33 @@ func (p *Partitioner) Remove(ops []string) {
 	}
 }
 
-func (p *Partitioner) addDependencies(op *types.Operation, deps []string) {
+func (p *Partitioner) addDependencies(op *types.Operation, deps []*DependencyKey, ranges map[string]valueRange) {
+	oph := string(op.Hash())
+
 	p.metrics.knownOps.Inc()
 	p.metrics.addedDependencies.Add(float64(len(deps)))
 
-	for _, dh := range deps {
+	dhashes := make([]string, len(deps))
+	for i, dk := range deps {
+		dh := dk.ID
+		dhashes[i] = dh
+
 		p.DependencyToOps[dh] = append(p.DependencyToOps[dh], op)
+		p.Keys[dh] = dk
+
+		if dk.Kind == KeySlot || dk.Kind == KeyConstraint {
+			if p.AddrSlots[dk.Addr] == nil {
+				p.AddrSlots[dk.Addr] = make(map[string]struct{})
+			}
+			p.AddrSlots[dk.Addr][dh] = struct{}{}
+		}
+
+		if r, ok := ranges[dh]; ok {
+			if p.ranges[dh] == nil {
+				p.ranges[dh] = make(map[string]valueRange)
+			}
+			p.ranges[dh][oph] = r
+		}
 
 		if len(p.DependencyToOps[dh]) == int(p.OverlapLimit) {
 			p.metrics.fullDependencies.Inc()
@@ -217,7 +228,7 @@ func (p *Partitioner) addDependencies(op *types.Operation, deps []string) {
 		}
 	}
 
-	p.OpToDependencies[string(op.Hash())] = deps
+	p.OpToDependencies[oph] = dhashes
 }
 
 func (p *Partitioner) removeDependencies(oph string) {
@@ -235,6 +246,13 @@ func (p *Partitioner) removeDependencies(oph string) {
 
 		p.DependencyToOps[dh] = ops
 
+		if r := p.ranges[dh]; r != nil {
+			delete(r, oph)
+			if len(r) == 0 {
+				delete(p.ranges, dh)
+			}
+		}
+
 		if len(ops) == int(p.OverlapLimit-1) {
 			p.metrics.partiallyFilledDeps.Inc()
 			p.metrics.fullDependencies.Dec()
@@ -242,6 +260,18 @@ func (p *Partitioner) removeDependencies(oph string) {
 			p.metrics.partiallyFilledDeps.Dec()
 		}
 
+		if len(ops) == 0 {
+			if dk := p.Keys[dh]; dk != nil && (dk.Kind == KeySlot || dk.Kind == KeyConstraint) {
+				delete(p.AddrSlots[dk.Addr], dh)
+				if len(p.AddrSlots[dk.Addr]) == 0 {
+					delete(p.AddrSlots, dk.Addr)
+				}
+			}
+
+			delete(p.DependencyToOps, dh)
+			delete(p.Keys, dh)
+		}
+
 		if dh == wildcard {
 			p.metrics.wildcardDeps.Dec()
 		}
@@ -250,3 +280,61 @@ func (p *Partitioner) removeDependencies(oph string) {
 	delete(p.OpToDependencies, oph)
 	p.metrics.knownOps.Dec()
 }
+
+// joinOps returns a copy of both groups without repeated operations
+func joinOps(a, b []*types.Operation) []*types.Operation {
+	ops := make([]*types.Operation, 0, len(a)+len(b))
+	ops = append(ops, a...)
+
+	for _, op := range b {
+		dup := false
+		for _, o := range a {
+			if o == op {
+				dup = true
+				break
+			}
+		}
+
+		if !dup {
+			ops = append(ops, op)
+		}
+	}
+
+	return ops
+}
+
+// DependencyKeys returns all the keys with at least one operation, the
+// wildcards are not included as they can't be read from the chain
+func (p *Partitioner) DependencyKeys() []*DependencyKey {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]*DependencyKey, 0, len(p.Keys))
+	for _, k := range p.Keys {
+		if k.Kind != KeyWildcard && k.Kind != KeyAddrWildcard {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// OpsByKeys returns the hashes of the operations that depend on any of the keys
+func (p *Partitioner) OpsByKeys(keys []string) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	seen := make(map[string]struct{})
+	ops := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, op := range p.DependencyToOps[k] {
+			oph := op.Hash()
+			if _, ok := seen[oph]; !ok {
+				seen[oph] = struct{}{}
+				ops = append(ops, oph)
+			}
+		}
+	}
+
+	return ops
+}
@@ -160,20 +160,33 @@ func TestBlockAddTwoWithWildcard(t *testing.T) {
 		},
 	}
 
-	ok, deps := p.Add(op1, &endorser.EndorserResult{
+	op3 := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{3},
+		},
+	}
+
+	allSlots := &endorser.EndorserResult{
 		Dependencies: []abiendorser.IEndorserDependency{
 			{
 				Addr:     common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd"),
 				AllSlots: true,
 			},
 		},
-	})
+	}
+
+	ok, deps := p.Add(op1, allSlots)
 	assert.True(t, ok)
 	assert.Nil(t, deps)
 
-	ok, deps = p.AddWildcard(op2)
+	ok, deps = p.Add(op2, allSlots)
 	assert.False(t, ok)
 	assert.Equal(t, deps, [][]*types.Operation{{op1}})
+
+	// All the slots of one address is not a global wildcard
+	ok, deps = p.AddWildcard(op3)
+	assert.True(t, ok)
+	assert.Nil(t, deps)
 }
 
 func TestAddTwoWithWildcardWithRoom(t *testing.T) {
@@ -475,3 +488,235 @@ func TestRemoveOps(t *testing.T) {
 	assert.True(t, ok)
 	assert.Nil(t, deps)
 }
+
+func TestGlobalDependencyOverlap(t *testing.T) {
+	p := partitioner.NewPartitioner(nil, 1, 1)
+
+	op1 := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{1},
+		},
+	}
+
+	op2 := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{2},
+		},
+	}
+
+	op3 := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{3},
+		},
+	}
+
+	ok, deps := p.Add(op1, &endorser.EndorserResult{
+		GlobalDependency: abiendorser.IEndorserGlobalDependency{
+			Timestamp: true,
+		},
+	})
+	assert.True(t, ok)
+	assert.Nil(t, deps)
+
+	// A different global dependency does not overlap
+	ok, deps = p.Add(op2, &endorser.EndorserResult{
+		GlobalDependency: abiendorser.IEndorserGlobalDependency{
+			BaseFee: true,
+		},
+	})
+	assert.True(t, ok)
+	assert.Nil(t, deps)
+
+	// Nor is it a wildcard
+	ok, deps = p.AddWildcard(op3)
+	assert.True(t, ok)
+	assert.Nil(t, deps)
+
+	ok, deps = p.Add(&types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{4},
+		},
+	}, &endorser.EndorserResult{
+		GlobalDependency: abiendorser.IEndorserGlobalDependency{
+			Timestamp: true,
+		},
+	})
+	assert.False(t, ok)
+	assert.Equal(t, [][]*types.Operation{{op1}}, deps)
+}
+
+func TestDependencyKeys(t *testing.T) {
+	p := partitioner.NewPartitioner(nil, 2, 2)
+	addr := common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd")
+
+	op1 := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{1},
+		},
+	}
+
+	op2 := &types.Operation{
+		IEndorserOperation: abiendorser.IEndorserOperation{
+			Data: []byte{2},
+		},
+	}
+
+	ok, _ := p.Add(op1, &endorser.EndorserResult{
+		Dependencies: []abiendorser.IEndorserDependency{
+			{
+				Addr:    addr,
+				Balance: true,
+				Slots:   [][32]byte{{1}},
+			},
+		},
+	})
+	assert.True(t, ok)
+
+	// Wildcards are not returned as keys
+	ok, _ = p.AddWildcard(op2)
+	assert.True(t, ok)
+
+	keys := p.DependencyKeys()
+	assert.Len(t, keys, 2)
+
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		assert.Equal(t, addr, k.Addr)
+		if k.Kind == partitioner.KeySlot {
+			assert.Equal(t, [32]byte{1}, k.Slot)
+		} else {
+			assert.Equal(t, partitioner.KeyBalance, k.Kind)
+		}
+		ids = append(ids, k.ID)
+	}
+
+	assert.Equal(t, []string{op1.Hash()}, p.OpsByKeys(ids))
+
+	p.Remove([]string{op1.Hash()})
+	assert.Empty(t, p.DependencyKeys())
+}
+
+func TestAddrWildcardOverlap(t *testing.T) {
+	p := partitioner.NewPartitioner(nil, 2, 2)
+	addr1 := common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd")
+	addr2 := common.HexToAddress("0x2e417D097fF04E4F532A7856a1b4c62a34988E16")
+
+	newOp := func(b byte) *types.Operation {
+		return &types.Operation{
+			IEndorserOperation: abiendorser.IEndorserOperation{
+				Data: []byte{b},
+			},
+		}
+	}
+
+	slot := func(addr common.Address, s byte) *endorser.EndorserResult {
+		return &endorser.EndorserResult{
+			Dependencies: []abiendorser.IEndorserDependency{
+				{Addr: addr, Slots: [][32]byte{{s}}},
+			},
+		}
+	}
+
+	allSlots := &endorser.EndorserResult{
+		Dependencies: []abiendorser.IEndorserDependency{
+			{Addr: addr1, AllSlots: true},
+		},
+	}
+
+	op1, op2, op3, op4, op5, op6 := newOp(1), newOp(2), newOp(3), newOp(4), newOp(5), newOp(6)
+
+	ok, _ := p.Add(op1, slot(addr1, 1))
+	assert.True(t, ok)
+
+	ok, _ = p.Add(op2, allSlots)
+	assert.True(t, ok)
+
+	ok, _ = p.Add(op3, slot(addr1, 2))
+	assert.True(t, ok)
+
+	// The slot is shared by op1 and the address wildcard
+	ok, deps := p.Add(op4, slot(addr1, 1))
+	assert.False(t, ok)
+	assert.Equal(t, [][]*types.Operation{{op1, op2}}, deps)
+
+	// Other addresses are not affected
+	ok, deps = p.Add(op5, slot(addr2, 1))
+	assert.True(t, ok)
+	assert.Nil(t, deps)
+
+	// A second address wildcard fills both slots
+	ok, deps = p.Add(op6, allSlots)
+	assert.False(t, ok)
+	assert.ElementsMatch(t, [][]*types.Operation{{op1, op2}, {op3, op2}}, deps)
+
+	assert.True(t, partitioner.IsWildcard(allSlots))
+	assert.False(t, partitioner.IsWildcard(slot(addr1, 1)))
+
+	// Removing the address wildcard frees the slot
+	p.Remove([]string{op2.Hash()})
+	ok, _ = p.Add(op4, slot(addr1, 1))
+	assert.True(t, ok)
+}
+
+func TestConstraintOverlap(t *testing.T) {
+	p := partitioner.NewPartitioner(nil, 2, 2)
+	addr := common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd")
+
+	newOp := func(b byte) *types.Operation {
+		return &types.Operation{
+			IEndorserOperation: abiendorser.IEndorserOperation{
+				Data: []byte{b},
+			},
+		}
+	}
+
+	constraint := func(min, max byte) *endorser.EndorserResult {
+		return &endorser.EndorserResult{
+			Dependencies: []abiendorser.IEndorserDependency{
+				{
+					Addr: addr,
+					Constraints: []abiendorser.IEndorserConstraint{
+						{Slot: [32]byte{1}, MinValue: [32]byte{31: min}, MaxValue: [32]byte{31: max}},
+					},
+				},
+			},
+		}
+	}
+
+	op1, op2, op3, op4, op5 := newOp(1), newOp(2), newOp(3), newOp(4), newOp(5)
+
+	ok, _ := p.Add(op1, constraint(0, 10))
+	assert.True(t, ok)
+
+	// Disjoint ranges can't hold at the same time
+	ok, _ = p.Add(op2, constraint(20, 30))
+	assert.True(t, ok)
+
+	ok, deps := p.Add(op3, constraint(11, 15))
+	assert.True(t, ok)
+	assert.Nil(t, deps)
+
+	// Overlaps with all the ranges
+	ok, deps = p.Add(op4, constraint(5, 25))
+	assert.False(t, ok)
+	assert.Equal(t, [][]*types.Operation{{op1, op2, op3}}, deps)
+
+	// Reading the exact value overlaps with every range
+	ok, deps = p.Add(op5, &endorser.EndorserResult{
+		Dependencies: []abiendorser.IEndorserDependency{
+			{Addr: addr, Slots: [][32]byte{{1}}},
+		},
+	})
+	assert.False(t, ok)
+	assert.Equal(t, [][]*types.Operation{{op1, op2, op3}}, deps)
+
+	// Constraints are readable keys
+	keys := p.DependencyKeys()
+	assert.Len(t, keys, 1)
+	assert.Equal(t, partitioner.KeyConstraint, keys[0].Kind)
+	assert.Equal(t, [32]byte{1}, keys[0].Slot)
+
+	p.Remove([]string{op2.Hash(), op3.Hash()})
+	ok, _ = p.Add(op4, constraint(5, 25))
+	assert.True(t, ok)
+}
@@ -0,0 +1,353 @@
+package bundler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/lib/bloom"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/p2p"
+	"github.com/0xsequence/bundler/proto"
+	"github.com/go-chi/httplog/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultSyncPeers = 3
+
+	// Most hashes a peer returns as missing, and most
+	// operations that can be fetched in a single request
+	maxSyncHashes = 10000
+	syncFetchSize = 100
+
+	// Responses are truncated to this size so they stay under
+	// the stream message limit, the rest is fetched again
+	maxSyncResponseSize = 3 << 20 // 3MB
+
+	syncFalsePositiveRate = 0.01
+	syncRetryWait         = 5 * time.Second
+)
+
+// SyncRequest asks a peer for the hashes of the operations it has and are
+// not in the Known filter, or for the operations with the Fetch hashes
+type SyncRequest struct {
+	Known *bloom.Filter `json:"known,omitempty"`
+	Fetch []string      `json:"fetch,omitempty"`
+}
+
+type SyncResponse struct {
+	Missing    []string           `json:"missing,omitempty"`
+	Operations []*proto.Operation `json:"operations,omitempty"`
+}
+
+type syncMetrics struct {
+	peersSynced *prometheus.CounterVec
+	opsFetched  prometheus.Counter
+	opsServed   prometheus.Counter
+}
+
+func createSyncMetrics(reg prometheus.Registerer) *syncMetrics {
+	peersSynced := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mempool_sync_peers",
+		Help: "Number of peers the mempool was synced with",
+	}, []string{"result"})
+
+	opsFetched := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mempool_sync_ops_fetched",
+		Help: "Number of operations fetched from peers",
+	})
+
+	opsServed := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "mempool_sync_ops_served",
+		Help: "Number of operations served to peers",
+	})
+
+	if reg != nil {
+		reg.MustRegister(peersSynced, opsFetched, opsServed)
+	}
+
+	return &syncMetrics{
+		peersSynced: peersSynced,
+		opsFetched:  opsFetched,
+		opsServed:   opsServed,
+	}
+}
+
+// MempoolSync fetches the operations other peers have in their mempools,
+// so a node that just joined does not have to wait for them to be gossiped.
+// Fetched operations are handled as if they were received from gossip.
+type MempoolSync struct {
+	logger  *httplog.Logger
+	metrics *syncMetrics
+
+	peers    int
+	interval time.Duration
+
+	Host    p2p.Interface
+	Mempool mempool.Interface
+	Handler p2p.MsgHandler
+}
+
+func NewMempoolSync(
+	cfg *config.MempoolConfig,
+	logger *httplog.Logger,
+	metrics prometheus.Registerer,
+	host p2p.Interface,
+	mempool mempool.Interface,
+	handler p2p.MsgHandler,
+) *MempoolSync {
+	peers := int(cfg.SyncPeers)
+	if peers == 0 {
+		peers = DefaultSyncPeers
+	}
+
+	return &MempoolSync{
+		logger:  logger,
+		metrics: createSyncMetrics(metrics),
+
+		peers:    peers,
+		interval: time.Duration(cfg.SyncIntervalSeconds) * time.Second,
+
+		Host:    host,
+		Mempool: mempool,
+		Handler: handler,
+	}
+}
+
+func (s *MempoolSync) Run(ctx context.Context) error {
+	if err := s.Host.HandleStream(ctx, p2p.MempoolSyncProtocol, s.handleRequest); err != nil {
+		return err
+	}
+
+	// Wait until there is someone to sync with
+	for s.Sync(ctx) == 0 {
+		select {
+		case <-time.After(syncRetryWait):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if s.interval == 0 {
+		return nil
+	}
+
+	for {
+		select {
+		case <-time.After(s.interval):
+			s.Sync(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Sync fetches the missing operations from the priority peers first,
+// and then from a few other peers, it returns how many peers were synced
+func (s *MempoolSync) Sync(ctx context.Context) int {
+	synced := 0
+	for _, p := range s.syncPeers() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		fetched, err := s.SyncPeer(ctx, p)
+		if err != nil {
+			s.metrics.peersSynced.WithLabelValues("error").Inc()
+			s.logger.Warn("mempool sync: unable to sync with peer", "peer", p, "error", err)
+			continue
+		}
+
+		s.metrics.peersSynced.WithLabelValues("ok").Inc()
+		s.logger.Info("mempool sync: synced with peer", "peer", p, "fetched", fetched)
+		synced++
+	}
+
+	return synced
+}
+
+func (s *MempoolSync) syncPeers() []peer.ID {
+	priority := s.Host.PriorityPeers()
+
+	seen := make(map[peer.ID]struct{}, len(priority))
+	peers := make([]peer.ID, 0, len(priority)+s.peers)
+	for _, p := range priority {
+		seen[p] = struct{}{}
+		peers = append(peers, p)
+	}
+
+	others := 0
+	for _, p := range s.Host.Peers() {
+		if others >= s.peers {
+			break
+		}
+
+		if _, ok := seen[p]; ok {
+			continue
+		}
+
+		seen[p] = struct{}{}
+		peers = append(peers, p)
+		others++
+	}
+
+	return peers
+}
+
+// SyncPeer asks the peer for the operations we don't know about,
+// and fetches them, it returns how many operations were fetched
+func (s *MempoolSync) SyncPeer(ctx context.Context, p peer.ID) (int, error) {
+	known := s.Mempool.KnownOperations()
+
+	filter := bloom.New(len(known), syncFalsePositiveRate)
+	for _, oph := range known {
+		filter.Add(oph)
+	}
+
+	res, err := s.request(ctx, p, &SyncRequest{Known: filter})
+	if err != nil {
+		return 0, err
+	}
+
+	missing := res.Missing
+	if len(missing) > maxSyncHashes {
+		missing = missing[:maxSyncHashes]
+	}
+
+	fetched := 0
+	for len(missing) != 0 {
+		chunk := missing[:min(syncFetchSize, len(missing))]
+
+		res, err := s.request(ctx, p, &SyncRequest{Fetch: chunk})
+		if err != nil {
+			return fetched, err
+		}
+
+		// The peer no longer has any of them
+		if len(res.Operations) == 0 {
+			missing = missing[len(chunk):]
+			continue
+		}
+
+		requested := make(map[string]struct{}, len(chunk))
+		for _, oph := range chunk {
+			requested[oph] = struct{}{}
+		}
+
+		for _, protoOp := range res.Operations {
+			op, err := types.NewOperationFromProto(protoOp)
+			if err != nil {
+				s.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+				return fetched, fmt.Errorf("invalid operation: %w", err)
+			}
+
+			oph := op.Hash()
+			if _, ok := requested[oph]; !ok {
+				s.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+				return fetched, fmt.Errorf("unrequested operation %s", oph)
+			}
+			delete(requested, oph)
+
+			data, err := json.Marshal(op.ToProtoPure())
+			if err != nil {
+				return fetched, err
+			}
+
+			s.Handler(ctx, p, data)
+			s.metrics.opsFetched.Inc()
+			fetched++
+		}
+
+		// The response may have been truncated, ask again for the
+		// operations that were left out, at least one was returned
+		rest := make([]string, 0, len(requested)+len(missing)-len(chunk))
+		for _, oph := range chunk {
+			if _, ok := requested[oph]; ok {
+				rest = append(rest, oph)
+			}
+		}
+		missing = append(rest, missing[len(chunk):]...)
+	}
+
+	return fetched, nil
+}
+
+func (s *MempoolSync) request(ctx context.Context, p peer.ID, req *SyncRequest) (*SyncResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resData, err := s.Host.Request(ctx, p, p2p.MempoolSyncProtocol, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var res SyncResponse
+	if err := json.Unmarshal(resData, &res); err != nil {
+		s.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+		return nil, fmt.Errorf("invalid sync response: %w", err)
+	}
+
+	return &res, nil
+}
+
+func (s *MempoolSync) handleRequest(ctx context.Context, p peer.ID, data []byte) ([]byte, error) {
+	var req SyncRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		s.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+		return nil, fmt.Errorf("invalid sync request: %w", err)
+	}
+
+	if len(req.Fetch) > syncFetchSize {
+		s.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+		return nil, fmt.Errorf("too many operations requested: %d > %d", len(req.Fetch), syncFetchSize)
+	}
+
+	var res SyncResponse
+
+	if req.Known != nil {
+		if err := req.Known.Validate(); err != nil {
+			s.Host.ReportPeer(p, p2p.PeerInvalidMessage)
+			return nil, err
+		}
+
+		for _, oph := range s.Mempool.OperationHashes() {
+			if len(res.Missing) >= maxSyncHashes {
+				break
+			}
+
+			if !req.Known.Has(oph) {
+				res.Missing = append(res.Missing, oph)
+			}
+		}
+	}
+
+	if len(req.Fetch) != 0 {
+		size := 0
+		for _, op := range s.Mempool.OperationsByHash(req.Fetch) {
+			protoOp := op.ToProtoPure()
+
+			data, err := json.Marshal(protoOp)
+			if err != nil {
+				return nil, err
+			}
+
+			size += len(data)
+			if size > maxSyncResponseSize {
+				break
+			}
+
+			res.Operations = append(res.Operations, protoOp)
+		}
+
+		s.metrics.opsServed.Add(float64(len(res.Operations)))
+	}
+
+	return json.Marshal(&res)
+}
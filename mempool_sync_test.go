@@ -0,0 +1,215 @@
+package bundler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/0xsequence/bundler"
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/lib/mocks"
+	"github.com/0xsequence/bundler/lib/types"
+	"github.com/0xsequence/bundler/p2p"
+	"github.com/0xsequence/bundler/proto"
+	"github.com/go-chi/httplog/v2"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// syncHost sends the sync requests straight to the handler of another node
+type syncHost struct {
+	*mocks.MockP2p
+	server p2p.StreamHandler
+}
+
+func (h *syncHost) Request(ctx context.Context, p peer.ID, proto p2p.StreamProtocol, req []byte) ([]byte, error) {
+	return h.server(ctx, peer.ID("client"), req)
+}
+
+// serveSync starts a mempool sync that serves the given operations,
+// it always has the operations requested after the first one
+func serveSync(t *testing.T, ops ...*types.Operation) p2p.StreamHandler {
+	host := &mocks.MockP2p{}
+	mempool := &mocks.MockMempool{}
+
+	hashes := make([]string, len(ops))
+	for i, op := range ops {
+		hashes[i] = op.Hash()
+	}
+
+	mempool.On("OperationHashes").Return(hashes)
+	mempool.On("OperationsByHash", mock.Anything).Return(ops[1:])
+
+	var handler p2p.StreamHandler
+	registered := make(chan struct{})
+	host.On("HandleStream", mock.Anything, p2p.MempoolSyncProtocol, mock.Anything).Run(func(args mock.Arguments) {
+		handler = args.Get(2).(p2p.StreamHandler)
+		close(registered)
+	}).Return(nil).Once()
+
+	// Nobody to sync with, Run only serves requests
+	host.On("PriorityPeers").Return([]peer.ID{})
+	host.On("Peers").Return([]peer.ID{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	sync := bundler.NewMempoolSync(&config.MempoolConfig{}, httplog.NewLogger(""), nil, host, mempool, nil)
+	go sync.Run(ctx)
+
+	<-registered
+	return handler
+}
+
+func TestMempoolSyncFetchesMissing(t *testing.T) {
+	op1, op2, op3 := ingressOp(1), ingressOp(2), ingressOp(3)
+	server := serveSync(t, op1, op2, op3)
+
+	host := &syncHost{MockP2p: &mocks.MockP2p{}, server: server}
+	mempool := &mocks.MockMempool{}
+
+	// We already know about the first operation
+	mempool.On("KnownOperations").Return([]string{op1.Hash()})
+
+	var received []string
+	handler := func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		assert.Equal(t, peer.ID("server"), p)
+
+		var protoOp proto.Operation
+		require.NoError(t, json.Unmarshal(data, &protoOp))
+		op, err := types.NewOperationFromProto(&protoOp)
+		require.NoError(t, err)
+
+		received = append(received, op.Hash())
+		return pubsub.ValidationAccept
+	}
+
+	sync := bundler.NewMempoolSync(&config.MempoolConfig{}, httplog.NewLogger(""), nil, host, mempool, handler)
+
+	fetched, err := sync.SyncPeer(context.Background(), peer.ID("server"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetched)
+	assert.ElementsMatch(t, []string{op2.Hash(), op3.Hash()}, received)
+}
+
+func TestMempoolSyncTruncatesLargeResponses(t *testing.T) {
+	ops := make([]*types.Operation, 3)
+	hashes := make([]string, len(ops))
+	for i := range ops {
+		ops[i] = ingressOp(int64(i + 1))
+		ops[i].Data = make([]byte, 1<<20)
+		hashes[i] = ops[i].Hash()
+	}
+
+	serverHost := &mocks.MockP2p{}
+	serverMempool := &mocks.MockMempool{}
+
+	// Returns the requested operations, they are always requested in order
+	serverMempool.On("OperationHashes").Return(hashes)
+	for i := range ops {
+		rest := ops[i:]
+		serverMempool.On("OperationsByHash", mock.MatchedBy(func(requested []string) bool {
+			return len(requested) == len(rest)
+		})).Return(rest)
+	}
+
+	var server p2p.StreamHandler
+	registered := make(chan struct{})
+	serverHost.On("HandleStream", mock.Anything, p2p.MempoolSyncProtocol, mock.Anything).Run(func(args mock.Arguments) {
+		server = args.Get(2).(p2p.StreamHandler)
+		close(registered)
+	}).Return(nil).Once()
+	serverHost.On("PriorityPeers").Return([]peer.ID{})
+	serverHost.On("Peers").Return([]peer.ID{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go bundler.NewMempoolSync(&config.MempoolConfig{}, httplog.NewLogger(""), nil, serverHost, serverMempool, nil).Run(ctx)
+	<-registered
+
+	// Every response fits under the stream message limit
+	requests := 0
+	host := &syncHost{MockP2p: &mocks.MockP2p{}, server: func(ctx context.Context, p peer.ID, req []byte) ([]byte, error) {
+		requests++
+		res, err := server(ctx, p, req)
+		assert.LessOrEqual(t, len(res), 4<<20)
+		return res, err
+	}}
+	mempool := &mocks.MockMempool{}
+	mempool.On("KnownOperations").Return([]string{})
+
+	var received []string
+	handler := func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		var protoOp proto.Operation
+		require.NoError(t, json.Unmarshal(data, &protoOp))
+		op, err := types.NewOperationFromProto(&protoOp)
+		require.NoError(t, err)
+
+		received = append(received, op.Hash())
+		return pubsub.ValidationIgnore
+	}
+
+	sync := bundler.NewMempoolSync(&config.MempoolConfig{}, httplog.NewLogger(""), nil, host, mempool, handler)
+
+	fetched, err := sync.SyncPeer(ctx, peer.ID("server"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, fetched)
+	assert.Equal(t, hashes, received)
+
+	// One request for the hashes, and one per operation
+	assert.Equal(t, 4, requests)
+}
+
+func TestMempoolSyncRejectsUnrequested(t *testing.T) {
+	host := &mocks.MockP2p{}
+	mempool := &mocks.MockMempool{}
+
+	mempool.On("KnownOperations").Return([]string{})
+
+	op := ingressOp(1)
+	other := ingressOp(2)
+
+	missing, _ := json.Marshal(&bundler.SyncResponse{Missing: []string{op.Hash()}})
+	operations, _ := json.Marshal(&bundler.SyncResponse{Operations: []*proto.Operation{other.ToProtoPure()}})
+
+	host.On("Request", mock.Anything, peer.ID("server"), p2p.MempoolSyncProtocol, mock.Anything).Return(missing, nil).Once()
+	host.On("Request", mock.Anything, peer.ID("server"), p2p.MempoolSyncProtocol, mock.Anything).Return(operations, nil).Once()
+	host.On("ReportPeer", peer.ID("server"), p2p.PeerInvalidMessage).Return().Once()
+
+	handler := func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		t.Fatal("unrequested operation handled")
+		return pubsub.ValidationReject
+	}
+
+	sync := bundler.NewMempoolSync(&config.MempoolConfig{}, httplog.NewLogger(""), nil, host, mempool, handler)
+
+	_, err := sync.SyncPeer(context.Background(), peer.ID("server"))
+	assert.Error(t, err)
+	host.AssertExpectations(t)
+}
+
+func TestMempoolSyncPriorityFirst(t *testing.T) {
+	host := &mocks.MockP2p{}
+	mempool := &mocks.MockMempool{}
+
+	mempool.On("KnownOperations").Return([]string{})
+
+	host.On("PriorityPeers").Return([]peer.ID{"priority"})
+	host.On("Peers").Return([]peer.ID{"a", "priority", "b", "c"})
+
+	var order []peer.ID
+	host.On("Request", mock.Anything, mock.Anything, p2p.MempoolSyncProtocol, mock.Anything).Run(func(args mock.Arguments) {
+		order = append(order, args.Get(1).(peer.ID))
+	}).Return(nil, errors.New("unreachable"))
+
+	cfg := &config.MempoolConfig{SyncPeers: 2}
+	sync := bundler.NewMempoolSync(cfg, httplog.NewLogger(""), nil, host, mempool, nil)
+
+	assert.Equal(t, 0, sync.Sync(context.Background()))
+	assert.Equal(t, []peer.ID{"priority", "a", "b"}, order)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,6 +20,7 @@ import (
 	"github.com/0xsequence/bundler/lib/provider"
 	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/lib/store"
+	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/lib/utils"
 	"github.com/0xsequence/bundler/mempool"
 	"github.com/0xsequence/bundler/p2p"
@@ -40,10 +42,12 @@ type Node struct {
 	Mempool   mempool.Interface
 	Archive   *bundler.Archive
 	Ingress   *bundler.Ingress
+	Sync      *bundler.MempoolSync
 	Collector *collector.Collector
 	Registry  registry.Interface
 	Pruner    *bundler.Pruner
 	Provider  *provider.Batched
+	Router    *provider.Router
 
 	ctx       context.Context
 	ctxStopFn context.CancelFunc
@@ -104,18 +108,25 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		return nil, err
 	}
 
-	// Provider
-	base, err := ethrpc.NewProvider(cfg.NetworkConfig.RpcUrl)
+	// Provider, the router sends every request to one of the upstreams
+	router, err := provider.NewRouter(context.Background(), &cfg.NetworkConfig, logger, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := ethrpc.NewProvider(router.URL())
 	if err != nil {
 		return nil, err
 	}
-	client := utils.NewHttpRpcMetricsClient()
+	client := utils.NewHttpRpcMetricsClient(router)
 	base.SetHTTPClient(&http.Client{
 		Transport: client,
 	})
 
-	// Extended provider
-	extended := provider.NewExtended(base, true, true)
+	// Extended provider, the probes are routed to the
+	// upstreams that support them
+	extended := provider.NewExtendedAuto(context.Background(), base)
+	logger.Info("=> provider capabilities", "debug", extended.SupportsDebug(), "override", extended.SupportsOverride(), "feeHistory", router.Capabilities().FeeHistory)
 	batched := provider.NewBatched(extended, 10*time.Millisecond)
 
 	// ChainID
@@ -137,16 +148,35 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
 
-	client.UseRegistry(promPrefix, cfg.NetworkConfig.RpcUrl)
+	// The calls are measured before they are routed, the
+	// upstreams are measured by the router
+	client.UseRegistry(promPrefix, "router")
+	router.SetRegisterer(promPrefix)
+
+	// Debugger, forked nodes reach the upstreams through the router
+	rpcUrl := router.URL()
+	if strings.EqualFold(cfg.DebuggerConfig.Mode, "anvil") {
+		rpcUrl, err = router.Listen(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Debugger
-	debugger, err := debugger.NewDebugger(cfg.DebuggerConfig, context.Background(), logger, promPrefix, cfg.NetworkConfig.RpcUrl)
+	debugger, err := debugger.NewDebugger(cfg.DebuggerConfig, context.Background(), logger, promPrefix, rpcUrl, batched)
 	if err != nil {
 		return nil, err
 	}
 
 	// Endorser
-	endorser := endorser.NewEndorser(logger, promPrefix, batched, debugger)
+	endorser, err := endorser.NewCachedEndorser(
+		logger,
+		promPrefix,
+		endorser.NewEndorser(logger, promPrefix, batched, debugger, uint64(cfg.MempoolConfig.MaxEndorserGasLimit)),
+		int(cfg.MempoolConfig.EndorserCacheSize),
+	)
+	if err != nil {
+		return nil, err
+	}
 
 	// Store
 	// TODO: Add custom store path
@@ -163,6 +193,10 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		return nil, err
 	}
 
+	// Binary encodings of the gossip topics
+	host.RegisterCodec(p2p.OperationTopic, types.AnnouncementCodec{})
+	host.RegisterCodec(p2p.ArchiveTopic, bundler.ArchiveCodec{})
+
 	// IPFS Client
 	ipfs := ipfs.NewClient(promPrefix, cfg.NetworkConfig.IPFSUrl)
 
@@ -191,6 +225,9 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		return nil, err
 	}
 
+	// Peers that relayed operations of permanently banned endorsers lose reputation
+	registry.OnBan(host.ReportBannedEndorser)
+
 	// Mempool
 	mempool, err := mempool.NewMempool(&cfg.MempoolConfig, logger, promPrefix, endorser, collector, ipfs, calldataModel, registry)
 	if err != nil {
@@ -198,16 +235,19 @@ func NewNode(cfg *config.Config) (*Node, error) {
 	}
 
 	// Ingress
-	ingress := bundler.NewIngress(&cfg.MempoolConfig, logger, promPrefix, mempool, collector, host)
+	ingress := bundler.NewIngress(&cfg.MempoolConfig, logger, promPrefix, mempool, collector, registry, host)
+
+	// Mempool sync, fetched operations are validated by the ingress
+	mempoolSync := bundler.NewMempoolSync(&cfg.MempoolConfig, logger, promPrefix, host, mempool, ingress.HandleOperation)
 
 	// Archive
 	archive := bundler.NewArchive(&cfg.ArchiveConfig, host, logger, promPrefix, store, ipfs, mempool)
 
 	// Pruner
-	pruner := bundler.NewPruner(cfg.PrunerConfig, logger, promPrefix, mempool, endorser, registry)
+	pruner := bundler.NewPruner(cfg.PrunerConfig, logger, promPrefix, mempool, endorser, registry, batched)
 
 	// RPC
-	rpc, err := rpc.NewRPC(cfg, logger, promPrefix, prom, host, mempool, archive, batched.Provider, collector, endorser, ipfs, registry)
+	rpc, err := rpc.NewRPC(cfg, logger, promPrefix, prom, host, mempool, archive, ingress, batched.Provider, collector, endorser, ipfs, registry)
 	if err != nil {
 		return nil, err
 	}
@@ -223,10 +263,12 @@ func NewNode(cfg *config.Config) (*Node, error) {
 		Mempool:   mempool,
 		Archive:   archive,
 		Ingress:   ingress,
+		Sync:      mempoolSync,
 		Collector: collector,
 		Registry:  registry,
 		Pruner:    pruner,
 		Provider:  batched,
+		Router:    router,
 	}
 
 	return server, nil
@@ -261,6 +303,12 @@ func (s *Node) Run() error {
 		return s.Provider.Run(ctx)
 	})
 
+	// Provider router
+	g.Go(func() error {
+		oplog.Info("-> router: run")
+		return s.Router.Run(ctx)
+	})
+
 	// Node
 	g.Go(func() error {
 		oplog.Info("-> p2p: run")
@@ -274,6 +322,13 @@ func (s *Node) Run() error {
 		return nil
 	})
 
+	// Mempool sync
+	g.Go(func() error {
+		oplog.Info("-> mempool sync: run")
+		s.Sync.Run(ctx)
+		return nil
+	})
+
 	// Archive
 	g.Go(func() error {
 		oplog.Info("-> archive: run")
@@ -0,0 +1,132 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Encoding is how a payload is sent on a pubsub topic, every encoding
+// has its own subtopic, so a node only receives what it can decode.
+type Encoding string
+
+const (
+	EncodingJSON        = Encoding("json")
+	EncodingRLPSnappyV1 = Encoding("rlp_snappy_v1")
+)
+
+// DefaultEncodings prefers the binary encoding, but keeps talking
+// to the peers that only understand JSON
+var DefaultEncodings = []Encoding{EncodingRLPSnappyV1, EncodingJSON}
+
+// Codec converts the payloads of a topic to and from a binary form,
+// decoded payloads are handed to the topic handler as JSON.
+type Codec interface {
+	Encode(payload interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// maxDecodedSize bounds the size of decompressed messages
+const maxDecodedSize = 4 << 20 // 4MB
+
+func ParseEncodings(names []string) ([]Encoding, error) {
+	if len(names) == 0 {
+		return DefaultEncodings, nil
+	}
+
+	encodings := make([]Encoding, 0, len(names))
+	for _, name := range names {
+		switch enc := Encoding(name); enc {
+		case EncodingJSON, EncodingRLPSnappyV1:
+			encodings = append(encodings, enc)
+		default:
+			return nil, fmt.Errorf("unknown pubsub encoding %q", name)
+		}
+	}
+
+	return encodings, nil
+}
+
+// Encoded is the subtopic of the encoding, JSON uses
+// the bare topic so older nodes can still be reached
+func (p PubsubTopic) Encoded(chainID *big.Int, enc Encoding) string {
+	if enc == EncodingJSON {
+		return p.For(chainID)
+	}
+
+	return p.For(chainID) + "/" + string(enc)
+}
+
+func (n *Host) encode(topic PubsubTopic, enc Encoding, payload interface{}) ([]byte, error) {
+	if enc == EncodingJSON {
+		return json.Marshal(payload)
+	}
+
+	codec, ok := n.codecs[topic]
+	if !ok {
+		return nil, fmt.Errorf("no codec for topic %s", topic)
+	}
+
+	data, err := codec.Encode(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return snappy.Encode(nil, data), nil
+}
+
+// decode converts a message to the JSON form the handlers expect
+func (n *Host) decode(topic PubsubTopic, enc Encoding, data []byte) ([]byte, error) {
+	if enc == EncodingJSON {
+		return data, nil
+	}
+
+	codec, ok := n.codecs[topic]
+	if !ok {
+		return nil, fmt.Errorf("no codec for topic %s", topic)
+	}
+
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if size > maxDecodedSize {
+		return nil, fmt.Errorf("decoded message exceeds %d bytes", maxDecodedSize)
+	}
+
+	raw, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := codec.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(payload)
+}
+
+// topicEncodings are the enabled encodings that the topic can use
+func (n *Host) topicEncodings(topic PubsubTopic) []Encoding {
+	encodings := make([]Encoding, 0, len(n.encodings))
+	for _, enc := range n.encodings {
+		if _, ok := n.codecs[topic]; ok || enc == EncodingJSON {
+			encodings = append(encodings, enc)
+		}
+	}
+
+	return encodings
+}
+
+// RegisterCodec enables the binary encodings of a topic, it must
+// be called before the topic is handled
+func (n *Host) RegisterCodec(topic PubsubTopic, codec Codec) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.codecs[topic] = codec
+}
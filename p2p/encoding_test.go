@@ -0,0 +1,30 @@
+package p2p_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/0xsequence/bundler/p2p"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEncodings(t *testing.T) {
+	encodings, err := p2p.ParseEncodings(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, p2p.DefaultEncodings, encodings)
+
+	encodings, err = p2p.ParseEncodings([]string{"rlp_snappy_v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []p2p.Encoding{p2p.EncodingRLPSnappyV1}, encodings)
+
+	_, err = p2p.ParseEncodings([]string{"xml"})
+	assert.Error(t, err)
+}
+
+func TestEncodedTopic(t *testing.T) {
+	chainID := big.NewInt(1)
+
+	// JSON keeps the topic older nodes subscribe to
+	assert.Equal(t, "ERC5189:pool:op:1", p2p.OperationTopic.Encoded(chainID, p2p.EncodingJSON))
+	assert.Equal(t, "ERC5189:pool:op:1/rlp_snappy_v1", p2p.OperationTopic.Encoded(chainID, p2p.EncodingRLPSnappyV1))
+}
@@ -12,11 +12,13 @@ import (
 
 	"github.com/0xsequence/bundler/config"
 	"github.com/0xsequence/ethkit/ethwallet"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
 	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
 	p2pnetwork "github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -25,10 +27,19 @@ import (
 	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
 	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// How often the static peers are reconnected, when the DHT is disabled
+const staticPeersInterval = 10 * time.Second
+
+const (
+	DefaultConnLowWater  = 300
+	DefaultConnHighWater = 400
+)
+
 type Host struct {
 	lock sync.Mutex
 
@@ -38,6 +49,20 @@ type Host struct {
 	host    host.Host
 	pubsub  *pubsub.PubSub
 	topics  map[string]*pubsub.Topic
+	scorer  *PeerScorer
+
+	// Only set on networks with an allowlist
+	allowlist *AllowlistGater
+
+	peerStats *peerStats
+	priority  map[peer.ID]peer.AddrInfo
+	limiter   *rateLimiter
+
+	encodings []Encoding
+	codecs    map[PubsubTopic]Codec
+
+	// Reachability reported by AutoNAT
+	reachability atomic.Int32
 
 	peerPrivKey crypto.PrivKey
 
@@ -88,9 +113,25 @@ func NewIdentity(mnmonic string) (*Identity, error) {
 func NewHost(cfg *config.P2PHostConfig, logger *slog.Logger, metrics prometheus.Registerer, identity *Identity, chainID *big.Int) (*Host, error) {
 	logger = logger.With("hostId", identity.ID.String())
 
+	encodings, err := ParseEncodings(cfg.Encodings)
+	if err != nil {
+		return nil, err
+	}
+
+	lowWater, highWater := DefaultConnLowWater, DefaultConnHighWater
+	if cfg.ConnLowWater != 0 {
+		lowWater = cfg.ConnLowWater
+	}
+	if cfg.ConnHighWater != 0 {
+		highWater = cfg.ConnHighWater
+	}
+	if highWater < lowWater {
+		return nil, fmt.Errorf("p2p: connection high water %d is below low water %d", highWater, lowWater)
+	}
+
 	connmgr, err := connmgr.NewConnManager(
-		300, // Lowwater
-		400, // HighWater,
+		lowWater,
+		highWater,
 		connmgr.WithGracePeriod(time.Minute),
 	)
 	if err != nil {
@@ -102,41 +143,88 @@ func NewHost(cfg *config.P2PHostConfig, logger *slog.Logger, metrics prometheus.
 		registerOpts = libp2p.PrometheusRegisterer(metrics)
 	}
 
+	scorer := NewPeerScorer(cfg, logger, metrics)
+
+	gater, err := NewGater(cfg, scorer)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, _ := gater.(*AllowlistGater)
+
+	psk, err := ParsePrivateNetworkKey(cfg.PrivateNetworkKey)
+	if err != nil {
+		return nil, err
+	}
+
+	listenAddrs := []string{
+		fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", cfg.P2PPort), // TCP transport
+	}
+	transports := []libp2p.Option{
+		libp2p.NoTransports,
+		libp2p.Transport(tcp.NewTCPTransport),
+	}
+
+	// QUIC does not support pre-shared keys
+	if psk == nil {
+		listenAddrs = append(listenAddrs, fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", cfg.P2PPort)) // QUIC transport
+		transports = append(transports, libp2p.Transport(quic.NewTransport))
+	} else {
+		logger.Info("p2p: private network enabled, QUIC is disabled")
+	}
+
+	if cfg.WebsocketPort != 0 {
+		listenAddrs = append(listenAddrs, fmt.Sprintf("/ip4/0.0.0.0/tcp/%d/ws", cfg.WebsocketPort)) // Websocket transport
+		transports = append(transports, libp2p.Transport(websocket.New))
+	}
+
+	relayOpts, err := relayOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrsOpts libp2p.Option
+	if len(cfg.AnnounceMultiaddrs) != 0 {
+		announce := cfg.AnnounceMultiaddrs
+		addrsOpts = libp2p.AddrsFactory(func([]multiaddr.Multiaddr) []multiaddr.Multiaddr {
+			return announce
+		})
+	}
+
 	h, err := libp2p.New(
 		// Use the keypair we generated
 		libp2p.Identity(identity.privKey),
 
-		// if we want network to be separated, etc.
-		// libp2p.PrivateNetwork(),
+		// Only peers with the same pre-shared key can connect
+		libp2p.PrivateNetwork(psk),
 
-		// Multiple listen addresses
+		// Multiple listen addresses, the announced addresses
+		// replace them when the node is behind NAT
 		//
 		// Addr hosts result in, for example:
 		// /ip4/127.0.0.1/tcp/5000/p2p/16Uiu2HAmKygtVwc8pYhcHPbAJidkLtNce4Mge6eFu3fZpB7Vu3ri
 		// /ip4/127.0.0.1/udp/5000/quic-v1/p2p/16Uiu2HAmKygtVwc8pYhcHPbAJidkLtNce4Mge6eFu3fZpB7Vu3ri
-		libp2p.ListenAddrStrings(
-			fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", cfg.P2PPort),         // TCP transport
-			fmt.Sprintf("/ip4/0.0.0.0/udp/%d/quic-v1", cfg.P2PPort), // QUIC transport
-		),
+		libp2p.ListenAddrStrings(listenAddrs...),
 		// libp2p.ListenAddrs(listenAddr),
+		addrsOpts,
 
 		// support TLS connections
 		libp2p.Security(libp2ptls.ID, libp2ptls.New),
 		// support noise connections
 		libp2p.Security(noise.ID, noise.New),
 
-		// support any other default transports (TCP)
+		// TCP, QUIC unless the network is private,
+		// and websockets if they are enabled
 		// libp2p.DefaultTransports,
-		libp2p.ChainOptions(
-			libp2p.NoTransports,
-			libp2p.Transport(tcp.NewTCPTransport),
-			libp2p.Transport(quic.NewTransport),
-		),
+		libp2p.ChainOptions(transports...),
 
 		// Let's prevent our peer from having too many
 		// connections by attaching a connection manager.
 		libp2p.ConnectionManager(connmgr),
 
+		// Keep blacklisted peers out, and the peers
+		// not in the allowlist of private networks
+		libp2p.ConnectionGater(gater),
+
 		// Attempt to open ports using uPNP for NATed hosts.
 		libp2p.NATPortMap(),
 
@@ -148,35 +236,68 @@ func NewHost(cfg *config.P2PHostConfig, logger *slog.Logger, metrics prometheus.
 		// performance issues.
 		libp2p.EnableNATService(),
 
-		// ..
-		libp2p.DisableRelay(),
+		// Circuit relay v2 and AutoRelay, disabled unless configured
+		libp2p.ChainOptions(relayOpts...),
 
 		libp2p.EnableHolePunching(),
 
 		// Metrics
 		registerOpts,
-
-		// TODO: review all libp2p options and defaults
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	scorer.host = h
+
 	nd := &Host{
 		cfg:         cfg,
 		logger:      logger,
 		metrics:     createMetrics(metrics),
 		host:        h,
+		scorer:      scorer,
+		allowlist:   allowlist,
 		peerPrivKey: identity.privKey,
 		chainID:     chainID,
 
 		topics: make(map[string]*pubsub.Topic),
+
+		peerStats: newPeerStats(),
+		priority:  make(map[peer.ID]peer.AddrInfo),
+		limiter:   newRateLimiter(cfg),
+
+		encodings: encodings,
+		codecs:    make(map[PubsubTopic]Codec),
 	}
 
 	return nd, nil
 }
 
+// relayOptions enables the relay transport when the node uses relays or
+// relays for others, static relays make AutoRelay reserve slots on them
+func relayOptions(cfg *config.P2PHostConfig) ([]libp2p.Option, error) {
+	if !cfg.RelayClient && !cfg.RelayService && len(cfg.StaticRelayAddrs) == 0 {
+		return []libp2p.Option{libp2p.DisableRelay()}, nil
+	}
+
+	opts := []libp2p.Option{libp2p.EnableRelay()}
+
+	if cfg.RelayService {
+		opts = append(opts, libp2p.EnableRelayService())
+	}
+
+	if len(cfg.StaticRelayAddrs) != 0 {
+		relays, err := AddrInfoFromP2pAddrs(cfg.StaticRelayAddrs)
+		if err != nil {
+			return nil, fmt.Errorf("p2p: invalid static relay: %w", err)
+		}
+		opts = append(opts, libp2p.EnableAutoRelayWithStaticRelays(relays))
+	}
+
+	return opts, nil
+}
+
 func (n *Host) Run(ctx context.Context) error {
 	if n.IsRunning() {
 		return fmt.Errorf("node: already running")
@@ -206,9 +327,16 @@ func (n *Host) Run(ctx context.Context) error {
 		return err
 	}
 
+	n.lock.Lock()
 	for _, peerInfo := range priorityPeers {
 		n.logger.Info("protecting priority peer", "peerId", peerInfo.ID.String())
 		n.host.ConnManager().Protect(peerInfo.ID, "priority")
+		n.priority[peerInfo.ID] = peerInfo
+	}
+	n.lock.Unlock()
+
+	if n.cfg.DisableDHT {
+		go n.keepStaticPeers(ctx, bootPeers)
 	}
 
 	err = n.setupPubsub(ctx, n.chainID)
@@ -216,6 +344,12 @@ func (n *Host) Run(ctx context.Context) error {
 		return err
 	}
 
+	go n.scorer.run(ctx)
+
+	if err := n.trackReachability(ctx); err != nil {
+		n.logger.Warn("p2p: unable to track NAT reachability", "err", err)
+	}
+
 	return nil
 }
 
@@ -245,12 +379,6 @@ func (s *Host) IsStopping() bool {
 func (n *Host) bootstrap(ctx context.Context, bootPeers []peer.AddrInfo) error {
 	logger := n.logger
 
-	// run a DHT router in server mode
-	kdht, err := dht.New(ctx, n.host, dht.Mode(dht.ModeServer))
-	if err != nil {
-		return err
-	}
-
 	connected := make(chan struct{})
 
 	var wg sync.WaitGroup
@@ -284,6 +412,19 @@ func (n *Host) bootstrap(ctx context.Context, bootPeers []peer.AddrInfo) error {
 		logger.Warn(fmt.Sprintf("only connected to %d bootstrap peers out of %d", i, nPeers))
 	}
 
+	// Static peering only, the boot and priority
+	// nodes are kept connected by Run
+	if n.cfg.DisableDHT {
+		logger.Info("p2p: DHT disabled, only static peers are used")
+		return nil
+	}
+
+	// run a DHT router in server mode
+	kdht, err := dht.New(ctx, n.host, dht.Mode(dht.ModeServer))
+	if err != nil {
+		return err
+	}
+
 	err = kdht.Bootstrap(ctx)
 	if err != nil {
 		logger.Error("kdht bootstrap error", "err", err)
@@ -430,6 +571,72 @@ func (n *Host) bootstrap(ctx context.Context, bootPeers []peer.AddrInfo) error {
 // 	return res
 // }
 
+func (n *Host) trackReachability(ctx context.Context) error {
+	sub, err := n.host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer sub.Close()
+
+		for {
+			select {
+			case e, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+
+				reachability := e.(event.EvtLocalReachabilityChanged).Reachability
+				n.reachability.Store(int32(reachability))
+				n.logger.Info("p2p: NAT reachability changed", "reachability", reachability.String())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Reachability is whether the node can be reached from
+// the outside, as detected by AutoNAT
+func (n *Host) Reachability() p2pnetwork.Reachability {
+	return p2pnetwork.Reachability(n.reachability.Load())
+}
+
+// AnnouncedAddrs are the addresses the node tells its peers,
+// including the relay addresses
+func (n *Host) AnnouncedAddrs() []multiaddr.Multiaddr {
+	if n.host == nil {
+		return []multiaddr.Multiaddr{}
+	}
+	return n.host.Addrs()
+}
+
+// keepStaticPeers reconnects to the boot and priority peers when
+// they drop, as there is no DHT to find other peers
+func (n *Host) keepStaticPeers(ctx context.Context, bootPeers []peer.AddrInfo) {
+	for {
+		for _, pinfo := range append(bootPeers, n.priorityPeerInfos()...) {
+			if pinfo.ID == n.host.ID() || n.host.Network().Connectedness(pinfo.ID) == p2pnetwork.Connected {
+				continue
+			}
+
+			if err := n.host.Connect(ctx, pinfo); err != nil {
+				n.metrics.bootnodesRetries.Inc()
+				n.logger.Debug("p2p: unable to connect to static peer", "peerId", pinfo.ID.String(), "err", err)
+			}
+		}
+
+		select {
+		case <-time.After(staticPeersInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (n *Host) HostID() peer.ID {
 	if n.host == nil {
 		return ""
@@ -462,6 +669,28 @@ func (n *Host) Peers() []peer.ID {
 	}
 }
 
+// PeerScores returns the score of every peer that relayed
+// something recently, from the lowest score
+func (n *Host) PeerScores() []*PeerScore {
+	return n.scorer.Scores()
+}
+
+func (n *Host) ReportPeer(p peer.ID, outcome PeerOutcome) {
+	n.scorer.Report(p, outcome)
+}
+
+func (n *Host) TrackOperation(p peer.ID, oph string, endorser common.Address) {
+	n.scorer.TrackOperation(p, oph, endorser)
+}
+
+func (n *Host) ReportOperation(oph string, outcome PeerOutcome) {
+	n.scorer.ReportOperation(oph, outcome)
+}
+
+func (n *Host) ReportBannedEndorser(endorser common.Address) {
+	n.scorer.ReportBannedEndorser(endorser)
+}
+
 func (n *Host) PriorityPeers() []peer.ID {
 	if n.host == nil {
 		return []peer.ID{}
@@ -469,8 +698,7 @@ func (n *Host) PriorityPeers() []peer.ID {
 
 	priorityPeers := []peer.ID{}
 	for _, p := range n.host.Network().Peers() {
-		tag := n.host.ConnManager().GetTagInfo(p)
-		if tag != nil && tag.Tags["priority"] > 0 {
+		if n.host.ConnManager().IsProtected(p, "priority") {
 			priorityPeers = append(priorityPeers, p)
 		}
 	}
@@ -0,0 +1,83 @@
+package p2p_test
+
+import (
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/p2p"
+	p2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostTransports(t *testing.T) {
+	identity, err := p2p.NewIdentity(testMnemonic)
+	require.NoError(t, err)
+
+	cfg := &config.P2PHostConfig{
+		AnnounceAddrs: []string{"/ip4/203.0.113.7/tcp/4000"},
+		RelayClient:   true,
+		RelayService:  true,
+		DisableDHT:    true,
+	}
+	require.NoError(t, config.InitP2PHostConfig(cfg))
+
+	host, err := p2p.NewHost(cfg, slog.Default(), nil, identity, big.NewInt(1))
+	require.NoError(t, err)
+
+	// Peers are told the announced address, not the listen ones
+	announced := host.AnnouncedAddrs()
+	require.Len(t, announced, 1)
+	assert.Equal(t, "/ip4/203.0.113.7/tcp/4000", announced[0].String())
+
+	// AutoNAT hasn't probed the node yet
+	assert.Equal(t, p2pnetwork.ReachabilityUnknown, host.Reachability())
+}
+
+func TestHostWebsocket(t *testing.T) {
+	identity, err := p2p.NewIdentity(testMnemonic)
+	require.NoError(t, err)
+
+	cfg := &config.P2PHostConfig{
+		WebsocketPort: 14555,
+		DisableDHT:    true,
+	}
+
+	host, err := p2p.NewHost(cfg, slog.Default(), nil, identity, big.NewInt(1))
+	require.NoError(t, err)
+
+	var ws bool
+	for _, addr := range host.Addrs() {
+		if _, err := addr.ValueForProtocol(multiaddr.P_WS); err == nil {
+			ws = true
+		}
+	}
+	assert.True(t, ws)
+}
+
+func TestHostWatermarks(t *testing.T) {
+	identity, err := p2p.NewIdentity(testMnemonic)
+	require.NoError(t, err)
+
+	cfg := &config.P2PHostConfig{
+		ConnLowWater:  100,
+		ConnHighWater: 50,
+	}
+
+	_, err = p2p.NewHost(cfg, slog.Default(), nil, identity, big.NewInt(1))
+	assert.Error(t, err)
+}
+
+func TestInitP2PHostConfigRelays(t *testing.T) {
+	cfg := &config.P2PHostConfig{
+		StaticRelays: []string{"/ip4/127.0.0.1/tcp/4000/p2p/12D3KooWC4xKePNkVwHRzQ2vn1jjpvVtXsKWWmTGLLis2bgwPTSZ"},
+	}
+	require.NoError(t, config.InitP2PHostConfig(cfg))
+	assert.Len(t, cfg.StaticRelayAddrs, 1)
+
+	cfg = &config.P2PHostConfig{AnnounceAddrs: []string{"nope"}}
+	assert.Error(t, config.InitP2PHostConfig(cfg))
+}
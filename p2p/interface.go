@@ -3,6 +3,8 @@ package p2p
 import (
 	"context"
 
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
@@ -13,6 +15,15 @@ type Interface interface {
 	BroadcastData(ctx context.Context, topic PubsubTopic, payload []byte) error
 	Broadcast(ctx context.Context, topic PubsubTopic, payload interface{}) error
 	HandleTopic(ctx context.Context, topic PubsubTopic, handler MsgHandler) error
+	HandleStream(ctx context.Context, proto StreamProtocol, handler StreamHandler) error
+	Request(ctx context.Context, p peer.ID, proto StreamProtocol, req []byte) ([]byte, error)
+	Peers() []peer.ID
+	PriorityPeers() []peer.ID
 	Address() (string, error)
 	Sign(data []byte) ([]byte, error)
+
+	ReportPeer(p peer.ID, outcome PeerOutcome)
+	TrackOperation(p peer.ID, oph string, endorser common.Address)
+	ReportOperation(oph string, outcome PeerOutcome)
+	ReportBannedEndorser(endorser common.Address)
 }
@@ -19,6 +19,7 @@ type metrics struct {
 	pubsubFilteredSelf   prometheus.Counter
 	pubsubReceivedBytes  *prometheus.HistogramVec
 	pubsubHandledTime    *prometheus.HistogramVec
+	pubsubRateLimited    *prometheus.CounterVec
 
 	pubsubAddedPeers     prometheus.Counter
 	pubsubRemovedPeers   prometheus.Counter
@@ -44,6 +45,9 @@ type metrics struct {
 	pubsubRPCSubDrop prometheus.Counter
 	pubsubRPCPubDrop *prometheus.CounterVec
 	pubsubRPCDrop    *prometheus.CounterVec
+
+	streamRequestsSent    *prometheus.CounterVec
+	streamRequestsHandled *prometheus.CounterVec
 }
 
 func createMetrics(reg prometheus.Registerer) *metrics {
@@ -89,6 +93,11 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		Buckets: prometheus.ExponentialBuckets(1e-6, 2, 15),
 	}, []string{"topic", "result"})
 
+	pubsubRateLimited := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_pubsub_rate_limited",
+		Help: "Number of pubsub messages ignored for exceeding the peer rate limit",
+	}, []string{"topic"})
+
 	pubsubReceivedBytes := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "p2p_pubsub_received_bytes",
 		Help:    "Number of bytes received in pubsub",
@@ -216,6 +225,16 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		Help: "Total number of RPCs dropped",
 	}, []string{"type"})
 
+	streamRequestsSent := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_stream_requests_sent",
+		Help: "Number of stream requests sent to peers",
+	}, []string{"protocol", "result"})
+
+	streamRequestsHandled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_stream_requests_handled",
+		Help: "Number of stream requests handled for peers",
+	}, []string{"protocol", "result"})
+
 	if reg != nil {
 		reg.MustRegister(
 			bootnodesConnected,
@@ -226,6 +245,7 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 			pubsubReceivedErrors,
 			pubsubFilteredSelf,
 			pubsubHandledTime,
+			pubsubRateLimited,
 			pubsubReceivedBytes,
 			foundPeers,
 			foundSelfAsPeer,
@@ -251,6 +271,8 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 			pubsubRPCSubDrop,
 			pubsubRPCPubDrop,
 			pubsubRPCDrop,
+			streamRequestsSent,
+			streamRequestsHandled,
 		)
 	}
 
@@ -271,6 +293,7 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		pubsubFilteredSelf:   pubsubFilteredSelf,
 		pubsubReceivedBytes:  pubsubReceivedBytes,
 		pubsubHandledTime:    pubsubHandledTime,
+		pubsubRateLimited:    pubsubRateLimited,
 
 		pubsubAddedPeers:     pubsubAddedPeers,
 		pubsubRemovedPeers:   pubsubRemovedPeers,
@@ -296,5 +319,8 @@ func createMetrics(reg prometheus.Registerer) *metrics {
 		pubsubRPCSubDrop: pubsubRPCSubDrop,
 		pubsubRPCPubDrop: pubsubRPCPubDrop,
 		pubsubRPCDrop:    pubsubRPCDrop,
+
+		streamRequestsSent:    streamRequestsSent,
+		streamRequestsHandled: streamRequestsHandled,
 	}
 }
@@ -19,13 +19,14 @@ const (
 )
 
 // This tracer is used to implement metrics collection for messages received
-// and broadcasted through gossipsub.
+// and broadcasted through gossipsub, it also keeps the counts of every peer.
 type metricsTracer struct {
 	metrics *metrics
+	peers   *peerStats
 }
 
-func newMetricsTracer(metrics *metrics) *metricsTracer {
-	return &metricsTracer{metrics: metrics}
+func newMetricsTracer(metrics *metrics, peers *peerStats) *metricsTracer {
+	return &metricsTracer{metrics: metrics, peers: peers}
 }
 
 // AddPeer .
@@ -36,6 +37,7 @@ func (g metricsTracer) AddPeer(p peer.ID, proto protocol.ID) {
 // RemovePeer .
 func (g metricsTracer) RemovePeer(p peer.ID) {
 	g.metrics.pubsubRemovedPeers.Inc()
+	g.peers.remove(p)
 }
 
 // Join .
@@ -51,11 +53,13 @@ func (g metricsTracer) Leave(topic string) {
 // Graft .
 func (g metricsTracer) Graft(p peer.ID, topic string) {
 	g.metrics.pubsubTopicsGraft.WithLabelValues(topic).Inc()
+	g.peers.graft(p, topic)
 }
 
 // Prune .
 func (g metricsTracer) Prune(p peer.ID, topic string) {
 	g.metrics.pubsubTopicsPrune.WithLabelValues(topic).Inc()
+	g.peers.prune(p, topic)
 }
 
 // ValidateMessage .
@@ -66,11 +70,13 @@ func (g metricsTracer) ValidateMessage(msg *pubsub.Message) {
 // DeliverMessage .
 func (g metricsTracer) DeliverMessage(msg *pubsub.Message) {
 	g.metrics.pubsubMessageDeliver.WithLabelValues(*msg.Topic).Inc()
+	g.peers.received(msg.ReceivedFrom)
 }
 
 // RejectMessage .
 func (g metricsTracer) RejectMessage(msg *pubsub.Message, reason string) {
 	g.metrics.pubsubMessageReject.WithLabelValues(*msg.Topic, reason).Inc()
+	g.peers.rejected(msg.ReceivedFrom)
 }
 
 // DuplicateMessage .
@@ -96,6 +102,7 @@ func (g metricsTracer) RecvRPC(rpc *pubsub.RPC) {
 // SendRPC .
 func (g metricsTracer) SendRPC(rpc *pubsub.RPC, p peer.ID) {
 	g.setMetricFromRPC(send, g.metrics.pubsubRPCSubSent, g.metrics.pubsubRPCPubSent, g.metrics.pubsubRPCSent, rpc)
+	g.peers.sent(p, len(rpc.Publish))
 }
 
 // DropRPC .
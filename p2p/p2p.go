@@ -11,6 +11,10 @@ type PubsubTopic string
 const OperationTopic = PubsubTopic("ERC5189:pool:op")
 const ArchiveTopic = PubsubTopic("ERC5189:pool:archive")
 
+type StreamProtocol string
+
+const MempoolSyncProtocol = StreamProtocol("/erc5189/mempool-sync/1")
+
 func (p PubsubTopic) For(chainID *big.Int) string {
 	return string(p) + ":" + chainID.String()
 }
@@ -18,3 +22,7 @@ func (p PubsubTopic) For(chainID *big.Int) string {
 func (d DiscoveryNamespace) For(chainID *big.Int) string {
 	return string(d) + ":" + chainID.String()
 }
+
+func (p StreamProtocol) For(chainID *big.Int) string {
+	return string(p) + "/" + chainID.String()
+}
@@ -0,0 +1,259 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	p2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PeerInfo describes a connected peer
+type PeerInfo struct {
+	Peer        peer.ID
+	Addrs       []multiaddr.Multiaddr
+	Direction   p2pnetwork.Direction
+	Latency     time.Duration
+	Protocols   []string
+	ConnectedAt time.Time
+	Priority    bool
+
+	// Topics where the peer is in our gossip mesh
+	Topics []string
+
+	MessagesReceived uint64
+	MessagesRejected uint64
+	MessagesSent     uint64
+}
+
+type peerCounters struct {
+	topics   map[string]struct{}
+	received uint64
+	rejected uint64
+	sent     uint64
+}
+
+// peerStats keeps the gossip counters of every pubsub peer,
+// they are fed by the metrics tracer and dropped with the peer
+type peerStats struct {
+	lock  sync.Mutex
+	peers map[peer.ID]*peerCounters
+}
+
+func newPeerStats() *peerStats {
+	return &peerStats{peers: make(map[peer.ID]*peerCounters)}
+}
+
+func (s *peerStats) counters(p peer.ID) *peerCounters {
+	c, ok := s.peers[p]
+	if !ok {
+		c = &peerCounters{topics: make(map[string]struct{})}
+		s.peers[p] = c
+	}
+	return c
+}
+
+func (s *peerStats) graft(p peer.ID, topic string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters(p).topics[topic] = struct{}{}
+}
+
+func (s *peerStats) prune(p peer.ID, topic string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.counters(p).topics, topic)
+}
+
+func (s *peerStats) received(p peer.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters(p).received++
+}
+
+func (s *peerStats) rejected(p peer.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters(p).rejected++
+}
+
+func (s *peerStats) sent(p peer.ID, n int) {
+	if n == 0 {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters(p).sent += uint64(n)
+}
+
+func (s *peerStats) remove(p peer.ID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.peers, p)
+}
+
+// fill copies the counters of the peer into the info
+func (s *peerStats) fill(info *PeerInfo) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, ok := s.peers[info.Peer]
+	if !ok {
+		return
+	}
+
+	info.Topics = make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		info.Topics = append(info.Topics, topic)
+	}
+	sort.Strings(info.Topics)
+
+	info.MessagesReceived = c.received
+	info.MessagesRejected = c.rejected
+	info.MessagesSent = c.sent
+}
+
+// PeerInfos returns the details of every connected peer
+func (n *Host) PeerInfos() []*PeerInfo {
+	if n.host == nil {
+		return []*PeerInfo{}
+	}
+
+	peers := n.host.Network().Peers()
+	infos := make([]*PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		conns := n.host.Network().ConnsToPeer(p)
+		if len(conns) == 0 {
+			continue
+		}
+
+		info := &PeerInfo{
+			Peer:        p,
+			Direction:   conns[0].Stat().Direction,
+			Latency:     n.host.Peerstore().LatencyEWMA(p),
+			ConnectedAt: conns[0].Stat().Opened,
+			Priority:    n.host.ConnManager().IsProtected(p, "priority"),
+		}
+
+		for _, conn := range conns {
+			info.Addrs = append(info.Addrs, conn.RemoteMultiaddr())
+			if conn.Stat().Opened.Before(info.ConnectedAt) {
+				info.ConnectedAt = conn.Stat().Opened
+				info.Direction = conn.Stat().Direction
+			}
+		}
+
+		if protocols, err := n.host.Peerstore().GetProtocols(p); err == nil {
+			for _, proto := range protocols {
+				info.Protocols = append(info.Protocols, string(proto))
+			}
+			sort.Strings(info.Protocols)
+		}
+
+		n.peerStats.fill(info)
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+
+	return infos
+}
+
+// Connect dials the peer at the address, it must include the peer id
+func (n *Host) Connect(ctx context.Context, addr multiaddr.Multiaddr) (peer.ID, error) {
+	info, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer address: %w", err)
+	}
+
+	if info.ID == n.host.ID() {
+		return "", fmt.Errorf("unable to connect to self")
+	}
+
+	if err := n.host.Connect(ctx, *info); err != nil {
+		return "", err
+	}
+
+	n.logger.Info("p2p: connected to peer", "peerId", info.ID.String())
+	return info.ID, nil
+}
+
+// Disconnect closes the connections with the peer, it may connect again
+func (n *Host) Disconnect(p peer.ID) error {
+	n.logger.Info("p2p: disconnecting peer", "peerId", p.String())
+	return n.host.Network().ClosePeer(p)
+}
+
+// BanPeer disconnects the peer and keeps it out for the duration,
+// or for the blacklist duration if it is zero, priority peers lose
+// their priority
+func (n *Host) BanPeer(p peer.ID, duration time.Duration) {
+	n.RemovePriorityPeer(p)
+	n.scorer.Ban(p, duration)
+}
+
+// AddPriorityPeer protects the peer at the address in the connection
+// manager and connects to it, it is kept until it is removed or the
+// node restarts, on networks with an allowlist the peer is also allowed
+func (n *Host) AddPriorityPeer(ctx context.Context, addr multiaddr.Multiaddr) (peer.ID, error) {
+	info, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer address: %w", err)
+	}
+
+	if info.ID == n.host.ID() {
+		return "", fmt.Errorf("unable to add self as priority peer")
+	}
+
+	n.lock.Lock()
+	n.priority[info.ID] = *info
+	n.lock.Unlock()
+
+	if n.allowlist != nil {
+		n.allowlist.Allow(info.ID)
+	}
+
+	n.logger.Info("protecting priority peer", "peerId", info.ID.String())
+	n.host.ConnManager().Protect(info.ID, "priority")
+
+	if err := n.host.Connect(ctx, *info); err != nil {
+		// It stays a priority peer, the connection may come later
+		n.logger.Warn("p2p: unable to connect to priority peer", "peerId", info.ID.String(), "err", err)
+	}
+
+	return info.ID, nil
+}
+
+// RemovePriorityPeer turns the peer into a regular peer, it
+// returns false if the peer did not have priority
+func (n *Host) RemovePriorityPeer(p peer.ID) bool {
+	n.lock.Lock()
+	delete(n.priority, p)
+	n.lock.Unlock()
+
+	if !n.host.ConnManager().IsProtected(p, "priority") {
+		return false
+	}
+	n.host.ConnManager().Unprotect(p, "priority")
+
+	n.logger.Info("p2p: priority removed from peer", "peerId", p.String())
+	return true
+}
+
+func (n *Host) priorityPeerInfos() []peer.AddrInfo {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	infos := make([]peer.AddrInfo, 0, len(n.priority))
+	for _, info := range n.priority {
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,157 @@
+package p2p_test
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/p2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const otherMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func newTestHost(t *testing.T, mnemonic string, cfg *config.P2PHostConfig) *p2p.Host {
+	identity, err := p2p.NewIdentity(mnemonic)
+	require.NoError(t, err)
+
+	if cfg == nil {
+		cfg = &config.P2PHostConfig{}
+	}
+
+	// TCP only, QUIC is disabled on private networks
+	cfg.PrivateNetworkKey = strings.Repeat("cd", 32)
+	cfg.DisableDHT = true
+
+	host, err := p2p.NewHost(cfg, slog.Default(), nil, identity, big.NewInt(1))
+	require.NoError(t, err)
+	return host
+}
+
+// dialAddr is the loopback address of the host, with its peer id
+func dialAddr(t *testing.T, host *p2p.Host) multiaddr.Multiaddr {
+	for _, addr := range host.Addrs() {
+		if strings.Contains(addr.String(), "/tcp/") {
+			s := strings.Replace(addr.String(), "0.0.0.0", "127.0.0.1", 1)
+			maddr, err := multiaddr.NewMultiaddr(s + "/p2p/" + host.HostID().String())
+			require.NoError(t, err)
+			return maddr
+		}
+	}
+
+	t.Fatal("host has no tcp address")
+	return nil
+}
+
+func TestPeerManagement(t *testing.T) {
+	a := newTestHost(t, testMnemonic, nil)
+	b := newTestHost(t, otherMnemonic, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, a.Run(ctx))
+	require.NoError(t, b.Run(ctx))
+
+	received := make(chan struct{}, 1)
+	require.NoError(t, b.HandleTopic(ctx, p2p.ArchiveTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		return pubsub.ValidationAccept
+	}))
+	require.NoError(t, a.HandleTopic(ctx, p2p.ArchiveTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		return pubsub.ValidationAccept
+	}))
+
+	_, err := a.Connect(ctx, dialAddr(t, a))
+	assert.Error(t, err)
+
+	id, err := a.Connect(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+	assert.Equal(t, b.HostID(), id)
+
+	infos := a.PeerInfos()
+	require.Len(t, infos, 1)
+	assert.Equal(t, b.HostID(), infos[0].Peer)
+	assert.False(t, infos[0].Priority)
+	assert.NotEmpty(t, infos[0].Addrs)
+	assert.False(t, infos[0].ConnectedAt.IsZero())
+
+	// Gossip counters come from the pubsub tracer
+	assert.Eventually(t, func() bool {
+		_ = a.BroadcastData(ctx, p2p.ArchiveTopic, []byte(`{}`))
+		select {
+		case <-received:
+			return true
+		default:
+			return false
+		}
+	}, 10*time.Second, 200*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		infos := a.PeerInfos()
+		return len(infos) == 1 && infos[0].MessagesSent > 0 && len(infos[0].Topics) > 0 && len(infos[0].Protocols) > 0
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// Priority can be given and taken at runtime
+	id, err = a.AddPriorityPeer(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+	assert.Equal(t, []peer.ID{id}, a.PriorityPeers())
+	assert.True(t, a.PeerInfos()[0].Priority)
+
+	assert.True(t, a.RemovePriorityPeer(id))
+	assert.False(t, a.RemovePriorityPeer(id))
+	assert.Empty(t, a.PriorityPeers())
+
+	require.NoError(t, a.Disconnect(id))
+	assert.Empty(t, a.PeerInfos())
+
+	// Banned peers lose their priority and can't connect
+	_, err = a.AddPriorityPeer(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+	a.BanPeer(id, time.Minute)
+
+	assert.Eventually(t, func() bool {
+		return len(a.Peers()) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Empty(t, a.PriorityPeers())
+
+	_, err = a.Connect(ctx, dialAddr(t, b))
+	assert.Error(t, err)
+}
+
+func TestPriorityPeerAllowed(t *testing.T) {
+	a := newTestHost(t, testMnemonic, &config.P2PHostConfig{
+		AllowedPeers: []string{randomPeer(t).String()},
+	})
+	b := newTestHost(t, otherMnemonic, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, a.Run(ctx))
+	require.NoError(t, b.Run(ctx))
+
+	// Not in the allowlist
+	_, err := a.Connect(ctx, dialAddr(t, b))
+	assert.Error(t, err)
+
+	// Priority peers are allowed
+	id, err := a.AddPriorityPeer(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		peers := a.Peers()
+		return len(peers) == 1 && peers[0] == id
+	}, 5*time.Second, 50*time.Millisecond)
+}
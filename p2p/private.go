@@ -0,0 +1,110 @@
+package p2p
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/ethkit/go-ethereum/common/hexutil"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	p2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// ParsePrivateNetworkKey decodes the pre-shared key of a private
+// network, a 32 byte hex string, empty means a public network
+func ParsePrivateNetworkKey(key string) (pnet.PSK, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(key, "0x") {
+		key = "0x" + key
+	}
+
+	psk, err := hexutil.Decode(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private network key: %w", err)
+	}
+
+	if len(psk) != 32 {
+		return nil, fmt.Errorf("invalid private network key: must be 32 bytes, got %d", len(psk))
+	}
+
+	return pnet.PSK(psk), nil
+}
+
+// AllowlistGater only lets the allowed peers connect, on top of
+// what the gater it wraps refuses
+type AllowlistGater struct {
+	connmgr.ConnectionGater
+
+	lock    sync.RWMutex
+	allowed map[peer.ID]struct{}
+}
+
+var _ connmgr.ConnectionGater = &AllowlistGater{}
+
+// NewGater wraps the gater with the allowlist of the config, the boot
+// and priority nodes are always allowed, without an allowlist anyone is
+func NewGater(cfg *config.P2PHostConfig, gater connmgr.ConnectionGater) (connmgr.ConnectionGater, error) {
+	if len(cfg.AllowedPeers) == 0 {
+		return gater, nil
+	}
+
+	allowed := make(map[peer.ID]struct{}, len(cfg.AllowedPeers))
+	for _, s := range cfg.AllowedPeers {
+		id, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed peer %q: %w", s, err)
+		}
+		allowed[id] = struct{}{}
+	}
+
+	for _, addrs := range [][]multiaddr.Multiaddr{cfg.BootNodeAddrs, cfg.PriorityNodeAddrs} {
+		infos, err := AddrInfoFromP2pAddrs(addrs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			allowed[info.ID] = struct{}{}
+		}
+	}
+
+	return &AllowlistGater{
+		ConnectionGater: gater,
+		allowed:         allowed,
+	}, nil
+}
+
+func (g *AllowlistGater) IsAllowed(p peer.ID) bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	_, ok := g.allowed[p]
+	return ok
+}
+
+// Allow adds the peer to the allowlist until the node restarts
+func (g *AllowlistGater) Allow(p peer.ID) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.allowed[p] = struct{}{}
+}
+
+func (g *AllowlistGater) InterceptPeerDial(p peer.ID) bool {
+	return g.IsAllowed(p) && g.ConnectionGater.InterceptPeerDial(p)
+}
+
+func (g *AllowlistGater) InterceptAddrDial(p peer.ID, addr multiaddr.Multiaddr) bool {
+	return g.IsAllowed(p) && g.ConnectionGater.InterceptAddrDial(p, addr)
+}
+
+func (g *AllowlistGater) InterceptSecured(dir p2pnetwork.Direction, p peer.ID, addrs p2pnetwork.ConnMultiaddrs) bool {
+	return g.IsAllowed(p) && g.ConnectionGater.InterceptSecured(dir, p, addrs)
+}
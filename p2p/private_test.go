@@ -0,0 +1,105 @@
+package p2p_test
+
+import (
+	"log/slog"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/p2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMnemonic = "test test test test test test test test test test test junk"
+
+func randomPeer(t *testing.T) peer.ID {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return id
+}
+
+func TestParsePrivateNetworkKey(t *testing.T) {
+	psk, err := p2p.ParsePrivateNetworkKey("")
+	assert.NoError(t, err)
+	assert.Nil(t, psk)
+
+	key := strings.Repeat("ab", 32)
+	psk, err = p2p.ParsePrivateNetworkKey(key)
+	assert.NoError(t, err)
+	assert.Len(t, psk, 32)
+
+	psk2, err := p2p.ParsePrivateNetworkKey("0x" + key)
+	assert.NoError(t, err)
+	assert.Equal(t, psk, psk2)
+
+	_, err = p2p.ParsePrivateNetworkKey("abcd")
+	assert.Error(t, err)
+
+	_, err = p2p.ParsePrivateNetworkKey("zz")
+	assert.Error(t, err)
+}
+
+func TestAllowlistGater(t *testing.T) {
+	allowed := randomPeer(t)
+	boot := randomPeer(t)
+	stranger := randomPeer(t)
+
+	cfg := &config.P2PHostConfig{
+		AllowedPeers: []string{allowed.String()},
+		BootNodes:    []string{"/ip4/127.0.0.1/tcp/4000/p2p/" + boot.String()},
+	}
+	require.NoError(t, config.InitP2PHostConfig(cfg))
+
+	scorer := p2p.NewPeerScorer(cfg, slog.Default(), nil)
+	gater, err := p2p.NewGater(cfg, scorer)
+	require.NoError(t, err)
+
+	assert.True(t, gater.InterceptPeerDial(allowed))
+	assert.True(t, gater.InterceptSecured(0, boot, nil))
+	assert.False(t, gater.InterceptPeerDial(stranger))
+	assert.False(t, gater.InterceptSecured(0, stranger, nil))
+
+	// Peers can be allowed at runtime
+	gater.(*p2p.AllowlistGater).Allow(stranger)
+	assert.True(t, gater.InterceptPeerDial(stranger))
+
+	// Allowed peers can still be blacklisted
+	for i := 0; i < 20; i++ {
+		scorer.Report(allowed, p2p.PeerInvalidMessage)
+	}
+	assert.False(t, gater.InterceptPeerDial(allowed))
+
+	// Without an allowlist the scorer is the gater
+	gater, err = p2p.NewGater(&config.P2PHostConfig{}, scorer)
+	require.NoError(t, err)
+	assert.Equal(t, scorer, gater)
+
+	_, err = p2p.NewGater(&config.P2PHostConfig{AllowedPeers: []string{"nope"}}, scorer)
+	assert.Error(t, err)
+}
+
+func TestPrivateNetworkHost(t *testing.T) {
+	identity, err := p2p.NewIdentity(testMnemonic)
+	require.NoError(t, err)
+
+	cfg := &config.P2PHostConfig{
+		PrivateNetworkKey: strings.Repeat("ab", 32),
+		DisableDHT:        true,
+	}
+
+	host, err := p2p.NewHost(cfg, slog.Default(), nil, identity, big.NewInt(1))
+	require.NoError(t, err)
+
+	// QUIC can't be used with a pre-shared key
+	addrs := host.Addrs()
+	require.NotEmpty(t, addrs)
+	for _, addr := range addrs {
+		assert.NotContains(t, addr.String(), "quic")
+	}
+}
@@ -2,7 +2,7 @@ package p2p
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
@@ -14,13 +14,25 @@ import (
 func (n *Host) setupPubsub(ctx context.Context, chainID *big.Int) error {
 	logger := n.logger
 
+	var topics []string
+	for _, topic := range []PubsubTopic{OperationTopic, ArchiveTopic} {
+		for _, enc := range n.topicEncodings(topic) {
+			topics = append(topics, topic.Encoded(chainID, enc))
+		}
+	}
+
+	scoreParams, scoreThresholds := n.scorer.scoreParams(topics...)
+
 	psOptions := []pubsub.Option{
 		pubsub.WithMessageSignaturePolicy(pubsub.StrictSign),
-		pubsub.WithMaxMessageSize(1 << 20), // 1MB
+		pubsub.WithMaxMessageSize(maxMessageSize),
 
 		// TODO: only use pubsubtracer in debug mode
 		pubsub.WithEventTracer(&PubSubTracer{logger: logger}),
-		pubsub.WithRawTracer(newMetricsTracer(n.metrics)),
+		pubsub.WithRawTracer(newMetricsTracer(n.metrics, n.peerStats)),
+
+		pubsub.WithPeerScore(scoreParams, scoreThresholds),
+		pubsub.WithPeerScoreInspect(n.scorer.inspectGossip, 10*time.Second),
 	}
 
 	ps, err := pubsub.NewGossipSub(ctx, n.host, psOptions...)
@@ -61,17 +73,87 @@ func (n *Host) waitPubsub(ctx context.Context, topic string) error {
 	}
 }
 
+// Broadcast publishes the payload on the binary subtopic, and on the JSON
+// subtopic only when some of its peers are not on the binary one, so peers
+// that understand both encodings don't receive every message twice
 func (n *Host) Broadcast(ctx context.Context, topic PubsubTopic, data interface{}) error {
-	dataBytes, err := json.Marshal(data)
-	if err != nil {
-		return err
+	var errs []error
+	for _, enc := range n.broadcastEncodings(topic) {
+		dataBytes, err := n.encode(topic, enc, data)
+		if err != nil {
+			n.metrics.broadcastErrors.Inc()
+			n.logger.Error("while encoding pubsub message", "topic", topic, "encoding", enc, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := n.publish(ctx, topic.Encoded(n.chainID, enc), dataBytes); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	return n.BroadcastData(ctx, topic, dataBytes)
+	return errors.Join(errs...)
 }
 
+// broadcastEncodings returns the encodings a payload must be published with
+func (n *Host) broadcastEncodings(topic PubsubTopic) []Encoding {
+	var binary []Encoding
+	hasJSON := false
+	for _, enc := range n.topicEncodings(topic) {
+		if enc == EncodingJSON {
+			hasJSON = true
+		} else {
+			binary = append(binary, enc)
+		}
+	}
+
+	if !hasJSON {
+		return binary
+	}
+	if len(binary) == 0 || n.hasJSONOnlyPeers(topic, binary) {
+		return append(binary, EncodingJSON)
+	}
+
+	return binary
+}
+
+// hasJSONOnlyPeers returns true if a peer of the JSON subtopic
+// is not on any of the binary subtopics
+func (n *Host) hasJSONOnlyPeers(topic PubsubTopic, binary []Encoding) bool {
+	reg, ok := n.topics[topic.Encoded(n.chainID, EncodingJSON)]
+	if !ok {
+		return false
+	}
+
+	peers := reg.ListPeers()
+	if len(peers) == 0 {
+		return false
+	}
+
+	onBinary := make(map[peer.ID]struct{})
+	for _, enc := range binary {
+		if reg, ok := n.topics[topic.Encoded(n.chainID, enc)]; ok {
+			for _, p := range reg.ListPeers() {
+				onBinary[p] = struct{}{}
+			}
+		}
+	}
+
+	for _, p := range peers {
+		if _, ok := onBinary[p]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BroadcastData publishes a payload that is already encoded as JSON
 func (n *Host) BroadcastData(ctx context.Context, topic PubsubTopic, data []byte) error {
-	subtopic := topic.For(n.chainID)
+	return n.publish(ctx, topic.Encoded(n.chainID, EncodingJSON), data)
+}
+
+func (n *Host) publish(ctx context.Context, subtopic string, data []byte) error {
 	reg, ok := n.topics[subtopic]
 	if !ok {
 		n.metrics.broadcastErrors.Inc()
@@ -81,7 +163,7 @@ func (n *Host) BroadcastData(ctx context.Context, topic PubsubTopic, data []byte
 	err := reg.Publish(ctx, data)
 	if err != nil {
 		n.metrics.broadcastErrors.Inc()
-		n.logger.Error("while broadcasting pubsub message", "topic", topic, "err", err)
+		n.logger.Error("while broadcasting pubsub message", "topic", subtopic, "err", err)
 	}
 
 	n.metrics.broadcastSentBytes.WithLabelValues(subtopic).Observe(float64(len(data)))
@@ -89,17 +171,29 @@ func (n *Host) BroadcastData(ctx context.Context, topic PubsubTopic, data []byte
 	return err
 }
 
+// HandleTopic subscribes to the subtopic of every enabled encoding,
+// the handler always receives the payloads as JSON
 func (n *Host) HandleTopic(ctx context.Context, topic PubsubTopic, handler MsgHandler) error {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 
-	subtopic := topic.For(n.chainID)
-
-	err := n.waitPubsub(ctx, subtopic)
+	err := n.waitPubsub(ctx, string(topic))
 	if err != nil {
 		return err
 	}
 
+	for _, enc := range n.topicEncodings(topic) {
+		if err := n.handleSubtopic(ctx, topic, enc, handler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *Host) handleSubtopic(ctx context.Context, topic PubsubTopic, enc Encoding, handler MsgHandler) error {
+	subtopic := topic.Encoded(n.chainID, enc)
+
 	reg, err := n.pubsub.Join(subtopic)
 	if err != nil {
 		n.logger.Error("while creating pub sub topic", "err", err)
@@ -131,7 +225,25 @@ func (n *Host) HandleTopic(ctx context.Context, topic PubsubTopic, handler MsgHa
 		}
 
 		start := time.Now()
-		res := handler(ctx, p, msg.Data)
+
+		var res pubsub.ValidationResult
+		data, err := n.decode(topic, enc, msg.Data)
+		if err != nil {
+			n.logger.Warn("unable to decode pubsub message", "topic", subtopic, "peer", p, "err", err)
+			n.ReportPeer(p, PeerInvalidMessage)
+			res = pubsub.ValidationReject
+		} else if origin := msg.GetFrom(); !n.limiter.allow(origin, topic, enc, data, len(msg.Data), n.host.ConnManager().IsProtected(origin, "priority")) {
+			// Checked before the handler, as it may be expensive, the limit is of
+			// the peer that published the message, only blamed if it sent it to us
+			n.logger.Debug("p2p: peer exceeded the rate limit", "topic", subtopic, "peer", p, "origin", origin)
+			n.metrics.pubsubRateLimited.WithLabelValues(subtopic).Inc()
+			if origin == p {
+				n.ReportPeer(p, PeerRateLimited)
+			}
+			res = pubsub.ValidationIgnore
+		} else {
+			res = handler(ctx, p, data)
+		}
 
 		n.metrics.pubsubReceivedBytes.WithLabelValues(subtopic, fmt.Sprint(res)).Observe(float64(len(msg.Data)))
 		n.metrics.pubsubHandledTime.WithLabelValues(subtopic, fmt.Sprint(res)).Observe(time.Since(start).Seconds())
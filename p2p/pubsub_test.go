@@ -0,0 +1,96 @@
+package p2p_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/p2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const thirdMnemonic = "legal winner thank year wave sausage worth useful legal winner thank yellow"
+
+// rawCodec sends the JSON payload as is
+type rawCodec struct{}
+
+func (rawCodec) Encode(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (rawCodec) Decode(data []byte) (interface{}, error) {
+	return json.RawMessage(data), nil
+}
+
+// receiver counts the messages handled for every payload
+type receiver struct {
+	lock     sync.Mutex
+	received map[string]int
+}
+
+func (r *receiver) handle(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var payload string
+	_ = json.Unmarshal(data, &payload)
+	r.received[payload]++
+	return pubsub.ValidationAccept
+}
+
+func (r *receiver) count(payload string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.received[payload]
+}
+
+func TestBroadcastEncodings(t *testing.T) {
+	a := newTestHost(t, testMnemonic, nil)
+	b := newTestHost(t, otherMnemonic, nil)
+	c := newTestHost(t, thirdMnemonic, &config.P2PHostConfig{Encodings: []string{"json"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receivers := make([]*receiver, 3)
+	for i, host := range []*p2p.Host{a, b, c} {
+		host.RegisterCodec(p2p.ArchiveTopic, rawCodec{})
+		require.NoError(t, host.Run(ctx))
+
+		receivers[i] = &receiver{received: map[string]int{}}
+		require.NoError(t, host.HandleTopic(ctx, p2p.ArchiveTopic, receivers[i].handle))
+	}
+
+	_, err := a.Connect(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+
+	// Wait for the mesh
+	assert.Eventually(t, func() bool {
+		require.NoError(t, a.Broadcast(ctx, p2p.ArchiveTopic, "mesh"))
+		return receivers[1].count("mesh") != 0
+	}, 10*time.Second, 200*time.Millisecond)
+
+	// Both peers understand the binary encoding, it is only sent once
+	require.NoError(t, a.Broadcast(ctx, p2p.ArchiveTopic, "binary"))
+	assert.Eventually(t, func() bool {
+		return receivers[1].count("binary") != 0
+	}, 5*time.Second, 50*time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, 1, receivers[1].count("binary"))
+
+	// A peer that only understands JSON also gets it
+	_, err = a.Connect(ctx, dialAddr(t, c))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		require.NoError(t, a.Broadcast(ctx, p2p.ArchiveTopic, "json"))
+		return receivers[2].count("json") != 0
+	}, 10*time.Second, 200*time.Millisecond)
+}
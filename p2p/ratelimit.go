@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"crypto/sha256"
+	"math"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/time/rate"
+)
+
+// Default limits of a peer, operations are cheap to send but expensive
+// to validate, archives are large but only sent every few seconds
+var (
+	DefaultOperationRateLimit = config.RateLimitConfig{Ops: 20, Bytes: 512 << 10}
+	DefaultArchiveRateLimit   = config.RateLimitConfig{Ops: 2, Bytes: 2 << 20}
+)
+
+// Limiters of the peers that sent nothing for a while are
+// evicted, their buckets would be full anyway
+const maxRateLimiters = 1 << 14
+
+// Messages recently taken from the buckets, the same message
+// received with another encoding is only counted once
+const maxRateLimitedMessages = 1 << 14
+
+// The bytes bucket holds at least a message of the maximum size
+const maxMessageSize = 1 << 20 // 1MB
+
+type topicLimit struct {
+	ops, bytes                 rate.Limit
+	priorityOps, priorityBytes rate.Limit
+}
+
+type limiterKey struct {
+	peer     peer.ID
+	topic    PubsubTopic
+	priority bool
+}
+
+type messageKey struct {
+	peer  peer.ID
+	topic PubsubTopic
+	hash  [sha256.Size]byte
+}
+
+// limitedMessage is the encoding a message was first received with
+type limitedMessage struct {
+	enc     Encoding
+	allowed bool
+}
+
+type peerLimiter struct {
+	ops   *rate.Limiter
+	bytes *rate.Limiter
+}
+
+// rateLimiter keeps a token bucket for the messages and one for the
+// bytes that every peer publishes on every topic, all the encodings of a
+// topic share the same buckets
+type rateLimiter struct {
+	limits   map[PubsubTopic]topicLimit
+	limiters *lru.Cache[limiterKey, *peerLimiter]
+	messages *lru.Cache[messageKey, limitedMessage]
+}
+
+func newRateLimiter(cfg *config.P2PHostConfig) *rateLimiter {
+	// The size is constant and positive
+	limiters, _ := lru.New[limiterKey, *peerLimiter](maxRateLimiters)
+	messages, _ := lru.New[messageKey, limitedMessage](maxRateLimitedMessages)
+
+	return &rateLimiter{
+		limits: map[PubsubTopic]topicLimit{
+			OperationTopic: newTopicLimit(cfg.OperationRateLimit, DefaultOperationRateLimit),
+			ArchiveTopic:   newTopicLimit(cfg.ArchiveRateLimit, DefaultArchiveRateLimit),
+		},
+		limiters: limiters,
+		messages: messages,
+	}
+}
+
+func newTopicLimit(cfg config.RateLimitConfig, defaults config.RateLimitConfig) topicLimit {
+	limit := func(v, def float64) rate.Limit {
+		switch {
+		case v < 0:
+			return rate.Inf
+		case v == 0:
+			return rate.Limit(def)
+		default:
+			return rate.Limit(v)
+		}
+	}
+
+	l := topicLimit{
+		ops:   limit(cfg.Ops, defaults.Ops),
+		bytes: limit(cfg.Bytes, defaults.Bytes),
+	}
+
+	// Priority peers get the regular limits unless they have their own
+	l.priorityOps, l.priorityBytes = l.ops, l.bytes
+	if cfg.PriorityOps != 0 {
+		l.priorityOps = limit(cfg.PriorityOps, 0)
+	}
+	if cfg.PriorityBytes != 0 {
+		l.priorityBytes = limit(cfg.PriorityBytes, 0)
+	}
+
+	return l
+}
+
+// newLimiter allows a burst of one second worth of messages,
+// but never less than a single message
+func newLimiter(limit rate.Limit, minBurst int) *rate.Limiter {
+	if limit == rate.Inf {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	burst := max(int(math.Ceil(float64(limit))), minBurst)
+	return rate.NewLimiter(limit, burst)
+}
+
+// allow takes a message of the size from the buckets of the peer, it
+// returns false if the peer is sending faster than the limits, the decoded
+// payload identifies the message, so a copy received with another
+// encoding gets the same result without being counted again
+func (r *rateLimiter) allow(p peer.ID, topic PubsubTopic, enc Encoding, payload []byte, size int, priority bool) bool {
+	limit, ok := r.limits[topic]
+	if !ok {
+		return true
+	}
+
+	key := messageKey{peer: p, topic: topic, hash: sha256.Sum256(payload)}
+	if msg, ok := r.messages.Get(key); ok && msg.enc != enc {
+		return msg.allowed
+	}
+
+	allowed := r.take(p, topic, limit, size, priority)
+	r.messages.Add(key, limitedMessage{enc: enc, allowed: allowed})
+	return allowed
+}
+
+func (r *rateLimiter) take(p peer.ID, topic PubsubTopic, limit topicLimit, size int, priority bool) bool {
+	key := limiterKey{peer: p, topic: topic, priority: priority}
+	l, ok := r.limiters.Get(key)
+	if !ok {
+		ops, bytes := limit.ops, limit.bytes
+		if priority {
+			ops, bytes = limit.priorityOps, limit.priorityBytes
+		}
+
+		l = &peerLimiter{
+			ops:   newLimiter(ops, 1),
+			bytes: newLimiter(bytes, maxMessageSize),
+		}
+
+		// Another message of the peer may have added it first
+		if prev, ok, _ := r.limiters.PeekOrAdd(key, l); ok {
+			l = prev
+		}
+	}
+
+	// Messages over the ops limit don't take bytes from the bucket
+	if !l.ops.Allow() {
+		return false
+	}
+
+	return l.bytes.AllowN(time.Now(), size)
+}
@@ -0,0 +1,139 @@
+package p2p_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/p2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimited(host *p2p.Host, p peer.ID) uint64 {
+	for _, score := range host.PeerScores() {
+		if score.Peer == p {
+			return score.Outcomes[p2p.PeerRateLimited]
+		}
+	}
+	return 0
+}
+
+func TestTopicRateLimit(t *testing.T) {
+	a := newTestHost(t, testMnemonic, nil)
+	b := newTestHost(t, otherMnemonic, &config.P2PHostConfig{
+		OperationRateLimit: config.RateLimitConfig{
+			Ops:         1,
+			Bytes:       -1,
+			PriorityOps: -1,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, a.Run(ctx))
+	require.NoError(t, b.Run(ctx))
+
+	var handled atomic.Int64
+	require.NoError(t, b.HandleTopic(ctx, p2p.OperationTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		handled.Add(1)
+		return pubsub.ValidationAccept
+	}))
+	require.NoError(t, a.HandleTopic(ctx, p2p.OperationTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		return pubsub.ValidationAccept
+	}))
+
+	_, err := a.Connect(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+
+	// Once the mesh is up, a burst goes over the limit of one message per second
+	var sent int64
+	assert.Eventually(t, func() bool {
+		for i := 0; i < 5; i++ {
+			if a.BroadcastData(ctx, p2p.OperationTopic, []byte(time.Now().String())) == nil {
+				sent++
+			}
+		}
+		return rateLimited(b, a.HostID()) > 0
+	}, 10*time.Second, 200*time.Millisecond)
+
+	// Wait for the messages of the burst still in flight
+	var limited uint64
+	assert.Eventually(t, func() bool {
+		prev := limited
+		limited = rateLimited(b, a.HostID())
+		return limited == prev
+	}, 5*time.Second, 500*time.Millisecond)
+
+	// The handler never sees what went over the limit
+	assert.LessOrEqual(t, handled.Load()+int64(limited), sent)
+
+	// Priority peers have no limit
+	_, err = b.AddPriorityPeer(ctx, dialAddr(t, a))
+	require.NoError(t, err)
+
+	before := handled.Load()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, a.BroadcastData(ctx, p2p.OperationTopic, []byte(time.Now().String())))
+	}
+
+	assert.Eventually(t, func() bool {
+		return handled.Load() >= before+10
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, limited, rateLimited(b, a.HostID()))
+}
+
+func TestTopicRateLimitOrigin(t *testing.T) {
+	a := newTestHost(t, testMnemonic, nil)
+	b := newTestHost(t, otherMnemonic, &config.P2PHostConfig{
+		OperationRateLimit: config.RateLimitConfig{Ops: -1, Bytes: -1},
+	})
+	c := newTestHost(t, thirdMnemonic, &config.P2PHostConfig{
+		OperationRateLimit: config.RateLimitConfig{Ops: 1, Bytes: -1},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled atomic.Int64
+	for _, host := range []*p2p.Host{a, b, c} {
+		require.NoError(t, host.Run(ctx))
+	}
+	for _, host := range []*p2p.Host{a, b} {
+		require.NoError(t, host.HandleTopic(ctx, p2p.OperationTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+			return pubsub.ValidationAccept
+		}))
+	}
+	require.NoError(t, c.HandleTopic(ctx, p2p.OperationTopic, func(ctx context.Context, p peer.ID, data []byte) pubsub.ValidationResult {
+		handled.Add(1)
+		return pubsub.ValidationAccept
+	}))
+
+	// a only reaches c through b
+	_, err := a.Connect(ctx, dialAddr(t, b))
+	require.NoError(t, err)
+	_, err = b.Connect(ctx, dialAddr(t, c))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_ = a.BroadcastData(ctx, p2p.OperationTopic, []byte(time.Now().String()))
+		return handled.Load() > 0
+	}, 10*time.Second, 200*time.Millisecond)
+
+	// The burst of a is limited, even if b relays it
+	before := handled.Load()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, a.BroadcastData(ctx, p2p.OperationTopic, []byte(time.Now().String())))
+	}
+
+	time.Sleep(time.Second)
+	assert.Less(t, handled.Load()-before, int64(10))
+
+	// But b is not blamed for it
+	assert.Zero(t, rateLimited(c, b.HostID()))
+}
@@ -0,0 +1,475 @@
+package p2p
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru/v2"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/host"
+	p2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultScoreBlacklistThreshold = -100
+	DefaultScoreBlacklistDuration  = time.Hour
+
+	// Scores decay towards zero, losing a tenth every interval
+	scoreDecayInterval = time.Minute
+	scoreDecay         = 0.9
+
+	// Good behaviour can't build up a score that hides misbehaviour
+	maxPeerScore = 10
+
+	// Operations remembered to blame the peer that relayed them
+	maxTrackedOrigins = 1 << 16
+)
+
+// PeerOutcome is the outcome of something relayed by a peer
+type PeerOutcome int
+
+const (
+	// The message was valid and accepted
+	PeerValidMessage PeerOutcome = iota
+	// The message could not be decoded or is malformed
+	PeerInvalidMessage
+	// The endorser rejected the relayed operation
+	PeerInvalidOperation
+	// The relayed operation was executed but did not pay
+	PeerUnpaidOperation
+	// The endorser of the relayed operation was banned
+	PeerBannedEndorser
+	// The message exceeded the rate limit of the topic
+	PeerRateLimited
+)
+
+var outcomeWeights = map[PeerOutcome]float64{
+	PeerValidMessage:     0.1,
+	PeerInvalidMessage:   -10,
+	PeerInvalidOperation: -2,
+	PeerUnpaidOperation:  -20,
+	PeerBannedEndorser:   -5,
+	PeerRateLimited:      -1,
+}
+
+func (o PeerOutcome) String() string {
+	switch o {
+	case PeerValidMessage:
+		return "valid_message"
+	case PeerInvalidMessage:
+		return "invalid_message"
+	case PeerInvalidOperation:
+		return "invalid_operation"
+	case PeerUnpaidOperation:
+		return "unpaid_operation"
+	case PeerBannedEndorser:
+		return "banned_endorser"
+	case PeerRateLimited:
+		return "rate_limited"
+	default:
+		return "unknown"
+	}
+}
+
+type PeerScore struct {
+	Peer peer.ID
+
+	// Score given by the bundler, and the score gossipsub
+	// computes from it and its own topic parameters
+	Score       float64
+	GossipScore float64
+
+	Outcomes map[PeerOutcome]uint64
+
+	BlacklistedUntil time.Time
+}
+
+type opOrigin struct {
+	peer     peer.ID
+	endorser common.Address
+}
+
+type scorerMetrics struct {
+	outcomes         *prometheus.CounterVec
+	blacklistedPeers prometheus.Counter
+	blacklistedNow   prometheus.Gauge
+	rejectedConns    prometheus.Counter
+}
+
+func createScorerMetrics(reg prometheus.Registerer) *scorerMetrics {
+	outcomes := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "p2p_peer_outcomes",
+		Help: "Number of outcomes reported for messages relayed by peers",
+	}, []string{"outcome"})
+
+	blacklistedPeers := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "p2p_peer_blacklisted",
+		Help: "Number of peers blacklisted for their score",
+	})
+
+	blacklistedNow := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "p2p_peer_blacklisted_active",
+		Help: "Number of peers currently blacklisted",
+	})
+
+	rejectedConns := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "p2p_peer_blacklisted_rejected_conns",
+		Help: "Number of connections rejected from or to blacklisted peers",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			outcomes,
+			blacklistedPeers,
+			blacklistedNow,
+			rejectedConns,
+		)
+	}
+
+	return &scorerMetrics{
+		outcomes:         outcomes,
+		blacklistedPeers: blacklistedPeers,
+		blacklistedNow:   blacklistedNow,
+		rejectedConns:    rejectedConns,
+	}
+}
+
+type peerRecord struct {
+	score            float64
+	outcomes         map[PeerOutcome]uint64
+	blacklistedUntil time.Time
+}
+
+// PeerScorer keeps the reputation of the peers based on what they relay,
+// the score feeds the gossipsub peer score and peers that fall below
+// the threshold are disconnected and blacklisted for a while. It doubles
+// as a connection gater to keep blacklisted peers out.
+type PeerScorer struct {
+	lock sync.Mutex
+
+	logger  *slog.Logger
+	metrics *scorerMetrics
+
+	threshold float64
+	duration  time.Duration
+
+	host    host.Host
+	peers   map[peer.ID]*peerRecord
+	gossip  map[peer.ID]float64
+	origins *lru.Cache[string, opOrigin]
+}
+
+var _ connmgr.ConnectionGater = (*PeerScorer)(nil)
+
+func NewPeerScorer(cfg *config.P2PHostConfig, logger *slog.Logger, metrics prometheus.Registerer) *PeerScorer {
+	threshold := cfg.ScoreBlacklistThreshold
+	if threshold == 0 {
+		threshold = DefaultScoreBlacklistThreshold
+	}
+
+	duration := time.Duration(cfg.ScoreBlacklistSeconds) * time.Second
+	if duration == 0 {
+		duration = DefaultScoreBlacklistDuration
+	}
+
+	// The size is constant and positive
+	origins, _ := lru.New[string, opOrigin](maxTrackedOrigins)
+
+	return &PeerScorer{
+		logger:  logger,
+		metrics: createScorerMetrics(metrics),
+
+		threshold: threshold,
+		duration:  duration,
+
+		peers:   make(map[peer.ID]*peerRecord),
+		gossip:  make(map[peer.ID]float64),
+		origins: origins,
+	}
+}
+
+func (s *PeerScorer) record(p peer.ID) *peerRecord {
+	r, ok := s.peers[p]
+	if !ok {
+		r = &peerRecord{outcomes: make(map[PeerOutcome]uint64)}
+		s.peers[p] = r
+	}
+	return r
+}
+
+// Report adds the outcome of a message relayed by the peer to its score
+func (s *PeerScorer) Report(p peer.ID, outcome PeerOutcome) {
+	s.metrics.outcomes.WithLabelValues(outcome.String()).Inc()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.record(p)
+	r.outcomes[outcome]++
+	r.score = math.Min(r.score+outcomeWeights[outcome], maxPeerScore)
+
+	if r.score < s.threshold {
+		s.blacklist(p, r)
+	}
+}
+
+// TrackOperation accepts an operation relayed by the peer, and remembers
+// the peer so it can be blamed if the operation turns out to be bad later
+func (s *PeerScorer) TrackOperation(p peer.ID, oph string, endorser common.Address) {
+	s.origins.Add(oph, opOrigin{peer: p, endorser: endorser})
+	s.Report(p, PeerValidMessage)
+}
+
+// ReportOperation reports an outcome to the peer that relayed
+// the operation, operations that came from no peer are ignored
+func (s *PeerScorer) ReportOperation(oph string, outcome PeerOutcome) {
+	origin, ok := s.origins.Peek(oph)
+	if !ok {
+		return
+	}
+
+	s.Report(origin.peer, outcome)
+}
+
+// ReportBannedEndorser penalizes the peers that relayed
+// operations of the endorser, once per operation
+func (s *PeerScorer) ReportBannedEndorser(endorser common.Address) {
+	for _, oph := range s.origins.Keys() {
+		origin, ok := s.origins.Peek(oph)
+		if !ok || origin.endorser != endorser {
+			continue
+		}
+
+		s.origins.Remove(oph)
+		s.Report(origin.peer, PeerBannedEndorser)
+	}
+}
+
+// Score is the application specific score given to gossipsub
+func (s *PeerScorer) Score(p peer.ID) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if r, ok := s.peers[p]; ok {
+		return r.score
+	}
+	return 0
+}
+
+func (s *PeerScorer) Scores() []*PeerScore {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	scores := make([]*PeerScore, 0, len(s.peers))
+	for p, r := range s.peers {
+		outcomes := make(map[PeerOutcome]uint64, len(r.outcomes))
+		for o, c := range r.outcomes {
+			outcomes[o] = c
+		}
+
+		scores = append(scores, &PeerScore{
+			Peer:             p,
+			Score:            r.score,
+			GossipScore:      s.gossip[p],
+			Outcomes:         outcomes,
+			BlacklistedUntil: r.blacklistedUntil,
+		})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Score < scores[j].Score
+	})
+
+	return scores
+}
+
+func (s *PeerScorer) IsBlacklisted(p peer.ID) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.peers[p]
+	return ok && time.Now().Before(r.blacklistedUntil)
+}
+
+func (s *PeerScorer) blacklist(p peer.ID, r *peerRecord) {
+	if time.Now().Before(r.blacklistedUntil) {
+		return
+	}
+
+	// Priority peers are trusted regardless of their score
+	if s.host != nil && s.host.ConnManager().IsProtected(p, "priority") {
+		return
+	}
+
+	r.blacklistedUntil = time.Now().Add(s.duration)
+	s.logger.Warn("blacklisting peer", "peerId", p.String(), "score", r.score, "until", r.blacklistedUntil)
+
+	s.metrics.blacklistedPeers.Inc()
+	s.metrics.blacklistedNow.Inc()
+
+	if s.host != nil {
+		// Closing the connection may block, and it may call the gater
+		go s.host.Network().ClosePeer(p)
+	}
+}
+
+// Ban blacklists the peer for the duration, or for the blacklist
+// duration if it is zero, whatever its score is
+func (s *PeerScorer) Ban(p peer.ID, duration time.Duration) {
+	if duration == 0 {
+		duration = s.duration
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.record(p)
+	if r.blacklistedUntil.IsZero() {
+		s.metrics.blacklistedPeers.Inc()
+		s.metrics.blacklistedNow.Inc()
+	}
+
+	r.blacklistedUntil = time.Now().Add(duration)
+	s.logger.Warn("banning peer", "peerId", p.String(), "until", r.blacklistedUntil)
+
+	if s.host != nil {
+		// Closing the connection may block, and it may call the gater
+		go s.host.Network().ClosePeer(p)
+	}
+}
+
+// decay moves all scores towards zero and lifts the expired blacklists,
+// peers with nothing left to remember are forgotten
+func (s *PeerScorer) decay() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for p, r := range s.peers {
+		r.score *= scoreDecay
+		if math.Abs(r.score) < 0.01 {
+			r.score = 0
+		}
+
+		if !r.blacklistedUntil.IsZero() && !now.Before(r.blacklistedUntil) {
+			s.logger.Info("lifting peer blacklist", "peerId", p.String())
+			r.blacklistedUntil = time.Time{}
+			s.metrics.blacklistedNow.Dec()
+		}
+
+		if r.score == 0 && r.blacklistedUntil.IsZero() && s.host != nil && s.host.Network().Connectedness(p) != p2pnetwork.Connected {
+			delete(s.peers, p)
+			delete(s.gossip, p)
+		}
+	}
+}
+
+func (s *PeerScorer) run(ctx context.Context) {
+	ticker := time.NewTicker(scoreDecayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.decay()
+		}
+	}
+}
+
+// inspectGossip keeps the last scores computed by gossipsub
+func (s *PeerScorer) inspectGossip(scores map[peer.ID]float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.gossip = scores
+}
+
+// scoreParams builds the gossipsub score parameters, the application score
+// carries most of the weight, topics only penalize messages that fail validation
+func (s *PeerScorer) scoreParams(topics ...string) (*pubsub.PeerScoreParams, *pubsub.PeerScoreThresholds) {
+	params := &pubsub.PeerScoreParams{
+		SkipAtomicValidation: true,
+
+		Topics: make(map[string]*pubsub.TopicScoreParams, len(topics)),
+
+		AppSpecificScore:  s.Score,
+		AppSpecificWeight: 1,
+
+		BehaviourPenaltyWeight:    -1,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(10 * time.Minute),
+
+		DecayInterval: pubsub.DefaultDecayInterval,
+		DecayToZero:   pubsub.DefaultDecayToZero,
+
+		RetainScore: time.Hour,
+	}
+
+	for _, topic := range topics {
+		params.Topics[topic] = &pubsub.TopicScoreParams{
+			SkipAtomicValidation: true,
+
+			TopicWeight: 1,
+
+			// Time in mesh is not scored, but gossipsub divides by the quantum
+			TimeInMeshQuantum: time.Second,
+
+			InvalidMessageDeliveriesWeight: -10,
+			InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+		}
+	}
+
+	thresholds := &pubsub.PeerScoreThresholds{
+		SkipAtomicValidation: true,
+
+		GossipThreshold:             s.threshold / 4,
+		PublishThreshold:            s.threshold / 2,
+		GraylistThreshold:           s.threshold,
+		AcceptPXThreshold:           maxPeerScore / 2,
+		OpportunisticGraftThreshold: 1,
+	}
+
+	return params, thresholds
+}
+
+func (s *PeerScorer) gate(p peer.ID) bool {
+	if s.IsBlacklisted(p) {
+		s.metrics.rejectedConns.Inc()
+		return false
+	}
+	return true
+}
+
+func (s *PeerScorer) InterceptPeerDial(p peer.ID) bool {
+	return s.gate(p)
+}
+
+func (s *PeerScorer) InterceptAddrDial(p peer.ID, _ multiaddr.Multiaddr) bool {
+	return s.gate(p)
+}
+
+func (s *PeerScorer) InterceptAccept(p2pnetwork.ConnMultiaddrs) bool {
+	// The peer is not known until the connection is secured
+	return true
+}
+
+func (s *PeerScorer) InterceptSecured(_ p2pnetwork.Direction, p peer.ID, _ p2pnetwork.ConnMultiaddrs) bool {
+	return s.gate(p)
+}
+
+func (s *PeerScorer) InterceptUpgraded(p2pnetwork.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,74 @@
+package p2p_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/0xsequence/bundler/config"
+	"github.com/0xsequence/bundler/p2p"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerScorerBlacklist(t *testing.T) {
+	scorer := p2p.NewPeerScorer(&config.P2PHostConfig{ScoreBlacklistThreshold: -50}, slog.Default(), nil)
+
+	bad := peer.ID("bad")
+	good := peer.ID("good")
+
+	for i := 0; i < 5; i++ {
+		scorer.Report(bad, p2p.PeerInvalidMessage)
+	}
+
+	// At the threshold, not below it
+	assert.Equal(t, -50.0, scorer.Score(bad))
+	assert.False(t, scorer.IsBlacklisted(bad))
+
+	scorer.Report(bad, p2p.PeerInvalidMessage)
+	assert.True(t, scorer.IsBlacklisted(bad))
+	assert.False(t, scorer.InterceptPeerDial(bad))
+	assert.False(t, scorer.InterceptAddrDial(bad, nil))
+
+	// Good behaviour is capped
+	for i := 0; i < 500; i++ {
+		scorer.Report(good, p2p.PeerValidMessage)
+	}
+
+	assert.Equal(t, 10.0, scorer.Score(good))
+	assert.True(t, scorer.InterceptPeerDial(good))
+
+	scores := scorer.Scores()
+	assert.Len(t, scores, 2)
+	assert.Equal(t, bad, scores[0].Peer)
+	assert.Equal(t, uint64(6), scores[0].Outcomes[p2p.PeerInvalidMessage])
+	assert.False(t, scores[0].BlacklistedUntil.IsZero())
+	assert.Equal(t, good, scores[1].Peer)
+	assert.Equal(t, uint64(500), scores[1].Outcomes[p2p.PeerValidMessage])
+}
+
+func TestPeerScorerBlameRelayer(t *testing.T) {
+	scorer := p2p.NewPeerScorer(&config.P2PHostConfig{}, slog.Default(), nil)
+
+	p1 := peer.ID("p1")
+	p2 := peer.ID("p2")
+
+	e1 := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	e2 := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	scorer.TrackOperation(p1, "0x01", e1)
+	scorer.TrackOperation(p2, "0x02", e2)
+	scorer.TrackOperation(p2, "0x03", e2)
+
+	scorer.ReportOperation("0x01", p2p.PeerUnpaidOperation)
+	assert.InDelta(t, -19.9, scorer.Score(p1), 1e-9)
+
+	// Operations that were not relayed have no one to blame
+	scorer.ReportOperation("0x04", p2p.PeerUnpaidOperation)
+
+	// Once per relayed operation
+	scorer.ReportBannedEndorser(e2)
+	scorer.ReportBannedEndorser(e2)
+	assert.InDelta(t, -9.8, scorer.Score(p2), 1e-9)
+	assert.InDelta(t, -19.9, scorer.Score(p1), 1e-9)
+}
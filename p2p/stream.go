@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	p2pnetwork "github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	maxStreamMessageSize = 4 << 20 // 4MB
+	streamTimeout        = 30 * time.Second
+)
+
+// StreamHandler answers a single request sent by a peer, returning an
+// error resets the stream so the peer knows the request failed.
+type StreamHandler func(ctx context.Context, p peer.ID, req []byte) ([]byte, error)
+
+// HandleStream serves a request/response protocol, every stream carries
+// one request, closed for writing by the peer, and one response.
+func (n *Host) HandleStream(ctx context.Context, proto StreamProtocol, handler StreamHandler) error {
+	pid := proto.For(n.chainID)
+
+	n.host.SetStreamHandler(protocol.ID(pid), func(s p2pnetwork.Stream) {
+		result := "ok"
+		defer func() {
+			n.metrics.streamRequestsHandled.WithLabelValues(pid, result).Inc()
+		}()
+
+		_ = s.SetDeadline(time.Now().Add(streamTimeout))
+
+		p := s.Conn().RemotePeer()
+		req, err := readStreamMessage(s)
+		if err != nil {
+			result = "error"
+			n.logger.Debug("p2p: unable to read stream request", "protocol", pid, "peer", p, "err", err)
+			_ = s.Reset()
+			return
+		}
+
+		res, err := handler(ctx, p, req)
+		if err != nil {
+			result = "error"
+			n.logger.Debug("p2p: unable to handle stream request", "protocol", pid, "peer", p, "err", err)
+			_ = s.Reset()
+			return
+		}
+
+		if _, err := s.Write(res); err != nil {
+			result = "error"
+			_ = s.Reset()
+			return
+		}
+
+		_ = s.Close()
+	})
+
+	go func() {
+		<-ctx.Done()
+		n.host.RemoveStreamHandler(protocol.ID(pid))
+	}()
+
+	return nil
+}
+
+// Request sends a request to a peer and waits for its response
+func (n *Host) Request(ctx context.Context, p peer.ID, proto StreamProtocol, req []byte) ([]byte, error) {
+	pid := proto.For(n.chainID)
+
+	res, err := n.request(ctx, p, protocol.ID(pid), req)
+	if err != nil {
+		n.metrics.streamRequestsSent.WithLabelValues(pid, "error").Inc()
+		return nil, err
+	}
+
+	n.metrics.streamRequestsSent.WithLabelValues(pid, "ok").Inc()
+	return res, nil
+}
+
+func (n *Host) request(ctx context.Context, p peer.ID, pid protocol.ID, req []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	s, err := n.host.NewStream(ctx, p, pid)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open stream: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(deadline)
+	}
+
+	if _, err := s.Write(req); err != nil {
+		_ = s.Reset()
+		return nil, fmt.Errorf("unable to write request: %w", err)
+	}
+
+	if err := s.CloseWrite(); err != nil {
+		_ = s.Reset()
+		return nil, fmt.Errorf("unable to close request: %w", err)
+	}
+
+	res, err := readStreamMessage(s)
+	if err != nil {
+		_ = s.Reset()
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	_ = s.Close()
+	return res, nil
+}
+
+func readStreamMessage(s p2pnetwork.Stream) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(s, maxStreamMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxStreamMessageSize {
+		return nil, fmt.Errorf("message exceeds %d bytes", maxStreamMessageSize)
+	}
+
+	return data, nil
+}
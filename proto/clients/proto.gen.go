@@ -1,4 +1,4 @@
-// bundler v0.1.0 88d7501bf44d06381eefe8a39e84c5127de2bda8
+// bundler v0.1.0 4b76c5b6807279a5551a7eeaf2717be4e61eff94
 // --
 // Code generated by webrpc-gen@v0.18.6 with golang generator. DO NOT EDIT.
 //
@@ -31,7 +31,7 @@ func WebRPCSchemaVersion() string {
 
 // Schema hash generated from your RIDL schema
 func WebRPCSchemaHash() string {
-	return "88d7501bf44d06381eefe8a39e84c5127de2bda8"
+	return "4b76c5b6807279a5551a7eeaf2717be4e61eff94"
 }
 
 //
@@ -134,15 +134,81 @@ type Version struct {
 
 type Status struct {
 	// overall status, true/false
-	HealthOK      bool      `json:"healthOK"`
-	StartTime     time.Time `json:"startTime"`
-	Uptime        uint64    `json:"uptime"`
-	Ver           string    `json:"ver"`
-	Branch        string    `json:"branch"`
-	CommitHash    string    `json:"commitHash"`
-	HostID        string    `json:"hostId"`
-	HostAddrs     []string  `json:"hostAddrs"`
-	PriorityPeers []string  `json:"priorityPeers"`
+	HealthOK   bool      `json:"healthOK"`
+	StartTime  time.Time `json:"startTime"`
+	Uptime     uint64    `json:"uptime"`
+	Ver        string    `json:"ver"`
+	Branch     string    `json:"branch"`
+	CommitHash string    `json:"commitHash"`
+	HostID     string    `json:"hostId"`
+	HostAddrs  []string  `json:"hostAddrs"`
+	// addresses announced to peers, including relay addresses
+	AnnouncedAddrs []string `json:"announcedAddrs"`
+	// NAT reachability detected by AutoNAT: unknown, public or private
+	Reachability  string   `json:"reachability"`
+	PriorityPeers []string `json:"priorityPeers"`
+}
+
+type PeerScore struct {
+	PeerID string `json:"peerId"`
+	// score given by the bundler from what the peer relayed
+	Score float64 `json:"score"`
+	// score computed by gossipsub, includes the bundler score
+	GossipScore              float64    `json:"gossipScore"`
+	ValidMessages            uint64     `json:"validMessages"`
+	InvalidMessages          uint64     `json:"invalidMessages"`
+	InvalidOperations        uint64     `json:"invalidOperations"`
+	UnpaidOperations         uint64     `json:"unpaidOperations"`
+	BannedEndorserOperations uint64     `json:"bannedEndorserOperations"`
+	RateLimitedMessages      uint64     `json:"rateLimitedMessages"`
+	BlacklistedUntil         *time.Time `json:"blacklistedUntil,omitempty"`
+}
+
+type PeerInfo struct {
+	PeerID string   `json:"peerId"`
+	Addrs  []string `json:"addrs"`
+	// inbound or outbound
+	Direction   string    `json:"direction"`
+	LatencyMs   uint64    `json:"latencyMs"`
+	Protocols   []string  `json:"protocols"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	// seconds since the first open connection
+	ConnectedFor uint64 `json:"connectedFor"`
+	Priority     bool   `json:"priority"`
+	// topics where the peer is in the gossip mesh
+	Topics           []string `json:"topics"`
+	MessagesReceived uint64   `json:"messagesReceived"`
+	MessagesRejected uint64   `json:"messagesRejected"`
+	MessagesSent     uint64   `json:"messagesSent"`
+}
+
+type ArchiveEntry struct {
+	Cid        string   `json:"cid"`
+	Timestamp  uint64   `json:"timestamp"`
+	Operations []string `json:"operations"`
+	// peer id to the last archive seen from it
+	SeenArchives map[string]string `json:"seenArchives"`
+	PrevArchive  string            `json:"prevArchive"`
+}
+
+type ArchiveHistory struct {
+	// peer id that signed every archive of the chain
+	Identity string `json:"identity"`
+	// newest first
+	Archives []*ArchiveEntry `json:"archives"`
+	// operations the identity claims to have handled, sorted
+	Operations []string `json:"operations"`
+	// the chain was followed to the first archive
+	Complete bool `json:"complete"`
+}
+
+type OperationProvenance struct {
+	// peer id that signed the announcement, empty for bare operations
+	Announcer   string     `json:"announcer"`
+	AnnouncedAt *time.Time `json:"announcedAt,omitempty"`
+	// peer that relayed the operation first
+	Relayer    string    `json:"relayer"`
+	ReceivedAt time.Time `json:"receivedAt"`
 }
 
 type Operation struct {
@@ -220,6 +286,14 @@ var WebRPCServices = map[string][]string{
 		"DiscardOperations",
 		"BanEndorser",
 		"BannedEndorsers",
+		"PeerInfos",
+		"ConnectPeer",
+		"DisconnectPeer",
+		"BanPeer",
+		"AddPriorityPeer",
+		"RemovePriorityPeer",
+		"VerifyArchive",
+		"OperationProvenance",
 	},
 }
 
@@ -230,7 +304,7 @@ var WebRPCServices = map[string][]string{
 type Bundler interface {
 	Ping(ctx context.Context) (bool, error)
 	Status(ctx context.Context) (*Status, error)
-	Peers(ctx context.Context) ([]string, []string, error)
+	Peers(ctx context.Context) ([]string, []string, []*PeerScore, error)
 	Mempool(ctx context.Context) (*MempoolView, error)
 	SendOperation(ctx context.Context, operation *Operation) (string, error)
 	Operations(ctx context.Context) (*Operations, error)
@@ -244,6 +318,17 @@ type Admin interface {
 	DiscardOperations(ctx context.Context, operations []string) error
 	BanEndorser(ctx context.Context, endorser string, duration int) error
 	BannedEndorsers(ctx context.Context) ([]string, error)
+	PeerInfos(ctx context.Context) ([]*PeerInfo, error)
+	ConnectPeer(ctx context.Context, addr string) (string, error)
+	DisconnectPeer(ctx context.Context, peerId string) error
+	// duration in seconds, 0 uses the blacklist duration
+	BanPeer(ctx context.Context, peerId string, duration int) error
+	AddPriorityPeer(ctx context.Context, addr string) (string, error)
+	RemovePriorityPeer(ctx context.Context, peerId string) (bool, error)
+	// depth is the number of archives to follow, 0 or more than 100 follows 100
+	VerifyArchive(ctx context.Context, cid string, depth int) (*ArchiveHistory, error)
+	// where the operation was first seen, if it is still remembered
+	OperationProvenance(ctx context.Context, operation string) (*OperationProvenance, error)
 }
 
 //
@@ -253,7 +338,7 @@ type Admin interface {
 type BundlerClient interface {
 	Ping(ctx context.Context) (bool, error)
 	Status(ctx context.Context) (*Status, error)
-	Peers(ctx context.Context) ([]string, []string, error)
+	Peers(ctx context.Context) ([]string, []string, []*PeerScore, error)
 	Mempool(ctx context.Context) (*MempoolView, error)
 	SendOperation(ctx context.Context, operation *Operation) (string, error)
 	Operations(ctx context.Context) (*Operations, error)
@@ -267,6 +352,17 @@ type AdminClient interface {
 	DiscardOperations(ctx context.Context, operations []string) error
 	BanEndorser(ctx context.Context, endorser string, duration int) error
 	BannedEndorsers(ctx context.Context) ([]string, error)
+	PeerInfos(ctx context.Context) ([]*PeerInfo, error)
+	ConnectPeer(ctx context.Context, addr string) (string, error)
+	DisconnectPeer(ctx context.Context, peerId string) error
+	// duration in seconds, 0 uses the blacklist duration
+	BanPeer(ctx context.Context, peerId string, duration int) error
+	AddPriorityPeer(ctx context.Context, addr string) (string, error)
+	RemovePriorityPeer(ctx context.Context, peerId string) (bool, error)
+	// depth is the number of archives to follow, 0 or more than 100 follows 100
+	VerifyArchive(ctx context.Context, cid string, depth int) (*ArchiveHistory, error)
+	// where the operation was first seen, if it is still remembered
+	OperationProvenance(ctx context.Context, operation string) (*OperationProvenance, error)
 }
 
 //
@@ -330,10 +426,11 @@ func (c *bundlerClient) Status(ctx context.Context) (*Status, error) {
 	return out.Ret0, err
 }
 
-func (c *bundlerClient) Peers(ctx context.Context) ([]string, []string, error) {
+func (c *bundlerClient) Peers(ctx context.Context) ([]string, []string, []*PeerScore, error) {
 	out := struct {
-		Ret0 []string `json:"peers"`
-		Ret1 []string `json:"priorityPeers"`
+		Ret0 []string     `json:"peers"`
+		Ret1 []string     `json:"priorityPeers"`
+		Ret2 []*PeerScore `json:"scores"`
 	}{}
 
 	resp, err := doHTTPRequest(ctx, c.client, c.urls[2], nil, &out)
@@ -344,7 +441,7 @@ func (c *bundlerClient) Peers(ctx context.Context) ([]string, []string, error) {
 		}
 	}
 
-	return out.Ret0, out.Ret1, err
+	return out.Ret0, out.Ret1, out.Ret2, err
 }
 
 func (c *bundlerClient) Mempool(ctx context.Context) (*MempoolView, error) {
@@ -416,18 +513,26 @@ func (c *bundlerClient) FeeAsks(ctx context.Context) (*FeeAsks, error) {
 
 type adminClient struct {
 	client HTTPClient
-	urls   [6]string
+	urls   [14]string
 }
 
 func NewAdminClient(addr string, client HTTPClient) AdminClient {
 	prefix := urlBase(addr) + AdminPathPrefix
-	urls := [6]string{
+	urls := [14]string{
 		prefix + "SendOperation",
 		prefix + "ReserveOperations",
 		prefix + "ReleaseOperations",
 		prefix + "DiscardOperations",
 		prefix + "BanEndorser",
 		prefix + "BannedEndorsers",
+		prefix + "PeerInfos",
+		prefix + "ConnectPeer",
+		prefix + "DisconnectPeer",
+		prefix + "BanPeer",
+		prefix + "AddPriorityPeer",
+		prefix + "RemovePriorityPeer",
+		prefix + "VerifyArchive",
+		prefix + "OperationProvenance",
 	}
 	return &adminClient{
 		client: client,
@@ -542,6 +647,151 @@ func (c *adminClient) BannedEndorsers(ctx context.Context) ([]string, error) {
 	return out.Ret0, err
 }
 
+func (c *adminClient) PeerInfos(ctx context.Context) ([]*PeerInfo, error) {
+	out := struct {
+		Ret0 []*PeerInfo `json:"peers"`
+	}{}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[6], nil, &out)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return out.Ret0, err
+}
+
+func (c *adminClient) ConnectPeer(ctx context.Context, addr string) (string, error) {
+	in := struct {
+		Arg0 string `json:"addr"`
+	}{addr}
+	out := struct {
+		Ret0 string `json:"peerId"`
+	}{}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[7], in, &out)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return out.Ret0, err
+}
+
+func (c *adminClient) DisconnectPeer(ctx context.Context, peerId string) error {
+	in := struct {
+		Arg0 string `json:"peerId"`
+	}{peerId}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[8], in, nil)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return err
+}
+
+func (c *adminClient) BanPeer(ctx context.Context, peerId string, duration int) error {
+	in := struct {
+		Arg0 string `json:"peerId"`
+		Arg1 int    `json:"duration"`
+	}{peerId, duration}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[9], in, nil)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return err
+}
+
+func (c *adminClient) AddPriorityPeer(ctx context.Context, addr string) (string, error) {
+	in := struct {
+		Arg0 string `json:"addr"`
+	}{addr}
+	out := struct {
+		Ret0 string `json:"peerId"`
+	}{}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[10], in, &out)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return out.Ret0, err
+}
+
+func (c *adminClient) RemovePriorityPeer(ctx context.Context, peerId string) (bool, error) {
+	in := struct {
+		Arg0 string `json:"peerId"`
+	}{peerId}
+	out := struct {
+		Ret0 bool `json:"removed"`
+	}{}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[11], in, &out)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return out.Ret0, err
+}
+
+func (c *adminClient) VerifyArchive(ctx context.Context, cid string, depth int) (*ArchiveHistory, error) {
+	in := struct {
+		Arg0 string `json:"cid"`
+		Arg1 int    `json:"depth"`
+	}{cid, depth}
+	out := struct {
+		Ret0 *ArchiveHistory `json:"history"`
+	}{}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[12], in, &out)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return out.Ret0, err
+}
+
+func (c *adminClient) OperationProvenance(ctx context.Context, operation string) (*OperationProvenance, error) {
+	in := struct {
+		Arg0 string `json:"operation"`
+	}{operation}
+	out := struct {
+		Ret0 *OperationProvenance `json:"provenance"`
+	}{}
+
+	resp, err := doHTTPRequest(ctx, c.client, c.urls[13], in, &out)
+	if resp != nil {
+		cerr := resp.Body.Close()
+		if err == nil && cerr != nil {
+			err = ErrWebrpcRequestFailed.WithCause(fmt.Errorf("failed to close response body: %w", cerr))
+		}
+	}
+
+	return out.Ret0, err
+}
+
 // HTTPClient is the interface used by generated clients to send HTTP requests.
 // It is fulfilled by *(net/http).Client, which is sufficient for most users.
 // Users can provide their own implementation for special retry policies.
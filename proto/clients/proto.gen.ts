@@ -1,5 +1,5 @@
 /* eslint-disable */
-// bundler v0.1.0 88d7501bf44d06381eefe8a39e84c5127de2bda8
+// bundler v0.1.0 4b76c5b6807279a5551a7eeaf2717be4e61eff94
 // --
 // Code generated by webrpc-gen@v0.18.6 with typescript generator. DO NOT EDIT.
 //
@@ -12,7 +12,7 @@ export const WebRPCVersion = "v1"
 export const WebRPCSchemaVersion = "v0.1.0"
 
 // Schema hash generated from your RIDL schema
-export const WebRPCSchemaHash = "88d7501bf44d06381eefe8a39e84c5127de2bda8"
+export const WebRPCSchemaHash = "4b76c5b6807279a5551a7eeaf2717be4e61eff94"
 
 //
 // Types
@@ -46,9 +46,61 @@ export interface Status {
   commitHash: string
   hostId: string
   hostAddrs: Array<string>
+  announcedAddrs: Array<string>
+  reachability: string
   priorityPeers: Array<string>
 }
 
+export interface PeerScore {
+  peerId: string
+  score: number
+  gossipScore: number
+  validMessages: number
+  invalidMessages: number
+  invalidOperations: number
+  unpaidOperations: number
+  bannedEndorserOperations: number
+  rateLimitedMessages: number
+  blacklistedUntil?: string
+}
+
+export interface PeerInfo {
+  peerId: string
+  addrs: Array<string>
+  direction: string
+  latencyMs: number
+  protocols: Array<string>
+  connectedAt: string
+  connectedFor: number
+  priority: boolean
+  topics: Array<string>
+  messagesReceived: number
+  messagesRejected: number
+  messagesSent: number
+}
+
+export interface ArchiveEntry {
+  cid: string
+  timestamp: number
+  operations: Array<string>
+  seenArchives: {[key: string]: string}
+  prevArchive: string
+}
+
+export interface ArchiveHistory {
+  identity: string
+  archives: Array<ArchiveEntry>
+  operations: Array<string>
+  complete: boolean
+}
+
+export interface OperationProvenance {
+  announcer: string
+  announcedAt?: string
+  relayer: string
+  receivedAt: string
+}
+
 export interface Operation {
   entrypoint: string
   data: string
@@ -118,7 +170,8 @@ export interface PeersArgs {
 
 export interface PeersReturn {
   peers: Array<string>
-  priorityPeers: Array<string>  
+  priorityPeers: Array<string>
+  scores: Array<PeerScore>  
 }
 export interface MempoolArgs {
 }
@@ -153,6 +206,14 @@ export interface Admin {
   discardOperations(args: DiscardOperationsArgs, headers?: object, signal?: AbortSignal): Promise<DiscardOperationsReturn>
   banEndorser(args: BanEndorserArgs, headers?: object, signal?: AbortSignal): Promise<BanEndorserReturn>
   bannedEndorsers(headers?: object, signal?: AbortSignal): Promise<BannedEndorsersReturn>
+  peerInfos(headers?: object, signal?: AbortSignal): Promise<PeerInfosReturn>
+  connectPeer(args: ConnectPeerArgs, headers?: object, signal?: AbortSignal): Promise<ConnectPeerReturn>
+  disconnectPeer(args: DisconnectPeerArgs, headers?: object, signal?: AbortSignal): Promise<DisconnectPeerReturn>
+  banPeer(args: BanPeerArgs, headers?: object, signal?: AbortSignal): Promise<BanPeerReturn>
+  addPriorityPeer(args: AddPriorityPeerArgs, headers?: object, signal?: AbortSignal): Promise<AddPriorityPeerReturn>
+  removePriorityPeer(args: RemovePriorityPeerArgs, headers?: object, signal?: AbortSignal): Promise<RemovePriorityPeerReturn>
+  verifyArchive(args: VerifyArchiveArgs, headers?: object, signal?: AbortSignal): Promise<VerifyArchiveReturn>
+  operationProvenance(args: OperationProvenanceArgs, headers?: object, signal?: AbortSignal): Promise<OperationProvenanceReturn>
 }
 
 export interface SendOperationArgs {
@@ -198,6 +259,61 @@ export interface BannedEndorsersArgs {
 export interface BannedEndorsersReturn {
   endorser: Array<string>  
 }
+export interface PeerInfosArgs {
+}
+
+export interface PeerInfosReturn {
+  peers: Array<PeerInfo>  
+}
+export interface ConnectPeerArgs {
+  addr: string
+}
+
+export interface ConnectPeerReturn {
+  peerId: string  
+}
+export interface DisconnectPeerArgs {
+  peerId: string
+}
+
+export interface DisconnectPeerReturn {  
+}
+export interface BanPeerArgs {
+  peerId: string
+  duration: number
+}
+
+export interface BanPeerReturn {  
+}
+export interface AddPriorityPeerArgs {
+  addr: string
+}
+
+export interface AddPriorityPeerReturn {
+  peerId: string  
+}
+export interface RemovePriorityPeerArgs {
+  peerId: string
+}
+
+export interface RemovePriorityPeerReturn {
+  removed: boolean  
+}
+export interface VerifyArchiveArgs {
+  cid: string
+  depth: number
+}
+
+export interface VerifyArchiveReturn {
+  history: ArchiveHistory  
+}
+export interface OperationProvenanceArgs {
+  operation: string
+}
+
+export interface OperationProvenanceReturn {
+  provenance: OperationProvenance  
+}
 
 
   
@@ -257,6 +373,7 @@ export class Bundler implements Bundler {
         return {
           peers: <Array<string>>(_data.peers),
           priorityPeers: <Array<string>>(_data.priorityPeers),
+          scores: <Array<PeerScore>>(_data.scores),
         }
       })
     }, (error) => {
@@ -417,6 +534,115 @@ export class Admin implements Admin {
     })
   }
   
+  peerInfos = (headers?: object, signal?: AbortSignal): Promise<PeerInfosReturn> => {
+    return this.fetch(
+      this.url('PeerInfos'),
+      createHTTPRequest({}, headers, signal)
+      ).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {
+          peers: <Array<PeerInfo>>(_data.peers),
+        }
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  connectPeer = (args: ConnectPeerArgs, headers?: object, signal?: AbortSignal): Promise<ConnectPeerReturn> => {
+    return this.fetch(
+      this.url('ConnectPeer'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {
+          peerId: <string>(_data.peerId),
+        }
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  disconnectPeer = (args: DisconnectPeerArgs, headers?: object, signal?: AbortSignal): Promise<DisconnectPeerReturn> => {
+    return this.fetch(
+      this.url('DisconnectPeer'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {}
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  banPeer = (args: BanPeerArgs, headers?: object, signal?: AbortSignal): Promise<BanPeerReturn> => {
+    return this.fetch(
+      this.url('BanPeer'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {}
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  addPriorityPeer = (args: AddPriorityPeerArgs, headers?: object, signal?: AbortSignal): Promise<AddPriorityPeerReturn> => {
+    return this.fetch(
+      this.url('AddPriorityPeer'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {
+          peerId: <string>(_data.peerId),
+        }
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  removePriorityPeer = (args: RemovePriorityPeerArgs, headers?: object, signal?: AbortSignal): Promise<RemovePriorityPeerReturn> => {
+    return this.fetch(
+      this.url('RemovePriorityPeer'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {
+          removed: <boolean>(_data.removed),
+        }
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  verifyArchive = (args: VerifyArchiveArgs, headers?: object, signal?: AbortSignal): Promise<VerifyArchiveReturn> => {
+    return this.fetch(
+      this.url('VerifyArchive'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {
+          history: <ArchiveHistory>(_data.history),
+        }
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
+  operationProvenance = (args: OperationProvenanceArgs, headers?: object, signal?: AbortSignal): Promise<OperationProvenanceReturn> => {
+    return this.fetch(
+      this.url('OperationProvenance'),
+      createHTTPRequest(args, headers, signal)).then((res) => {
+      return buildResponse(res).then(_data => {
+        return {
+          provenance: <OperationProvenance>(_data.provenance),
+        }
+      })
+    }, (error) => {
+      throw WebrpcRequestFailedError.new({ cause: `fetch(): ${error.message || ''}` })
+    })
+  }
+  
 }
 
   const createHTTPRequest = (body: object = {}, headers: object = {}, signal: AbortSignal | null = null): object => {
@@ -2,6 +2,7 @@ package bundler
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -9,14 +10,18 @@ import (
 	"github.com/0xsequence/bundler/endorser"
 	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/mempool/partitioner"
 	"github.com/0xsequence/bundler/proto"
+	"github.com/0xsequence/ethkit/ethrpc"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
 	"github.com/go-chi/httplog/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const PrunerBatchSize = 10
 const PrunerWorkers = 3
+const PrunerMaxBackoff = 5 * time.Minute
 
 type prunerMetrics struct {
 	pruneBannedEmpty prometheus.Counter
@@ -29,12 +34,22 @@ type prunerMetrics struct {
 	pruneStaleEmpty    prometheus.Counter
 	pruneStaleTime     prometheus.Histogram
 	pruneStaleReleased prometheus.Counter
-	pruneStaleDropped  prometheus.Counter
+	pruneStaleDropped  *prometheus.CounterVec
 	pruneStaleNoop     prometheus.Counter
 	pruneStaleFailed   *prometheus.CounterVec
+	pruneStaleRetried  *prometheus.CounterVec
+	pruneExpired       *prometheus.CounterVec
+
+	pruneBlockTime        prometheus.Histogram
+	pruneBlockKeys        prometheus.Gauge
+	pruneBlockChangedKeys prometheus.Counter
+	pruneBlockScheduled   prometheus.Counter
+	pruneBlockFailed      prometheus.Counter
 
 	failedPruneDependencyState prometheus.Labels
 	failedPruneHasChanged      prometheus.Labels
+	failedPruneReadyProvider   prometheus.Labels
+	failedPruneConstraints     prometheus.Labels
 }
 
 func createPrunerMetrics(reg prometheus.Registerer) *prunerMetrics {
@@ -60,16 +75,52 @@ func createPrunerMetrics(reg prometheus.Registerer) *prunerMetrics {
 		Help: "Number of stale operations released",
 	})
 
-	pruneStaleDropped := prometheus.NewCounter(prometheus.CounterOpts{
+	pruneStaleDropped := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "pruner_stale_dropped_sum",
 		Help: "Number of stale operations dropped",
-	})
+	}, []string{"kind"})
 
 	pruneStaleFailed := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "pruner_stale_failed_sum",
 		Help: "Number of failed stale operations",
 	}, []string{"reason"})
 
+	pruneStaleRetried := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pruner_stale_retried_sum",
+		Help: "Number of failed stale operations kept for a retry",
+	}, []string{"reason"})
+
+	pruneExpired := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pruner_expired_sum",
+		Help: "Number of expired operations dropped",
+	}, []string{"reason"})
+
+	pruneBlockTime := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pruner_block_time",
+		Help:    "Time taken to read the dependencies of a new block",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	pruneBlockKeys := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pruner_block_keys",
+		Help: "Number of dependency keys read on the last block",
+	})
+
+	pruneBlockChangedKeys := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pruner_block_changed_keys_sum",
+		Help: "Number of dependency keys that changed between blocks",
+	})
+
+	pruneBlockScheduled := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pruner_block_scheduled_sum",
+		Help: "Number of operations scheduled for a check after a new block",
+	})
+
+	pruneBlockFailed := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pruner_block_failed_sum",
+		Help: "Number of failed block scans",
+	})
+
 	pruneBannedEmpty := prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "pruner_banned_empty",
 		Help: "Number of empty banned runs",
@@ -104,6 +155,14 @@ func createPrunerMetrics(reg prometheus.Registerer) *prunerMetrics {
 		"reason": "has_changed",
 	}
 
+	failedPruneReadyProvider := prometheus.Labels{
+		"reason": "ready_provider",
+	}
+
+	failedPruneConstraints := prometheus.Labels{
+		"reason": "constraints",
+	}
+
 	if reg != nil {
 		reg.MustRegister(
 			pruneBannedTime,
@@ -112,6 +171,13 @@ func createPrunerMetrics(reg prometheus.Registerer) *prunerMetrics {
 			pruneStaleReleased,
 			pruneStaleDropped,
 			pruneStaleFailed,
+			pruneStaleRetried,
+			pruneExpired,
+			pruneBlockTime,
+			pruneBlockKeys,
+			pruneBlockChangedKeys,
+			pruneBlockScheduled,
+			pruneBlockFailed,
 			pruneBannedEmpty,
 			pruneStaleEmpty,
 			pruneStaleNoop,
@@ -131,9 +197,18 @@ func createPrunerMetrics(reg prometheus.Registerer) *prunerMetrics {
 		pruneStaleReleased:         pruneStaleReleased,
 		pruneStaleDropped:          pruneStaleDropped,
 		pruneStaleFailed:           pruneStaleFailed,
+		pruneStaleRetried:          pruneStaleRetried,
+		pruneExpired:               pruneExpired,
+		pruneBlockTime:             pruneBlockTime,
+		pruneBlockKeys:             pruneBlockKeys,
+		pruneBlockChangedKeys:      pruneBlockChangedKeys,
+		pruneBlockScheduled:        pruneBlockScheduled,
+		pruneBlockFailed:           pruneBlockFailed,
 		pruneStaleNoop:             pruneStaleNoop,
 		failedPruneDependencyState: failedPruneDependencyState,
 		failedPruneHasChanged:      failedPruneHasChanged,
+		failedPruneReadyProvider:   failedPruneReadyProvider,
+		failedPruneConstraints:     failedPruneConstraints,
 	}
 }
 
@@ -141,18 +216,30 @@ type Pruner struct {
 	NoStalePruning  bool
 	NoBannedPruning bool
 
+	// Indexed operations are only checked when their
+	// dependencies change, instead of periodically
+	BlockPruning bool
+
 	GracePeriod time.Duration
 	RunWait     time.Duration
 
+	// Endorser failures allowed before discarding an operation,
+	// provider failures only delay the next check until the
+	// retries of the operation reach MaxRetries
+	MaxFailures    int
+	MaxRetries     int
+	FailureBackoff time.Duration
+
 	logger  *httplog.Logger
 	metrics *prunerMetrics
 
 	Mempool  mempool.Interface
 	Endorser endorser.Interface
 	Registry registry.Interface
+	Provider ethrpc.Interface
 }
 
-func NewPruner(cfg config.PrunerConfig, logger *httplog.Logger, metrics prometheus.Registerer, mempool mempool.Interface, endorser endorser.Interface, registry registry.Interface) *Pruner {
+func NewPruner(cfg config.PrunerConfig, logger *httplog.Logger, metrics prometheus.Registerer, mempool mempool.Interface, endorser endorser.Interface, registry registry.Interface, provider ethrpc.Interface) *Pruner {
 	var gracePeriod time.Duration
 	if cfg.GracePeriodSeconds == 0 {
 		gracePeriod = 5 * time.Second
@@ -167,24 +254,50 @@ func NewPruner(cfg config.PrunerConfig, logger *httplog.Logger, metrics promethe
 		runWait = time.Duration(cfg.RunWaitMillis) * time.Millisecond
 	}
 
+	maxFailures := cfg.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = 3
+	}
+
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 20
+	}
+
+	var failureBackoff time.Duration
+	if cfg.FailureBackoffMillis == 0 {
+		failureBackoff = 1 * time.Second
+	} else {
+		failureBackoff = time.Duration(cfg.FailureBackoffMillis) * time.Millisecond
+	}
+
 	if logger != nil {
 		logger.Info("pruner: grace period", "seconds", gracePeriod.Seconds())
 		logger.Info("pruner: run wait", "milliseconds", runWait.Milliseconds())
+		logger.Info("pruner: max failures", "failures", maxFailures, "retries", maxRetries, "backoff", failureBackoff)
+		logger.Info("pruner: block pruning", "enabled", !cfg.NoBlockPruning && provider != nil)
 	}
 
 	return &Pruner{
 		NoStalePruning:  cfg.NoStalePruning,
 		NoBannedPruning: cfg.NoBannedPruning,
 
+		BlockPruning: !cfg.NoBlockPruning && provider != nil,
+
 		GracePeriod: gracePeriod,
 		RunWait:     runWait,
 
+		MaxFailures:    maxFailures,
+		MaxRetries:     maxRetries,
+		FailureBackoff: failureBackoff,
+
 		logger:  logger,
 		metrics: createPrunerMetrics(metrics),
 
 		Mempool:  mempool,
 		Endorser: endorser,
 		Registry: registry,
+		Provider: provider,
 	}
 }
 
@@ -205,6 +318,14 @@ func (s *Pruner) Run(ctx context.Context) {
 		go func() {
 			s.staleFetcher(ctx, jobsChan)
 		}()
+
+		if s.BlockPruning {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.blockPruner(ctx, jobsChan)
+			}()
+		}
 	}
 
 	if !s.NoBannedPruning {
@@ -275,9 +396,17 @@ func (s *Pruner) staleFetcher(ctx context.Context, jobsChan chan *mempool.Tracke
 		ops := s.Mempool.ReserveOps(ctx, func(to []*mempool.TrackedOperation) []*mempool.TrackedOperation {
 			// Pick one operation above the grace period
 			// start from the oldest part (the upper indexes)
+			// expired operations are picked regardless of the grace period
+			now := time.Now()
 			picked := make([]*mempool.TrackedOperation, 0, PrunerBatchSize)
 			for i := len(to) - 1; i >= 0; i-- {
-				if time.Since(to[i].ReadyAt) > s.GracePeriod {
+				// Indexed operations are left to the block pruner,
+				// unless they are waiting for a retry
+				if s.BlockPruning && !partitioner.IsWildcard(to[i].EndorserResult) && to[i].Failures == 0 && to[i].Expired(now, nil) == mempool.ExpiryNone {
+					continue
+				}
+
+				if now.Sub(to[i].ReadyAt) > s.GracePeriod || to[i].Expired(now, nil) != mempool.ExpiryNone {
 					picked = append(picked, to[i])
 					if len(picked) >= PrunerBatchSize {
 						break
@@ -318,6 +447,14 @@ func (s *Pruner) doStaleJob(ctx context.Context, op *mempool.TrackedOperation) {
 		s.metrics.pruneStaleTime.Observe(time.Since(start).Seconds())
 	}()
 
+	// Expired operations are dropped without re-evaluating them
+	if reason := s.expired(ctx, op); reason != mempool.ExpiryNone {
+		s.metrics.pruneExpired.WithLabelValues(string(reason)).Inc()
+		s.logger.Info("pruner: discarding expired operation", "op", op.Hash(), "reason", reason)
+		s.Mempool.DiscardOps(ctx, []string{op.Hash()})
+		return
+	}
+
 	// Report how long has the operation been without being re-evaluated
 	if op.ReadyAt.IsZero() {
 		s.metrics.pruneStaleAgeInf.Inc()
@@ -326,29 +463,39 @@ func (s *Pruner) doStaleJob(ctx context.Context, op *mempool.TrackedOperation) {
 	}
 
 	needsReevaluation := true
+	var nextState *endorser.EndorserResultState
 	if !op.EndorserResult.WildcardOnly {
-		nextState, err := s.Endorser.DependencyState(ctx, op.EndorserResult)
+		var err error
+		nextState, err = s.Endorser.DependencyState(ctx, op.EndorserResult)
 		if err != nil {
+			// Reading the state only fails because of the provider,
+			// the operation may still be valid
 			s.metrics.pruneStaleFailed.With(s.metrics.failedPruneDependencyState).Inc()
-			s.logger.Error("pruner: error getting state", "error", err)
-			// TODO: Handle error operations, ideally
-			// we only allow an operation to fail a few times
-			s.Mempool.DiscardOps(ctx, []string{op.Hash()})
+			s.logger.Error("pruner: error getting state", "op", op.Hash(), "error", err)
+			s.failStaleJob(ctx, op, s.metrics.failedPruneDependencyState, false)
 			return
 		}
 
 		needsReevaluation, err = op.EndorserResult.HasChanged(op.EndorserResultState, nextState)
 		if err != nil {
 			s.metrics.pruneStaleFailed.With(s.metrics.failedPruneHasChanged).Inc()
-			s.logger.Error("pruner: error comparing state", "error", err)
-			// TODO: Handle error operations, ideally
-			// we only allow an operation to fail a few times
-			s.Mempool.DiscardOps(ctx, []string{op.Hash()})
+			s.logger.Error("pruner: error comparing state", "op", op.Hash(), "error", err)
+			s.failStaleJob(ctx, op, s.metrics.failedPruneHasChanged, true)
 			return
 		}
+
+		// The endorser cache can reuse the state that was just read
+		ctx = endorser.WithDependencyState(ctx, op.EndorserResult, nextState)
 	}
 
 	if !needsReevaluation {
+		// The constrained slots are not part of the dependency state,
+		// they may have changed without the result being affected,
+		// they were read along with it
+		if !s.constraintsMet(ctx, op, op.EndorserResult, nextState) {
+			return
+		}
+
 		// Release the operation
 		s.metrics.pruneStaleNoop.Inc()
 		s.Mempool.ReleaseOps(ctx, []string{op.Hash()}, proto.ReadyAtChange_Now)
@@ -357,14 +504,102 @@ func (s *Pruner) doStaleJob(ctx context.Context, op *mempool.TrackedOperation) {
 
 	// We need to re-validate the operation
 	res, err := s.Endorser.IsOperationReady(ctx, &op.Operation)
-	if err != nil || !res.Readiness {
-		s.metrics.pruneStaleDropped.Inc()
-		// NOTICE This may not be an error, some endorsers revert instead of returning false
+	if errors.Is(err, endorser.ErrProvider) {
+		s.metrics.pruneStaleFailed.With(s.metrics.failedPruneReadyProvider).Inc()
+		s.logger.Error("pruner: error re-evaluating operation", "op", op.Hash(), "error", err)
+		s.failStaleJob(ctx, op, s.metrics.failedPruneReadyProvider, false)
+		return
+	}
+
+	if err == nil && !res.Readiness {
+		err = endorser.ErrNotReady
+	}
+
+	if err != nil {
+		s.metrics.pruneStaleDropped.WithLabelValues(endorser.ErrorKind(err)).Inc()
 		s.Mempool.DiscardOps(ctx, []string{op.Hash()})
 		return
 	}
 
+	if !s.constraintsMet(ctx, op, res, nil) {
+		return
+	}
+
 	s.metrics.pruneStaleReleased.Inc()
 	s.Mempool.ReleaseOps(ctx, []string{op.Hash()}, proto.ReadyAtChange_Now)
+}
+
+// constraintsMet checks the constraints of the result, on the given state
+// if it was already read, the operation is discarded if they no longer
+// hold, or retried if they can't be checked
+func (s *Pruner) constraintsMet(ctx context.Context, op *mempool.TrackedOperation, res *endorser.EndorserResult, state *endorser.EndorserResultState) bool {
+	if !res.HasConstraints() {
+		return true
+	}
+
+	var ok bool
+	var err error
+	if state != nil {
+		ok, err = res.ConstraintsMet(state)
+	} else {
+		ok, err = s.Endorser.ConstraintsMet(ctx, res)
+	}
+
+	if err != nil {
+		s.metrics.pruneStaleFailed.With(s.metrics.failedPruneConstraints).Inc()
+		s.logger.Error("pruner: error checking constraints", "op", op.Hash(), "error", err)
+		s.failStaleJob(ctx, op, s.metrics.failedPruneConstraints, false)
+		return false
+	}
+
+	if !ok {
+		s.metrics.pruneStaleDropped.WithLabelValues("constraints").Inc()
+		s.Mempool.DiscardOps(ctx, []string{op.Hash()})
+		return false
+	}
+
+	return true
+}
+
+// failStaleJob releases the operation for a later retry, the delay grows
+// exponentially with each consecutive failure, the operation is discarded
+// once the endorser failures or the total retries reach their limit
+func (s *Pruner) failStaleJob(ctx context.Context, op *mempool.TrackedOperation, reason prometheus.Labels, endorserFailure bool) {
+	if endorserFailure && op.EndorserFailures+1 >= s.MaxFailures {
+		s.logger.Info("pruner: discarding failing operation", "op", op.Hash(), "failures", op.EndorserFailures+1)
+		s.Mempool.DiscardOps(ctx, []string{op.Hash()})
+		return
+	}
+
+	if op.Failures+1 >= s.MaxRetries {
+		s.logger.Info("pruner: discarding operation after too many retries", "op", op.Hash(), "retries", op.Failures+1)
+		s.Mempool.DiscardOps(ctx, []string{op.Hash()})
+		return
+	}
+
+	delay := s.FailureBackoff
+	for i := 0; i < op.Failures && delay < PrunerMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > PrunerMaxBackoff {
+		delay = PrunerMaxBackoff
+	}
+
+	s.metrics.pruneStaleRetried.With(reason).Inc()
+	s.Mempool.FailOps(ctx, []string{op.Hash()}, delay, endorserFailure)
+}
+
+func (s *Pruner) expired(ctx context.Context, op *mempool.TrackedOperation) mempool.ExpiryReason {
+	// The head is only needed for block number windows
+	var head *ethtypes.Header
+	if op.HasBlockNumberWindow() && s.Provider != nil {
+		h, err := s.Provider.HeaderByNumber(ctx, nil)
+		if err != nil {
+			s.logger.Warn("pruner: unable to fetch head block, skipping block number window", "op", op.Hash(), "error", err)
+		} else {
+			head = h
+		}
+	}
 
+	return op.Expired(time.Now(), head)
 }
@@ -0,0 +1,259 @@
+package bundler
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/0xsequence/bundler/endorser"
+	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/mempool/partitioner"
+	"github.com/0xsequence/ethkit/go-ethereum/common"
+)
+
+// blockState is the last known value of every dependency key
+// indexed by the partitioner, and the operations indexed by them.
+type blockState struct {
+	number  *big.Int
+	values  map[string]string
+	indexed map[string]struct{}
+	pending map[string]struct{}
+}
+
+// blockPruner watches the head of the chain, on every new block it reads
+// only the state that the indexed operations depend on, and schedules
+// the operations whose dependencies changed (or that are new) for a check.
+func (s *Pruner) blockPruner(ctx context.Context, jobsChan chan *mempool.TrackedOperation) {
+	state := &blockState{
+		values:  map[string]string{},
+		indexed: map[string]struct{}{},
+		pending: map[string]struct{}{},
+	}
+
+	for ctx.Err() == nil {
+		head, err := s.Provider.HeaderByNumber(ctx, nil)
+		if err != nil {
+			s.metrics.pruneBlockFailed.Inc()
+			s.logger.Warn("pruner: unable to fetch head block", "error", err)
+		} else if state.number == nil || head.Number.Cmp(state.number) > 0 {
+			if err := s.scanBlock(ctx, state); err != nil {
+				s.metrics.pruneBlockFailed.Inc()
+				s.logger.Warn("pruner: unable to scan block", "block", head.Number, "error", err)
+			} else {
+				state.number = head.Number
+			}
+		}
+
+		// Operations that are reserved by someone else
+		// stay pending until they are released
+		s.reservePending(ctx, state, jobsChan)
+
+		select {
+		case <-time.After(s.RunWait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Pruner) scanBlock(ctx context.Context, state *blockState) error {
+	start := time.Now()
+
+	keys := s.Mempool.DependencyKeys()
+	s.metrics.pruneBlockKeys.Set(float64(len(keys)))
+
+	values := map[string]string{}
+	if len(keys) != 0 {
+		result, slotIndex := resultOfKeys(keys)
+		res, err := s.Endorser.DependencyState(ctx, result)
+		if err != nil {
+			return err
+		}
+
+		values = keyValues(keys, slotIndex, res)
+	}
+
+	ids := make([]string, 0, len(keys))
+	changed := make([]string, 0)
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+
+		// Unknown values are always considered changed
+		value, ok := values[k.ID]
+		prev, known := state.values[k.ID]
+		if !ok || (known && prev != value) {
+			changed = append(changed, k.ID)
+		}
+	}
+
+	state.values = values
+	s.metrics.pruneBlockChangedKeys.Add(float64(len(changed)))
+
+	for _, oph := range s.Mempool.OpsByDependencies(changed) {
+		state.pending[oph] = struct{}{}
+	}
+
+	// New operations may have been evaluated on a
+	// state older than the one we have just read
+	indexed := make(map[string]struct{}, len(state.indexed))
+	for _, oph := range s.Mempool.OpsByDependencies(ids) {
+		indexed[oph] = struct{}{}
+		if _, ok := state.indexed[oph]; !ok {
+			state.pending[oph] = struct{}{}
+		}
+	}
+
+	// Forget the operations that are no longer in the mempool
+	for oph := range state.pending {
+		if _, ok := indexed[oph]; !ok {
+			delete(state.pending, oph)
+		}
+	}
+
+	state.indexed = indexed
+
+	s.metrics.pruneBlockTime.Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (s *Pruner) reservePending(ctx context.Context, state *blockState, jobsChan chan *mempool.TrackedOperation) {
+	if len(state.pending) == 0 {
+		return
+	}
+
+	ops := s.Mempool.ReserveOps(ctx, func(to []*mempool.TrackedOperation) []*mempool.TrackedOperation {
+		var picked []*mempool.TrackedOperation
+		for _, op := range to {
+			if _, ok := state.pending[op.Hash()]; ok {
+				picked = append(picked, op)
+			}
+		}
+
+		return picked
+	})
+
+	s.metrics.pruneBlockScheduled.Add(float64(len(ops)))
+
+	for _, op := range ops {
+		delete(state.pending, op.Hash())
+		jobsChan <- op
+	}
+}
+
+// resultOfKeys builds a single endorser result that depends on all the
+// keys, so the state can be read using the endorser, the slot index maps
+// every slot key to its position on the dependency state
+func resultOfKeys(keys []*partitioner.DependencyKey) (*endorser.EndorserResult, map[string]int) {
+	result := &endorser.EndorserResult{}
+	slotIndex := make(map[string]int)
+
+	for _, k := range keys {
+		switch k.Kind {
+		case partitioner.KeySlot, partitioner.KeyConstraint:
+			dep := result.UseDependency(k.Addr)
+			slotIndex[k.ID] = len(dep.Slots)
+			dep.Slots = append(dep.Slots, k.Slot)
+		case partitioner.KeyBalance:
+			result.UseDependency(k.Addr).Balance = true
+		case partitioner.KeyCode:
+			result.UseDependency(k.Addr).Code = true
+		case partitioner.KeyNonce:
+			result.UseDependency(k.Addr).Nonce = true
+		case partitioner.KeyGlobal:
+			gd := result.UseGlobalDependency()
+			switch k.Global {
+			case partitioner.GlobalBaseFee:
+				gd.BaseFee = true
+			case partitioner.GlobalBlobBaseFee:
+				gd.BlobBaseFee = true
+			case partitioner.GlobalChainId:
+				gd.ChainId = true
+			case partitioner.GlobalCoinBase:
+				gd.CoinBase = true
+			case partitioner.GlobalDifficulty:
+				gd.Difficulty = true
+			case partitioner.GlobalGasLimit:
+				gd.GasLimit = true
+			case partitioner.GlobalNumber:
+				gd.Number = true
+			case partitioner.GlobalTimestamp:
+				gd.Timestamp = true
+			case partitioner.GlobalTxOrigin:
+				gd.TxOrigin = true
+			case partitioner.GlobalTxGasPrice:
+				gd.TxGasPrice = true
+			}
+		}
+	}
+
+	return result, slotIndex
+}
+
+// keyValues extracts the value of every key from the dependency state,
+// keys without a known value are left out
+func keyValues(keys []*partitioner.DependencyKey, slotIndex map[string]int, state *endorser.EndorserResultState) map[string]string {
+	values := make(map[string]string, len(keys))
+
+	bigValue := func(id string, v *big.Int) {
+		if v != nil {
+			values[id] = v.String()
+		}
+	}
+
+	for _, k := range keys {
+		if k.Kind == partitioner.KeyGlobal {
+			gd := state.GlobalDependency
+			if gd == nil {
+				continue
+			}
+
+			switch k.Global {
+			case partitioner.GlobalBaseFee:
+				bigValue(k.ID, gd.Basefee)
+			case partitioner.GlobalBlobBaseFee:
+				bigValue(k.ID, gd.Blobbasefee)
+			case partitioner.GlobalChainId:
+				bigValue(k.ID, gd.Chainid)
+			case partitioner.GlobalCoinBase:
+				values[k.ID] = gd.Coinbase.Hex()
+			case partitioner.GlobalDifficulty:
+				bigValue(k.ID, gd.Difficulty)
+			case partitioner.GlobalGasLimit:
+				bigValue(k.ID, gd.GasLimit)
+			case partitioner.GlobalNumber:
+				bigValue(k.ID, gd.Number)
+			case partitioner.GlobalTimestamp:
+				bigValue(k.ID, gd.Timestamp)
+			case partitioner.GlobalTxOrigin:
+				values[k.ID] = gd.TxOrigin.Hex()
+			case partitioner.GlobalTxGasPrice:
+				bigValue(k.ID, gd.TxGasPrice)
+			}
+			continue
+		}
+
+		ad := state.AddrDependencies[k.Addr]
+		if ad == nil {
+			continue
+		}
+
+		switch k.Kind {
+		case partitioner.KeySlot, partitioner.KeyConstraint:
+			if i, ok := slotIndex[k.ID]; ok && i < len(ad.Slots) {
+				values[k.ID] = common.Bytes2Hex(ad.Slots[i][:])
+			}
+		case partitioner.KeyBalance:
+			bigValue(k.ID, ad.Balance)
+		case partitioner.KeyCode:
+			if ad.Code != nil {
+				values[k.ID] = big.NewInt(int64(*ad.Code)).String()
+			}
+		case partitioner.KeyNonce:
+			if ad.Nonce != nil {
+				values[k.ID] = new(big.Int).SetUint64(*ad.Nonce).String()
+			}
+		}
+	}
+
+	return values
+}
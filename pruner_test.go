@@ -12,10 +12,14 @@ import (
 	"github.com/0xsequence/bundler/contracts/gen/solabis/abiendorser"
 	"github.com/0xsequence/bundler/endorser"
 	"github.com/0xsequence/bundler/lib/mocks"
+	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/mempool/partitioner"
 	"github.com/0xsequence/bundler/proto"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
+	ethtypes "github.com/0xsequence/ethkit/go-ethereum/core/types"
 	"github.com/go-chi/httplog/v2"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -34,7 +38,7 @@ func TestIdlePull(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, nil, nil, mockMempool, nil, mockRegistry)
+	}, nil, nil, mockMempool, nil, mockRegistry, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
 
@@ -47,14 +51,62 @@ func TestIdlePull(t *testing.T) {
 	cancel()
 }
 
-func TestPullAndDiscardStateErr(t *testing.T) {
+func TestPullAndRetryStateErr(t *testing.T) {
 	mockMempool := &mocks.MockMempool{}
 	mockEndorser := &mocks.MockEndorser{}
 	mockRegistry := &mocks.MockRegistry{}
 	logger := httplog.NewLogger("")
 
+	// Provider failures don't count as endorser failures,
+	// but the retries are delayed exponentially
+	op1 := &mempool.TrackedOperation{
+		EndorserResult:   &endorser.EndorserResult{},
+		Failures:         2,
+		EndorserFailures: 5,
+	}
+
+	done := make(chan bool)
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{op1},
+	).Once()
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	mockMempool.On("FailOps", mock.Anything, []string{op1.Hash()}, 4*time.Second, false).Run(func(mock.Arguments) {
+		done <- true
+	}).Return().Once()
+
+	mockEndorser.On("DependencyState", mock.Anything, op1.EndorserResult).Return(
+		nil, fmt.Errorf("error"),
+	).Once()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+
+	mockMempool.AssertNotCalled(t, "DiscardOps", mock.Anything, mock.Anything)
+}
+
+func TestPullAndDiscardRetriesExhausted(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+	logger := httplog.NewLogger("")
+
+	// The last retry allowed
 	op1 := &mempool.TrackedOperation{
 		EndorserResult: &endorser.EndorserResult{},
+		Failures:       4,
 	}
 
 	done := make(chan bool)
@@ -67,7 +119,7 @@ func TestPullAndDiscardStateErr(t *testing.T) {
 		[]*mempool.TrackedOperation{},
 	).Maybe()
 
-	mockMempool.On("DiscardOps", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+	mockMempool.On("DiscardOps", mock.Anything, []string{op1.Hash()}).Run(func(mock.Arguments) {
 		done <- true
 	}).Return().Once()
 
@@ -78,7 +130,67 @@ func TestPullAndDiscardStateErr(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, logger, nil, mockMempool, mockEndorser, mockRegistry)
+		MaxRetries:      5,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+
+	mockMempool.AssertNotCalled(t, "FailOps", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func hasChangedErrOp(endorserFailures int) *mempool.TrackedOperation {
+	// The state does not match the dependencies of the result
+	return &mempool.TrackedOperation{
+		EndorserResult: &endorser.EndorserResult{
+			Dependencies: []abiendorser.IEndorserDependency{
+				{
+					Addr:    common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd"),
+					Balance: true,
+				},
+			},
+		},
+		EndorserResultState: &endorser.EndorserResultState{
+			AddrDependencies: make(map[common.Address]*endorser.AddrDependencyState),
+		},
+		EndorserFailures: endorserFailures,
+	}
+}
+
+func TestPullAndRetryHasChangedErr(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	logger := httplog.NewLogger("")
+
+	op1 := hasChangedErrOp(0)
+
+	done := make(chan bool)
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{op1},
+	).Once()
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	mockMempool.On("FailOps", mock.Anything, []string{op1.Hash()}, time.Second, true).Run(func(mock.Arguments) {
+		done <- true
+	}).Return().Once()
+
+	mockEndorser.On("DependencyState", mock.Anything, op1.EndorserResult).Return(
+		op1.EndorserResultState, nil,
+	).Once()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
@@ -94,16 +206,8 @@ func TestPullAndDiscardHasChangedErr(t *testing.T) {
 
 	logger := httplog.NewLogger("")
 
-	er1 := &endorser.EndorserResult{
-		Dependencies: []abiendorser.IEndorserDependency{},
-	}
-	er2 := &endorser.EndorserResultState{
-		AddrDependencies: make(map[common.Address]*endorser.AddrDependencyState),
-	}
-	op1 := &mempool.TrackedOperation{
-		EndorserResult:      er1,
-		EndorserResultState: er2,
-	}
+	// The last failure allowed
+	op1 := hasChangedErrOp(2)
 
 	done := make(chan bool)
 
@@ -123,13 +227,14 @@ func TestPullAndDiscardHasChangedErr(t *testing.T) {
 	}).Return().Once()
 
 	mockEndorser.On("DependencyState", mock.Anything, op1.EndorserResult).Return(
-		nil, fmt.Errorf("error"),
+		op1.EndorserResultState, nil,
 	).Once()
 
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, logger, nil, mockMempool, mockEndorser, mockRegistry)
+		MaxFailures:     3,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
@@ -185,7 +290,7 @@ func TestPullAndReleaseNotChanged(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, logger, nil, mockMempool, mockEndorser, mockRegistry)
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
@@ -265,7 +370,7 @@ func TestDiscardNotReady(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, logger, nil, mockMempool, mockEndorser, mockRegistry)
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
@@ -349,7 +454,7 @@ func TestKeepReady(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, logger, nil, mockMempool, mockEndorser, mockRegistry)
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
@@ -366,7 +471,7 @@ func TestSkipRecentOps(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, nil, nil, mockMempool, nil, mockRegistry)
+	}, nil, nil, mockMempool, nil, mockRegistry, nil)
 
 	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
 		clb := args.Get(1).(func([]*mempool.TrackedOperation) []*mempool.TrackedOperation)
@@ -432,11 +537,338 @@ func TestRevalidateIfWildcardOnly(t *testing.T) {
 	pruner := bundler.NewPruner(config.PrunerConfig{
 		RunWaitMillis:   1,
 		NoBannedPruning: true,
-	}, logger, nil, mockMempool, mockEndorser, mockRegistry)
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+}
+
+func TestDiscardExpired(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+	logger := httplog.NewLogger("")
+
+	expiresAt := time.Now().Add(-time.Second)
+	op1 := &mempool.TrackedOperation{
+		EndorserResult: &endorser.EndorserResult{},
+		ExpiresAt:      &expiresAt,
+		ExpiryReason:   mempool.ExpiryMaxAge,
+	}
+
+	done := make(chan bool)
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{op1},
+	).Once()
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	mockMempool.On("DiscardOps", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		arg := args.Get(1).([]string)
+		if arg[0] == op1.Hash() {
+			done <- true
+		}
+	}).Return().Once()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go pruner.Run(ctx)
 
 	<-done
 	cancel()
+
+	// The endorser should not be called for expired operations
+	mockEndorser.AssertNotCalled(t, "DependencyState", mock.Anything, mock.Anything)
+}
+
+func TestDiscardPastMaxBlockTimestamp(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+	logger := httplog.NewLogger("")
+
+	op1 := &mempool.TrackedOperation{
+		EndorserResult: &endorser.EndorserResult{
+			GlobalDependency: abiendorser.IEndorserGlobalDependency{
+				Timestamp:         true,
+				MaxBlockTimestamp: big.NewInt(time.Now().Add(-time.Minute).Unix()),
+			},
+		},
+	}
+
+	done := make(chan bool)
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{op1},
+	).Once()
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	mockMempool.On("DiscardOps", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		arg := args.Get(1).([]string)
+		if arg[0] == op1.Hash() {
+			done <- true
+		}
+	}).Return().Once()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+}
+
+func TestPickExpiredRecentOps(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockRegistry := &mocks.MockRegistry{}
+
+	done := make(chan bool)
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, nil, nil, mockMempool, nil, mockRegistry, nil)
+
+	expiresAt := time.Now().Add(-time.Second)
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		clb := args.Get(1).(func([]*mempool.TrackedOperation) []*mempool.TrackedOperation)
+		res := clb([]*mempool.TrackedOperation{
+			{
+				ReadyAt:      time.Now(),
+				ExpiresAt:    &expiresAt,
+				ExpiryReason: mempool.ExpiryMaxAge,
+			},
+		})
+		if len(res) == 1 {
+			done <- true
+		}
+	}).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+}
+
+// reservingMempool picks the operations using the select function,
+// like the real mempool, and reports every non-empty reservation
+type reservingMempool struct {
+	*mocks.MockMempool
+	ops      []*mempool.TrackedOperation
+	reserved chan []string
+}
+
+func (m *reservingMempool) ReserveOps(ctx context.Context, selectFn func([]*mempool.TrackedOperation) []*mempool.TrackedOperation) []*mempool.TrackedOperation {
+	picked := selectFn(m.ops)
+	if len(picked) != 0 {
+		hashes := make([]string, len(picked))
+		for i, op := range picked {
+			hashes[i] = op.Hash()
+		}
+		m.reserved <- hashes
+	}
+	return picked
+}
+
+func TestBlockPruneChangedDependencies(t *testing.T) {
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+	mockProvider := &mocks.MockRPCProvider{}
+	logger := httplog.NewLogger("")
+
+	addr1 := common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd")
+	addr2 := common.HexToAddress("0x2e417D097fF04E4F532A7856a1b4c62a34988E16")
+
+	op1 := &mempool.TrackedOperation{
+		Operation: types.Operation{IEndorserOperation: abiendorser.IEndorserOperation{Data: []byte{1}}},
+		ReadyAt:   time.Now(),
+		EndorserResult: &endorser.EndorserResult{
+			Dependencies: []abiendorser.IEndorserDependency{{Addr: addr1, Slots: [][32]byte{{1}}}},
+		},
+	}
+
+	op2 := &mempool.TrackedOperation{
+		Operation: types.Operation{IEndorserOperation: abiendorser.IEndorserOperation{Data: []byte{2}}},
+		ReadyAt:   time.Now(),
+		EndorserResult: &endorser.EndorserResult{
+			Dependencies: []abiendorser.IEndorserDependency{{Addr: addr2, Balance: true}},
+		},
+	}
+
+	mp := &reservingMempool{
+		MockMempool: &mocks.MockMempool{},
+		ops:         []*mempool.TrackedOperation{op1, op2},
+		reserved:    make(chan []string, 10),
+	}
+
+	mp.On("DependencyKeys").Return([]*partitioner.DependencyKey{
+		{ID: "slot", Kind: partitioner.KeySlot, Addr: addr1, Slot: [32]byte{1}},
+		{ID: "balance", Kind: partitioner.KeyBalance, Addr: addr2},
+	})
+	mp.On("OpsByDependencies", []string{}).Return([]string{})
+	mp.On("OpsByDependencies", []string{"balance"}).Return([]string{op2.Hash()})
+	mp.On("OpsByDependencies", []string{"slot", "balance"}).Return([]string{op1.Hash(), op2.Hash()})
+	mp.On("FailOps", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+
+	mockProvider.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&ethtypes.Header{Number: big.NewInt(1)}, nil).Once()
+	mockProvider.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&ethtypes.Header{Number: big.NewInt(2)}, nil)
+
+	state := func(balance int64) *endorser.EndorserResultState {
+		return &endorser.EndorserResultState{
+			AddrDependencies: map[common.Address]*endorser.AddrDependencyState{
+				addr1: {Slots: [][32]byte{{7}}},
+				addr2: {Balance: big.NewInt(balance)},
+			},
+		}
+	}
+
+	isScan := mock.MatchedBy(func(r *endorser.EndorserResult) bool { return len(r.Dependencies) == 2 })
+	isOp := mock.MatchedBy(func(r *endorser.EndorserResult) bool { return len(r.Dependencies) == 1 })
+	mockEndorser.On("DependencyState", mock.Anything, isScan).Return(state(5), nil).Once()
+	mockEndorser.On("DependencyState", mock.Anything, isScan).Return(state(6), nil)
+	mockEndorser.On("DependencyState", mock.Anything, isOp).Return(nil, fmt.Errorf("state error")).Maybe()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mp, mockEndorser, mockRegistry, mockProvider)
+	assert.True(t, pruner.BlockPruning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	// All operations are new on the first block
+	assert.ElementsMatch(t, []string{op1.Hash(), op2.Hash()}, <-mp.reserved)
+
+	// Only the balance changed on the second block
+	assert.Equal(t, []string{op2.Hash()}, <-mp.reserved)
+
+	cancel()
+}
+
+func TestPullAndRetryReadyProviderErr(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+	logger := httplog.NewLogger("")
+
+	op1 := &mempool.TrackedOperation{
+		EndorserResult: &endorser.EndorserResult{
+			WildcardOnly: true,
+		},
+	}
+
+	done := make(chan bool)
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{op1},
+	).Once()
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	mockMempool.On("FailOps", mock.Anything, []string{op1.Hash()}, time.Second, false).Run(func(mock.Arguments) {
+		done <- true
+	}).Return().Once()
+
+	mockEndorser.On("IsOperationReady", mock.Anything, &op1.Operation).Return(
+		nil, &endorser.ProviderError{Err: fmt.Errorf("timeout")},
+	).Once()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+
+	mockMempool.AssertNotCalled(t, "DiscardOps", mock.Anything, mock.Anything)
+}
+
+func TestDiscardConstraintsNotMet(t *testing.T) {
+	mockMempool := &mocks.MockMempool{}
+	mockEndorser := &mocks.MockEndorser{}
+	mockRegistry := &mocks.MockRegistry{}
+	logger := httplog.NewLogger("")
+
+	// The dependencies are unchanged, but the constrained slot is not
+	addr := common.HexToAddress("0x3B377376F325AbA4a5f2E5E3d143FD8cd15afCEd")
+	er1 := &endorser.EndorserResult{
+		Dependencies: []abiendorser.IEndorserDependency{
+			{
+				Addr: addr,
+				Constraints: []abiendorser.IEndorserConstraint{
+					{Slot: [32]byte{1}, MaxValue: [32]byte{31: 10}},
+				},
+			},
+		},
+	}
+	er2 := &endorser.EndorserResultState{
+		AddrDependencies: map[common.Address]*endorser.AddrDependencyState{
+			addr: {},
+		},
+	}
+	op1 := &mempool.TrackedOperation{
+		EndorserResult:      er1,
+		EndorserResultState: er2,
+	}
+
+	done := make(chan bool)
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{op1},
+	).Once()
+
+	mockMempool.On("ReserveOps", mock.Anything, mock.Anything).Return(
+		[]*mempool.TrackedOperation{},
+	).Maybe()
+
+	// The constrained slot is read along with the dependency state
+	mockEndorser.On("DependencyState", mock.Anything, er1).Return(&endorser.EndorserResultState{
+		AddrDependencies: map[common.Address]*endorser.AddrDependencyState{
+			addr: {Constraints: map[[32]byte][32]byte{{1}: {31: 11}}},
+		},
+	}, nil).Once()
+
+	mockMempool.On("DiscardOps", mock.Anything, []string{op1.Hash()}).Run(func(mock.Arguments) {
+		done <- true
+	}).Return().Once()
+
+	pruner := bundler.NewPruner(config.PrunerConfig{
+		RunWaitMillis:   1,
+		NoBannedPruning: true,
+	}, logger, nil, mockMempool, mockEndorser, mockRegistry, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go pruner.Run(ctx)
+
+	<-done
+	cancel()
+
+	mockMempool.AssertNotCalled(t, "ReleaseOps", mock.Anything, mock.Anything, mock.Anything)
+	mockEndorser.AssertNotCalled(t, "ConstraintsMet", mock.Anything, mock.Anything)
 }
@@ -5,29 +5,40 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/0xsequence/bundler"
 	"github.com/0xsequence/bundler/ipfs"
 	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/p2p"
 	"github.com/0xsequence/bundler/proto"
 	"github.com/0xsequence/ethkit/go-ethereum/common"
 	"github.com/go-chi/httplog/v2"
 )
 
+// Most archives VerifyArchive follows, every one is fetched from IPFS
+const MaxVerifyArchiveDepth = 100
+
 type Admin struct {
 	logger *httplog.Logger
 
 	IPFS     ipfs.Interface
 	Mempool  mempool.Interface
 	Registry registry.Interface
+	Host     *p2p.Host
+	Archives *bundler.ArchiveReader
+	Ingress  *bundler.Ingress
 }
 
-func NewAdmin(logger *httplog.Logger, ipfs ipfs.Interface, mempool mempool.Interface, registry registry.Interface) *Admin {
+func NewAdmin(logger *httplog.Logger, ipfs ipfs.Interface, mempool mempool.Interface, registry registry.Interface, host *p2p.Host, ingress *bundler.Ingress) *Admin {
 	return &Admin{
 		logger:   logger,
 		IPFS:     ipfs,
 		Mempool:  mempool,
 		Registry: registry,
+		Host:     host,
+		Archives: bundler.NewArchiveReader(ipfs),
+		Ingress:  ingress,
 	}
 }
 
@@ -130,4 +141,26 @@ func (a Admin) SendOperation(ctx context.Context, pop *proto.Operation, ignorePa
 	return op.Hash(), nil
 }
 
+func (a Admin) VerifyArchive(ctx context.Context, cid string, depth int) (*proto.ArchiveHistory, error) {
+	if depth == 0 || depth > MaxVerifyArchiveDepth {
+		depth = MaxVerifyArchiveDepth
+	}
+
+	history, err := a.Archives.History(ctx, cid, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return history.ToProto(), nil
+}
+
+func (a Admin) OperationProvenance(ctx context.Context, operation string) (*proto.OperationProvenance, error) {
+	provenance, ok := a.Ingress.Provenance(operation)
+	if !ok {
+		return nil, proto.ErrNotFound
+	}
+
+	return provenance.ToProto(), nil
+}
+
 var _ proto.Admin = Admin{}
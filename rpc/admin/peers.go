@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/0xsequence/bundler/proto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+func (a Admin) PeerInfos(ctx context.Context) ([]*proto.PeerInfo, error) {
+	infos := a.Host.PeerInfos()
+
+	peers := make([]*proto.PeerInfo, len(infos))
+	for i, info := range infos {
+		addrs := make([]string, len(info.Addrs))
+		for j, addr := range info.Addrs {
+			addrs[j] = addr.String()
+		}
+
+		peers[i] = &proto.PeerInfo{
+			PeerID:           info.Peer.String(),
+			Addrs:            addrs,
+			Direction:        strings.ToLower(info.Direction.String()),
+			LatencyMs:        uint64(info.Latency.Milliseconds()),
+			Protocols:        info.Protocols,
+			ConnectedAt:      info.ConnectedAt,
+			ConnectedFor:     uint64(time.Since(info.ConnectedAt).Seconds()),
+			Priority:         info.Priority,
+			Topics:           info.Topics,
+			MessagesReceived: info.MessagesReceived,
+			MessagesRejected: info.MessagesRejected,
+			MessagesSent:     info.MessagesSent,
+		}
+	}
+
+	return peers, nil
+}
+
+func (a Admin) ConnectPeer(ctx context.Context, addr string) (string, error) {
+	maddr, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer address")
+	}
+
+	p, err := a.Host.Connect(ctx, maddr)
+	if err != nil {
+		return "", err
+	}
+
+	return p.String(), nil
+}
+
+func (a Admin) DisconnectPeer(ctx context.Context, peerId string) error {
+	p, err := peer.Decode(peerId)
+	if err != nil {
+		return fmt.Errorf("invalid peer id")
+	}
+
+	return a.Host.Disconnect(p)
+}
+
+func (a Admin) BanPeer(ctx context.Context, peerId string, duration int) error {
+	p, err := peer.Decode(peerId)
+	if err != nil {
+		return fmt.Errorf("invalid peer id")
+	}
+
+	if duration < 0 {
+		return fmt.Errorf("invalid duration")
+	}
+
+	a.Host.BanPeer(p, time.Duration(duration)*time.Second)
+	return nil
+}
+
+func (a Admin) AddPriorityPeer(ctx context.Context, addr string) (string, error) {
+	maddr, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer address")
+	}
+
+	p, err := a.Host.AddPriorityPeer(ctx, maddr)
+	if err != nil {
+		return "", err
+	}
+
+	return p.String(), nil
+}
+
+func (a Admin) RemovePriorityPeer(ctx context.Context, peerId string) (bool, error) {
+	p, err := peer.Decode(peerId)
+	if err != nil {
+		return false, fmt.Errorf("invalid peer id")
+	}
+
+	return a.Host.RemovePriorityPeer(p), nil
+}
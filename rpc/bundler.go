@@ -25,7 +25,17 @@ func (s *RPC) SendOperation(ctx context.Context, pop *proto.Operation) (string,
 	}
 
 	// If the operation is fine, broadcast it to the network
-	s.Host.Broadcast(ctx, p2p.OperationTopic, op.ToProtoPure())
+	var payload interface{} = op.ToProtoPure()
+	if s.Config.P2PHostConfig.SignedAnnouncements {
+		announcement, err := types.NewAnnouncement(op, s.Host.HostID().String(), s.Host.Sign)
+		if err != nil {
+			s.Log.Warn("rpc: unable to sign announcement, sending bare operation", "op", op.Hash(), "error", err)
+		} else {
+			payload = announcement
+		}
+	}
+
+	s.Host.Broadcast(ctx, p2p.OperationTopic, payload)
 
 	return op.Hash(), nil
 }
@@ -59,6 +59,7 @@ func NewRPC(
 	host *p2p.Host,
 	mempool mempool.Interface,
 	archive *bundler.Archive,
+	ingress *bundler.Ingress,
 	provider *ethrpc.Provider,
 	collector *collector.Collector,
 	endorser endorser.Interface,
@@ -86,10 +87,10 @@ func NewRPC(
 	}
 
 	factory := sender.NewMnemonicWalletFactory(provider, cfg.Mnemonic)
-	sender := sender.NewSender(&cfg.SendersConfig, logger, factory, provider, mempool, endorser, simulator, collector, registry)
+	sender := sender.NewSender(&cfg.SendersConfig, logger, factory, provider, mempool, endorser, simulator, collector, registry, host)
 	sender.SetRegisterer(metrics)
 
-	admin := admin.NewAdmin(logger, ipfs, mempool, registry)
+	admin := admin.NewAdmin(logger, ipfs, mempool, registry, host, ingress)
 
 	s := &RPC{
 		archive:   archive,
@@ -3,9 +3,11 @@ package rpc
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/0xsequence/bundler"
+	"github.com/0xsequence/bundler/p2p"
 	"github.com/0xsequence/bundler/proto"
 )
 
@@ -27,6 +29,12 @@ func (s *RPC) Status(ctx context.Context) (*proto.Status, error) {
 		hostAddrs[i] = addrs[i].String()
 	}
 
+	announced := s.Host.AnnouncedAddrs()
+	announcedAddrs := make([]string, len(announced))
+	for i := range announced {
+		announcedAddrs[i] = announced[i].String()
+	}
+
 	priorityPeers := s.Host.PriorityPeers()
 	statusPeers := make([]string, len(priorityPeers))
 	for i := range priorityPeers {
@@ -41,14 +49,16 @@ func (s *RPC) Status(ctx context.Context) (*proto.Status, error) {
 		Branch:     bundler.GITBRANCH,
 		CommitHash: bundler.GITCOMMIT,
 
-		HostID:        hostID,
-		HostAddrs:     hostAddrs,
-		PriorityPeers: statusPeers,
+		HostID:         hostID,
+		HostAddrs:      hostAddrs,
+		AnnouncedAddrs: announcedAddrs,
+		Reachability:   strings.ToLower(s.Host.Reachability().String()),
+		PriorityPeers:  statusPeers,
 	}
 	return status, nil
 }
 
-func (s *RPC) Peers(ctx context.Context) ([]string, []string, error) {
+func (s *RPC) Peers(ctx context.Context) ([]string, []string, []*proto.PeerScore, error) {
 	peers := s.Host.Peers()
 	statusPeers := make([]string, len(peers))
 	for i := range peers {
@@ -61,7 +71,28 @@ func (s *RPC) Peers(ctx context.Context) ([]string, []string, error) {
 		statusPriorityPeers[i] = priorityPeers[i].String()
 	}
 
-	return statusPeers, statusPriorityPeers, nil
+	scores := s.Host.PeerScores()
+	statusScores := make([]*proto.PeerScore, len(scores))
+	for i, score := range scores {
+		statusScores[i] = &proto.PeerScore{
+			PeerID:                   score.Peer.String(),
+			Score:                    score.Score,
+			GossipScore:              score.GossipScore,
+			ValidMessages:            score.Outcomes[p2p.PeerValidMessage],
+			InvalidMessages:          score.Outcomes[p2p.PeerInvalidMessage],
+			InvalidOperations:        score.Outcomes[p2p.PeerInvalidOperation],
+			UnpaidOperations:         score.Outcomes[p2p.PeerUnpaidOperation],
+			BannedEndorserOperations: score.Outcomes[p2p.PeerBannedEndorser],
+			RateLimitedMessages:      score.Outcomes[p2p.PeerRateLimited],
+		}
+
+		if !score.BlacklistedUntil.IsZero() {
+			until := score.BlacklistedUntil
+			statusScores[i].BlacklistedUntil = &until
+		}
+	}
+
+	return statusPeers, statusPriorityPeers, statusScores, nil
 }
 
 func (s *RPC) statusPage(w http.ResponseWriter, r *http.Request) {
@@ -74,16 +105,17 @@ func (s *RPC) statusPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *RPC) peersPage(w http.ResponseWriter, r *http.Request) {
-	peers, priorityPeers, err := s.Peers(r.Context())
+	peers, priorityPeers, scores, err := s.Peers(r.Context())
 	if err != nil {
 		s.renderJSON(w, r, err.Error(), 500)
 		return
 	}
 
 	result := struct {
-		Peers         []string `json:"peers"`
-		PriorityPeers []string `json:"priorityPeers"`
-	}{peers, priorityPeers}
+		Peers         []string           `json:"peers"`
+		PriorityPeers []string           `json:"priorityPeers"`
+		Scores        []*proto.PeerScore `json:"scores"`
+	}{peers, priorityPeers, scores}
 
 	s.renderJSON(w, r, result, 200)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/lib/utils"
 	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/p2p"
 	"github.com/0xsequence/bundler/sender/chiller"
 	"github.com/0xsequence/bundler/sender/worker"
 	"github.com/go-chi/httplog/v2"
@@ -30,6 +31,7 @@ type Sender struct {
 	Collector collector.Interface
 	Registry  registry.Interface
 	Mempool   mempool.Interface
+	Host      p2p.Interface
 }
 
 var _ Interface = &Sender{}
@@ -44,6 +46,7 @@ func NewSender(
 	simulator interfaces.Validator,
 	collector collector.Interface,
 	registry registry.Interface,
+	host p2p.Interface,
 ) *Sender {
 	var chillWait time.Duration
 	if cfg.ChillWait > 0 {
@@ -99,6 +102,7 @@ func NewSender(
 		Collector: collector,
 		Registry:  registry,
 		Mempool:   mempool,
+		Host:      host,
 	}
 }
 
@@ -236,6 +240,10 @@ func (s *Sender) handlerWorker(ctx context.Context) {
 		case op := <-release:
 			s.Mempool.ReleaseOps(ctx, []string{op.Oph}, op.Change)
 		case ban := <-ban:
+			// Blame the peer that relayed the operation
+			if ban.Op != "" {
+				s.Host.ReportOperation(ban.Op, p2p.PeerUnpaidOperation)
+			}
 			s.Registry.BanEndorser(ban.Endorser, ban.Type)
 		}
 	}
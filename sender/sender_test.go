@@ -17,6 +17,7 @@ import (
 	"github.com/0xsequence/bundler/lib/registry"
 	"github.com/0xsequence/bundler/lib/types"
 	"github.com/0xsequence/bundler/mempool"
+	"github.com/0xsequence/bundler/p2p"
 	"github.com/0xsequence/bundler/proto"
 	"github.com/0xsequence/bundler/sender"
 	"github.com/0xsequence/ethkit/ethtxn"
@@ -37,6 +38,7 @@ func TestReservePullOps(t *testing.T) {
 	mockProvider := &mocks.MockProvider{}
 	mockCollector := &mocks.MockCollector{}
 	mockRegistry := &mocks.MockRegistry{}
+	mockHost := &mocks.MockP2p{}
 
 	mockWallet.On("Address").Return(common.Address{}, nil).Maybe()
 	mockWalletFactory.On("GetWallet", mock.Anything).Return(mockWallet, nil).Maybe()
@@ -55,6 +57,7 @@ func TestReservePullOps(t *testing.T) {
 		mockValidator,
 		mockCollector,
 		mockRegistry,
+		mockHost,
 	)
 
 	done := make(chan struct{})
@@ -83,6 +86,7 @@ func TestSimulateOpErr(t *testing.T) {
 	mockProvider := &mocks.MockProvider{}
 	mockCollector := &mocks.MockCollector{}
 	mockRegistry := &mocks.MockRegistry{}
+	mockHost := &mocks.MockP2p{}
 
 	addr := common.HexToAddress("0x7537713a54d2506b36eFa389F9341d63815ddE48")
 	balance := big.NewInt(1000000000000000000)
@@ -109,6 +113,7 @@ func TestSimulateOpErr(t *testing.T) {
 		mockValidator,
 		mockCollector,
 		mockRegistry,
+		mockHost,
 	)
 
 	done := make(chan struct{})
@@ -154,6 +159,7 @@ func TestSimulatePaidNotPaid(t *testing.T) {
 	mockProvider := &mocks.MockProvider{}
 	mockCollector := &mocks.MockCollector{}
 	mockRegistry := &mocks.MockRegistry{}
+	mockHost := &mocks.MockP2p{}
 
 	mockWallet.On("Address").Return(common.Address{}, nil).Maybe()
 	mockWalletFactory.On("GetWallet", mock.Anything).Return(mockWallet, nil).Maybe()
@@ -182,6 +188,7 @@ func TestSimulatePaidNotPaid(t *testing.T) {
 		mockValidator,
 		mockCollector,
 		mockRegistry,
+		mockHost,
 	)
 
 	done := make(chan struct{})
@@ -228,6 +235,7 @@ func TestSendAndBanEndorserFailedTx(t *testing.T) {
 	mockProvider := &mocks.MockProvider{}
 	mockCollector := &mocks.MockCollector{}
 	mockRegistry := &mocks.MockRegistry{}
+	mockHost := &mocks.MockP2p{}
 
 	endorserAddr := common.HexToAddress("0x08FFc248A190E700421C0aFB4135768406dCebfF")
 
@@ -268,6 +276,7 @@ func TestSendAndBanEndorserFailedTx(t *testing.T) {
 		mockValidator,
 		mockCollector,
 		mockRegistry,
+		mockHost,
 	)
 
 	done := make(chan struct{})
@@ -323,6 +332,7 @@ func TestSendAndBanEndorserFailedTx(t *testing.T) {
 	}, &pricefeed.Snapshot{}).Once()
 	mockCollector.On("BaseFee").Return(big.NewInt(100), nil).Once()
 
+	mockHost.On("ReportOperation", op.Hash(), p2p.PeerUnpaidOperation).Once()
 	mockRegistry.On("BanEndorser", endorserAddr, registry.PermanentBan).Run(func(args mock.Arguments) {
 		done <- struct{}{}
 	}).Return().Once()
@@ -337,6 +347,7 @@ func TestSendAndBanEndorserFailedTx(t *testing.T) {
 	mockWallet.AssertExpectations(t)
 	mockMempool.AssertExpectations(t)
 	mockValidator.AssertExpectations(t)
+	mockHost.AssertExpectations(t)
 }
 
 func TestSendAndBanEndorserLowPayment(t *testing.T) {
@@ -349,6 +360,7 @@ func TestSendAndBanEndorserLowPayment(t *testing.T) {
 	mockProvider := &mocks.MockProvider{}
 	mockCollector := &mocks.MockCollector{}
 	mockRegistry := &mocks.MockRegistry{}
+	mockHost := &mocks.MockP2p{}
 
 	endorserAddr := common.HexToAddress("0x08FFc248A190E700421C0aFB4135768406dCebfF")
 
@@ -389,6 +401,7 @@ func TestSendAndBanEndorserLowPayment(t *testing.T) {
 		mockValidator,
 		mockCollector,
 		mockRegistry,
+		mockHost,
 	)
 
 	done := make(chan struct{})
@@ -438,6 +451,7 @@ func TestSendAndBanEndorserLowPayment(t *testing.T) {
 	}, &pricefeed.Snapshot{}).Once()
 	mockCollector.On("BaseFee").Return(big.NewInt(100), nil).Once()
 
+	mockHost.On("ReportOperation", op.Hash(), p2p.PeerUnpaidOperation).Once()
 	mockRegistry.On("BanEndorser", endorserAddr, registry.PermanentBan).Run(func(args mock.Arguments) {
 		done <- struct{}{}
 	}).Return().Once()
@@ -455,6 +469,7 @@ func TestSendAndBanEndorserLowPayment(t *testing.T) {
 	mockWallet.AssertExpectations(t)
 	mockMempool.AssertExpectations(t)
 	mockValidator.AssertExpectations(t)
+	mockHost.AssertExpectations(t)
 }
 
 func TestSend(t *testing.T) {
@@ -467,6 +482,7 @@ func TestSend(t *testing.T) {
 	mockProvider := &mocks.MockProvider{}
 	mockCollector := &mocks.MockCollector{}
 	mockRegistry := &mocks.MockRegistry{}
+	mockHost := &mocks.MockP2p{}
 
 	addr := common.HexToAddress("0x7537713a54d2506b36eFa389F9341d63815ddE48")
 	mockWallet.On("Address").Return(addr, nil).Maybe()
@@ -505,6 +521,7 @@ func TestSend(t *testing.T) {
 		mockValidator,
 		mockCollector,
 		mockRegistry,
+		mockHost,
 	)
 
 	done := make(chan struct{})
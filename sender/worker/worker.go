@@ -37,6 +37,8 @@ type ReleaseOp struct {
 type BanEndorser struct {
 	Endorser common.Address
 	Type     registry.BanType
+	// Operation that failed to pay, if any
+	Op string
 }
 
 type OperationReady struct {
@@ -457,7 +459,7 @@ func (w *Worker) inspectReceipt(
 		w.metrics.inspectReceiptReverted.With(prometheus.Labels{"lied": "true"}).Inc()
 		w.logger.Error("inspector: endorser lied", "op", op.Hash(), "tx", receipt.TxHash.String())
 
-		w.ban <- &BanEndorser{Endorser: op.Endorser, Type: registry.PermanentBan}
+		w.ban <- &BanEndorser{Endorser: op.Endorser, Type: registry.PermanentBan, Op: op.Hash()}
 		return
 	}
 
@@ -556,7 +558,7 @@ func (w *Worker) inspectReceipt(
 	}
 
 	// The endorser lied to us
-	w.ban <- &BanEndorser{Endorser: op.Endorser, Type: registry.PermanentBan}
+	w.ban <- &BanEndorser{Endorser: op.Endorser, Type: registry.PermanentBan, Op: op.Hash()}
 }
 
 func (w *Worker) balanceOf(ctx context.Context, token common.Address, blockNum *big.Int) (*big.Int, error) {